@@ -3,8 +3,9 @@ module github.com/tiers-undiknas/api-api-keys
 go 1.23.4
 
 require (
-	filippo.io/edwards25519 v1.1.0 // indirect
-	github.com/go-sql-driver/mysql v1.9.2 // indirect
-	github.com/google/uuid v1.6.0 // indirect
-	github.com/gorilla/mux v1.8.1 // indirect
+	github.com/DATA-DOG/go-sqlmock v1.5.2
+	github.com/go-sql-driver/mysql v1.9.2
+	github.com/gorilla/mux v1.8.1
 )
+
+require filippo.io/edwards25519 v1.1.0 // indirect
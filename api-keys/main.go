@@ -1,17 +1,40 @@
 package main
 
 import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"expvar"
+	"flag"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql" // Driver MySQL
@@ -20,13 +43,67 @@ import (
 
 // APIKeyRecord struct untuk menyimpan data API Key dari database
 type APIKeyRecord struct {
-	ID         int64        `json:"id"`
-	ClientName string       `json:"client_name"`
-	KeyPrefix  string       `json:"key_prefix"` // Beberapa karakter awal dari API Key asli untuk identifikasi
-	APIKeyHash string       `json:"-"`          // Hash dari API Key, tidak dikirim ke klien
-	IsActive   bool         `json:"is_active"`
-	CreatedAt  time.Time    `json:"created_at"`
-	LastUsedAt sql.NullTime `json:"last_used_at"` // Menggunakan sql.NullTime untuk kolom yang bisa NULL
+	ID         int64      `json:"id"`
+	ClientName string     `json:"client_name"` // Salinan api_clients.name, disinkronkan saat klien diganti nama
+	KeyPrefix  string     `json:"key_prefix"`  // Beberapa karakter awal dari API Key asli untuk identifikasi
+	APIKeyHash string     `json:"-"`           // Hash dari API Key, tidak dikirim ke klien
+	IsActive   bool       `json:"is_active"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"` // nil jika kunci belum pernah dipakai (kolom NULL)
+	// HashVersion adalah versi pepper yang dipakai untuk APIKeyHash; 0 berarti SHA-256 tanpa pepper (format lama).
+	HashVersion int `json:"-"`
+	// ClientID adalah ID klien pemilik kunci di tabel api_clients.
+	ClientID *int64 `json:"client_id"`
+	// Scopes berisi izin yang dimiliki kunci (misalnya "reports:read", "orders:write").
+	Scopes []string `json:"scopes"`
+	// AllowedRoutes berisi pola "METHOD /path" opsional. Jika kosong, semua rute boleh diakses
+	// (selama scope yang dibutuhkan rute terpenuhi).
+	AllowedRoutes []string `json:"allowed_routes"`
+	// AllowedCIDRs berisi rentang alamat klien (IPv4/IPv6, misalnya "203.0.113.0/24") yang boleh memakai
+	// kunci ini. Jika kosong, kunci boleh dipakai dari alamat mana pun.
+	AllowedCIDRs []string `json:"allowed_cidrs"`
+	// ReplacedByID berisi ID kunci pengganti jika kunci ini sudah dirotasi.
+	ReplacedByID *int64 `json:"replaced_by_id,omitempty"`
+	// DeactivateAt adalah batas akhir masa tenggang; setelah waktu ini kunci dinonaktifkan otomatis.
+	DeactivateAt *time.Time `json:"deactivate_at,omitempty"`
+	// ExpiresAt adalah waktu kedaluwarsa opsional. NULL berarti kunci tidak pernah kedaluwarsa.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// RateLimitPerMinute menimpa defaultRateLimitPerMinute untuk kunci ini. nil berarti memakai default,
+	// 0 berarti tanpa batas.
+	RateLimitPerMinute *int `json:"rate_limit_per_minute,omitempty"`
+	// MonthlyQuota adalah jatah request per bulan kalender (UTC). nil berarti tanpa kuota.
+	MonthlyQuota *int64 `json:"monthly_quota,omitempty"`
+	// QuotaEnforcement adalah "hard" (tolak setelah kuota habis) atau "soft" (hanya peringatan).
+	QuotaEnforcement string `json:"quota_enforcement"`
+	// KeyType adalah "secret" (hanya untuk server) atau "publishable" (boleh ditanam di kode front-end,
+	// tetapi hanya berlaku dari origin di AllowedOrigins).
+	KeyType string `json:"key_type"`
+	// Environment adalah "live" (produksi) atau "test" (sandbox). Kunci test hanya diterima rute yang
+	// menyediakan handler sandbox (lihat envHandler) dan tidak boleh menyentuh data produksi.
+	Environment string `json:"environment"`
+	// AllowedOrigins berisi host yang boleh memakai kunci publishable (misalnya "app.contoh.com" atau
+	// "*.contoh.com"), dicocokkan dengan header Origin atau Referer.
+	AllowedOrigins []string `json:"allowed_origins,omitempty"`
+	// SigningSecretEnc adalah signing secret mode tanda tangan HMAC yang terenkripsi (nonce AES-GCM diikuti
+	// ciphertext). nil berarti kunci belum memiliki signing secret.
+	SigningSecretEnc []byte `json:"-"`
+	// SigningSecret adalah signing secret dalam bentuk teks biasa. Hanya terisi pada record yang baru dibuat
+	// atau baru diganti secret-nya, agar bisa ditampilkan sekali ke klien; tidak pernah dibaca dari database.
+	SigningSecret string `json:"-"`
+}
+
+// APIKeyOptions berisi atribut opsional yang ditetapkan saat sebuah API Key dibuat.
+type APIKeyOptions struct {
+	Scopes             []string
+	AllowedRoutes      []string
+	AllowedCIDRs       []string
+	ExpiresAt          *time.Time
+	RateLimitPerMinute *int
+	MonthlyQuota       *int64
+	QuotaEnforcement   string // Kosong berarti quotaEnforcementHard
+	KeyType            string // Kosong berarti apiKeyTypeSecret
+	Environment        string // Kosong berarti apiKeyEnvironmentLive
+	AllowedOrigins     []string
 }
 
 // Variabel global untuk koneksi database
@@ -43,14 +120,254 @@ const (
 )
 
 const apiKeyHeader = "X-API-Key" // Nama header untuk API Key
-const apiKeyPrefixLength = 8     // Panjang prefix API Key yang disimpan untuk identifikasi
+const apiKeyPrefixLength = 8     // Jumlah karakter acak yang ikut disimpan di key_prefix untuk identifikasi
+
+// --- Konfigurasi Sumber API Key ---
+
+// APIKeySource adalah tempat apiKeyAuthMiddleware membaca API Key mentah.
+type APIKeySource string
+
+const (
+	apiKeySourceHeader        APIKeySource = "header"        // Header X-API-Key
+	apiKeySourceAuthorization APIKeySource = "authorization" // Header "Authorization: ApiKey <key>"
+	apiKeySourceQuery         APIKeySource = "query"         // Parameter query api_key (hanya jika rute mengizinkannya)
+)
+
+const (
+	apiKeyAuthScheme  = "ApiKey"  // Skema header Authorization untuk API Key
+	apiKeyQueryParam  = "api_key" // Nama parameter query untuk API Key
+	redactedQueryText = "REDACTED"
+)
+
+// defaultAPIKeySources adalah urutan sumber yang dipakai apiKeyAuthMiddleware. Parameter query sengaja tidak
+// termasuk karena URL mudah tercatat di log, riwayat browser, dan header Referer; rute yang membutuhkannya
+// harus mengaktifkannya sendiri melalui apiKeyAuthMiddlewareFrom.
+var defaultAPIKeySources = []APIKeySource{apiKeySourceAuthorization, apiKeySourceHeader}
+
+// --- Konfigurasi Format API Key ---
+const (
+	apiKeyFormatPrefix      = "ak"   // Prefix tetap untuk semua kunci format baru, agar mudah dikenali secret scanner
+	apiKeyEnvironmentLive   = "live" // Penanda lingkungan produksi
+	apiKeyEnvironmentTest   = "test" // Penanda lingkungan pengujian
+	apiKeyRandomLength      = 30     // Jumlah karakter base62 acak (~178 bit)
+	apiKeyChecksumLength    = 6      // Panjang checksum CRC32 dalam base62
+	apiKeyMaxLength         = 128    // Kunci yang lebih panjang dari ini langsung ditolak
+	legacyAPIKeyRandomBytes = 32     // Jumlah byte acak pada kunci format lama (label_base64)
+)
+
+// apiKeyExpiryWarningDays adalah jumlah hari sebelum kedaluwarsa di mana respons mulai membawa header peringatan.
+const apiKeyExpiryWarningDays = 14
+
+// Error yang dikembalikan validateAPIKey, agar pemanggil bisa membedakan alasan penolakan.
+var (
+	errAPIKeyInvalid = errors.New("API Key tidak valid atau tidak aktif")
+	errAPIKeyExpired = errors.New("API Key sudah kedaluwarsa")
+	// errAPIKeyMalformed berarti bentuk kunci salah (misalnya salah ketik); ditolak tanpa query ke database.
+	errAPIKeyMalformed = errors.New("format API Key tidak valid")
+)
+
+// --- Konfigurasi Klien API ---
+
+// Status klien di tabel api_clients. Klien yang ditangguhkan tidak bisa memakai maupun membuat API Key.
+const (
+	clientStatusActive    = "active"
+	clientStatusSuspended = "suspended"
+)
+
+var (
+	errClientExists    = errors.New("klien dengan nama tersebut sudah ada")
+	errClientSuspended = errors.New("klien sedang ditangguhkan")
+)
+
+// --- Konfigurasi Pepper Hash API Key ---
+// Hash API Key dibuat dengan HMAC-SHA256 yang dikunci pepper rahasia milik server, sehingga tabel api_keys
+// yang bocor saja tidak cukup untuk menguji kandidat kunci secara offline. Pepper TIDAK disimpan di database.
+// Pepper wajib diset lewat variabel lingkungan API_KEY_PEPPERS dengan format "1:pepperLama,2:pepperBaru";
+// server tidak mau berjalan tanpanya. Versi terbesar dipakai untuk kunci baru; versi lama tetap dibutuhkan
+// sampai semua kunci yang memakainya sudah di-upgrade.
+var apiKeyPeppers map[int][]byte
+
+// legacyAPIKeyHashVersion menandai hash SHA-256 tanpa pepper dari format lama.
+const legacyAPIKeyHashVersion = 0
+
+// currentAPIKeyHashVersion adalah versi pepper terbesar; diisi oleh loadAPIKeyPeppers.
+var currentAPIKeyHashVersion = 1
+
+// Tipe API Key.
+const (
+	apiKeyTypeSecret      = "secret"      // Hanya untuk dipakai dari server; tidak dibatasi origin
+	apiKeyTypePublishable = "publishable" // Boleh ditanam di kode front-end; dibatasi ke allowed_origins
+)
+
+// --- Konfigurasi CORS untuk Kunci Publishable ---
+const (
+	corsAllowHeaders  = "X-API-Key, Authorization, Content-Type"
+	corsExposeHeaders = "RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy, Retry-After, X-Quota-Limit, X-Quota-Remaining, X-Quota-Reset, Sunset, Warning"
+	corsMaxAgeSeconds = 600 // Lama browser boleh menyimpan hasil preflight
+)
+
+// --- Konfigurasi Mode Tanda Tangan HMAC ---
+// Pada mode ini klien tidak mengirim API Key mentah. Klien mengirim key ID (key_prefix) dan menandatangani
+// request dengan signing secret miliknya. Signing secret dibuat acak untuk setiap kunci, disimpan terenkripsi
+// dengan apiKeySigningEncryptionKey, dan hanya ditampilkan sekali saat dibuat.
+const (
+	apiKeyIDHeader             = "X-API-Key-Id"    // key_prefix kunci yang menandatangani
+	apiKeyTimestampHeader      = "X-API-Timestamp" // Waktu Unix (detik) saat request ditandatangani
+	apiKeyNonceHeader          = "X-API-Nonce"     // Nilai acak unik per request (16-64 karakter)
+	apiKeySignatureHeader      = "X-API-Signature" // Hex HMAC-SHA256 dari canonical request
+	signedRequestMaxClockSkew  = 5 * time.Minute   // Selisih maksimum timestamp request dengan jam server
+	signedRequestMaxBodyBytes  = 10 << 20          // Ukuran body maksimum yang dibaca untuk digest (10 MB)
+	signedRequestNonceCapacity = 500000            // Jumlah nonce maksimum yang diingat
+	signingSecretBytes         = 32                // Panjang signing secret acak (dikirim sebagai 64 karakter hex)
+)
+
+// apiKeySigningEncryptionKey adalah kunci AES-256 untuk mengenkripsi signing secret di kolom
+// api_keys.signing_secret_enc. Tidak ada nilai bawaan: server dan CLI menolak berjalan sebelum variabel
+// lingkungan API_KEY_SIGNING_KEY (64 karakter hex) diset. Mengganti nilai ini membatalkan semua signing
+// secret yang sudah dibagikan.
+var apiKeySigningEncryptionKey []byte
+
+// Error mode tanda tangan HMAC.
+var (
+	errSignatureInvalid = errors.New("tanda tangan request tidak valid")
+	errSignatureExpired = errors.New("timestamp request di luar jendela waktu yang diizinkan")
+	errNonceReused      = errors.New("nonce sudah pernah dipakai")
+)
+
+// adminScope adalah scope yang dibutuhkan untuk mengakses endpoint /admin.
+const adminScope = "admin"
+
+// --- Konfigurasi Rate Limit ---
+const (
+	defaultRateLimitPerMinute = 60              // Batas request per menit per kunci jika kolom rate_limit_per_minute NULL
+	rateLimitCleanupInterval  = 5 * time.Minute // Interval pembersihan bucket yang tidak dipakai
+)
+
+// --- Konfigurasi Log Request API Key ---
+const (
+	usageLogQueueSize      = 10000           // Kapasitas antrean log request sebelum entri dibuang
+	usageLogBatchSize      = 200             // Jumlah entri maksimum per INSERT
+	usageLogFlushInterval  = 2 * time.Second // Interval penulisan batch yang belum penuh
+	usageLogRetentionDays  = 90              // Log request yang lebih tua dari ini dihapus
+	usageLogPruneInterval  = 1 * time.Hour   // Seberapa sering log lama dihapus
+	usageReportDefaultDays = 7               // Rentang default laporan pemakaian
+	usageReportMaxDays     = 93              // Rentang maksimum laporan pemakaian
+)
+
+// --- Konfigurasi Cache Validasi API Key ---
+const (
+	apiKeyCacheCapacity         = 10000            // Jumlah maksimum kunci valid yang di-cache
+	apiKeyCacheTTL              = 60 * time.Second // Lama hasil validasi positif disimpan
+	apiKeyNegativeCacheCapacity = 10000            // Jumlah maksimum hash tidak dikenal yang di-cache
+	apiKeyNegativeCacheTTL      = 10 * time.Second // Lama hasil validasi negatif disimpan
+)
+
+// --- Konfigurasi Webhook ---
+// Event siklus hidup API Key dikirim ke URL webhook milik klien melalui tabel outbox, sehingga event
+// tidak hilang saat server restart dan pengiriman yang gagal dicoba ulang dengan backoff eksponensial.
+const (
+	webhookPollInterval           = 5 * time.Second  // Seberapa sering outbox diperiksa
+	webhookBatchSize              = 20               // Jumlah pengiriman maksimum yang diproses bersamaan
+	webhookTimeout                = 10 * time.Second // Batas waktu satu pengiriman HTTP
+	webhookLease                  = 60 * time.Second // Lama event yang sedang dikirim tidak diambil proses lain
+	webhookMaxAttempts            = 12               // Setelah ini event ditandai gagal permanen
+	webhookBackoffBase            = 30 * time.Second // Jeda sebelum percobaan ulang pertama; berlipat dua tiap gagal
+	webhookBackoffMax             = 6 * time.Hour    // Jeda maksimum antar percobaan
+	webhookThrottleNotifyInterval = 15 * time.Minute // Event throttled untuk kunci yang sama dikirim paling sering sekali per interval ini
+	webhookExpiryCheckInterval    = 1 * time.Hour    // Seberapa sering kunci yang mendekati kedaluwarsa diperiksa
+	webhookDeliveryLogLimit       = 100              // Jumlah entri log pengiriman yang ditampilkan per webhook
+	webhookResolveTimeout         = 5 * time.Second  // Batas waktu resolve DNS host URL webhook saat didaftarkan
+)
+
+// webhookBlockedPrefixes adalah rentang alamat yang tidak boleh menjadi tujuan webhook selain yang sudah
+// ditolak oleh webhookTargetAllowed (loopback, link-local, privat, multicast, unspecified): jaringan
+// internal operator (CGNAT), alamat khusus/cadangan, dan NAT64 yang dapat memetakan ke alamat IPv4 internal.
+var webhookBlockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// webhookAllowPrivateTargets mengizinkan webhook ke alamat loopback dan jaringan privat, misalnya penerima
+// httptest atau layanan di mesin pengembang. Diisi dari variabel lingkungan WEBHOOK_ALLOW_PRIVATE_TARGETS
+// oleh loadWebhookTargetPolicy; bawaannya false dan jangan diaktifkan di produksi.
+var webhookAllowPrivateTargets bool
+
+// errWebhookTargetForbidden dikembalikan jika URL webhook mengarah ke alamat internal.
+var errWebhookTargetForbidden = errors.New("URL webhook tidak boleh mengarah ke alamat loopback, link-local, atau jaringan privat")
+
+// Header pada setiap pengiriman webhook. Tanda tangan adalah "v1=" + hex(HMAC-SHA256(secret, timestamp + "." + body)).
+const (
+	webhookIDHeader        = "X-Webhook-Id" // ID event di outbox; sama untuk setiap percobaan ulang
+	webhookEventHeader     = "X-Webhook-Event"
+	webhookTimestampHeader = "X-Webhook-Timestamp"
+	webhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// Jenis event webhook.
+const (
+	webhookEventKeyCreated   = "api_key.created"
+	webhookEventKeyRotated   = "api_key.rotated"
+	webhookEventKeyExpiring  = "api_key.expiring"
+	webhookEventKeyRevoked   = "api_key.revoked"
+	webhookEventKeyThrottled = "api_key.throttled"
+	webhookEventPing         = "webhook.ping" // Dikirim manual oleh admin untuk menguji penerima
+)
+
+var webhookEventTypes = []string{webhookEventKeyCreated, webhookEventKeyRotated, webhookEventKeyExpiring, webhookEventKeyRevoked, webhookEventKeyThrottled}
+
+// --- Konfigurasi Penulisan Pemakaian API Key ---
+const (
+	usageWriterFlushInterval  = 5 * time.Second  // Interval penulisan last_used_at dan penghitung kuota
+	usageWriterBatchSize      = 500              // Jumlah kunci maksimum per statement
+	usageWriterMaxPendingKeys = 100000           // Batas jumlah kunci tertunda; pemakaian kunci baru di atas ini dibuang
+	shutdownTimeout           = 15 * time.Second // Batas waktu graceful shutdown
+)
+
+// --- Konfigurasi Laporan Kebocoran API Key ---
+const (
+	leakReportSignatureHeader = "X-Leak-Report-Signature" // Header berisi "sha256=<hex HMAC-SHA256 body>"
+	leakReportMaxTokens       = 100                       // Jumlah token maksimum per laporan
+	leakReportMaxBodyBytes    = 1 << 20                   // Ukuran body laporan maksimum (1 MB)
+)
+
+// leakReportSecret adalah shared secret untuk memverifikasi tanda tangan pelapor kebocoran.
+// Jika kosong, endpoint laporan kebocoran menolak semua laporan dengan status 503.
+var leakReportSecret = os.Getenv("LEAK_REPORT_SECRET")
+
+// --- Konfigurasi Proxy Tepercaya ---
+
+// trustedProxies berisi rentang alamat reverse proxy/load balancer yang boleh menentukan alamat klien
+// melalui header X-Forwarded-For. Diisi dari variabel lingkungan TRUSTED_PROXIES (daftar CIDR dipisahkan koma)
+// oleh loadTrustedProxies. Jika kosong, X-Forwarded-For diabaikan dan alamat koneksi langsung yang dipakai.
+var trustedProxies []netip.Prefix
+
+// --- Konfigurasi Rotasi API Key ---
+const (
+	defaultRotationGracePeriod = 24 * time.Hour      // Masa tenggang default kunci lama setelah dirotasi
+	maxRotationGracePeriod     = 30 * 24 * time.Hour // Masa tenggang maksimum yang boleh diminta
+	keyDeactivationInterval    = 1 * time.Minute     // Seberapa sering kunci yang masa tenggangnya habis dinonaktifkan
+)
+
+// contextKey adalah tipe kunci untuk nilai yang disimpan di context request.
+type contextKey string
+
+const (
+	apiKeyRecordContextKey      contextKey = "apiKeyRecord"      // Kunci context untuk *APIKeyRecord yang terautentikasi
+	apiKeyEnvironmentContextKey contextKey = "apiKeyEnvironment" // Kunci context untuk lingkungan kunci ("live"/"test")
+	testKeysAcceptedContextKey  contextKey = "testKeysAccepted"  // Diset oleh acceptsTestKeys untuk rute yang menerima kunci test
+)
 
 // --- Fungsi-fungsi Database ---
 
 // initDB menginisialisasi koneksi ke database MySQL dan membuat tabel jika belum ada.
 func initDB() {
 	var err error
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true", dbUser, dbPassword, dbHost, dbPort, dbName)
+	// time_zone diset ke UTC agar waktu yang dibandingkan di Go (parseTime, loc=UTC) sama dengan CURRENT_TIMESTAMP di MySQL
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true&time_zone=%%27%%2B00%%3A00%%27", dbUser, dbPassword, dbHost, dbPort, dbName)
 	db, err = sql.Open("mysql", dsn)
 	if err != nil {
 		log.Fatalf("Error membuka koneksi database: %v", err)
@@ -66,246 +383,5090 @@ func initDB() {
 	createTableQuery := `
         CREATE TABLE IF NOT EXISTS api_keys (
             id INT AUTO_INCREMENT PRIMARY KEY,
-            client_name VARCHAR(255) NOT NULL,
-            key_prefix VARCHAR(10) NOT NULL UNIQUE, -- Untuk identifikasi cepat, bukan untuk auth
-            api_key_hash VARCHAR(64) NOT NULL UNIQUE, -- SHA256 hash dalam hex (64 karakter)
+            client_id INT NULL, -- Pemilik kunci di api_clients
+            client_name VARCHAR(255) NOT NULL, -- Salinan api_clients.name untuk kemudahan membaca
+            key_prefix VARCHAR(32) NOT NULL UNIQUE, -- Untuk identifikasi cepat, bukan untuk auth
+            api_key_hash VARCHAR(64) NOT NULL UNIQUE, -- HMAC-SHA256 (atau SHA256 untuk format lama) dalam hex (64 karakter)
+            hash_version TINYINT NOT NULL DEFAULT 0, -- Versi pepper; 0 = SHA256 tanpa pepper
             is_active BOOLEAN DEFAULT TRUE,
+            suspended_with_client BOOLEAN NOT NULL DEFAULT FALSE, -- Dinonaktifkan karena kliennya ditangguhkan
             created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-            last_used_at TIMESTAMP NULL DEFAULT NULL
+            last_used_at TIMESTAMP NULL DEFAULT NULL,
+            scopes TEXT NULL, -- Daftar scope dipisahkan koma
+            allowed_routes TEXT NULL, -- JSON array pola "METHOD /path"
+            allowed_cidrs TEXT NULL, -- JSON array CIDR alamat klien yang diizinkan
+            replaced_by_id INT NULL, -- ID kunci pengganti setelah rotasi
+            deactivate_at TIMESTAMP NULL DEFAULT NULL, -- Akhir masa tenggang setelah rotasi
+            expires_at TIMESTAMP NULL DEFAULT NULL, -- NULL berarti tidak pernah kedaluwarsa
+            expiry_notified_at TIMESTAMP NULL DEFAULT NULL, -- Saat webhook api_key.expiring dikirim
+            rate_limit_per_minute INT NULL, -- Override rate limit per kunci; NULL = default, 0 = tanpa batas
+            monthly_quota BIGINT NULL, -- Jatah request per bulan; NULL = tanpa kuota
+            quota_enforcement VARCHAR(4) NOT NULL DEFAULT 'hard', -- 'hard' atau 'soft'
+            key_type VARCHAR(12) NOT NULL DEFAULT 'secret', -- 'secret' atau 'publishable'
+            environment VARCHAR(4) NOT NULL DEFAULT 'live', -- 'live' atau 'test', sama dengan penanda di API Key
+            allowed_origins TEXT NULL, -- JSON array host yang diizinkan untuk kunci publishable
+            INDEX idx_api_keys_client (client_id)
         ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
     `
 	_, err = db.Exec(createTableQuery)
 	if err != nil {
-		log.Fatalf("Error membuat tabel api_keys: %v", err)
+		log.Fatalf("Error membuat tabel api_keys: %v", err)
+	}
+
+	// Tabel klien pemilik API Key; satu klien bisa memiliki banyak kunci
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS api_clients (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            name VARCHAR(255) NOT NULL UNIQUE,
+            contact_email VARCHAR(255) NOT NULL DEFAULT '',
+            status VARCHAR(12) NOT NULL DEFAULT 'active', -- 'active' atau 'suspended'
+            metadata TEXT NULL, -- JSON object bebas (misalnya nomor kontrak, tim pemilik)
+            created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            suspended_at TIMESTAMP NULL DEFAULT NULL
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+    `)
+	if err != nil {
+		log.Fatalf("Error membuat tabel api_clients: %v", err)
+	}
+
+	// Tabel webhook per klien, outbox event yang menunggu dikirim, dan log setiap percobaan pengiriman
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS api_client_webhooks (
+            id INT AUTO_INCREMENT PRIMARY KEY,
+            client_id INT NOT NULL,
+            url VARCHAR(2048) NOT NULL,
+            secret_enc VARBINARY(128) NOT NULL, -- nonce||ciphertext AES-256-GCM dengan API_KEY_SIGNING_KEY (lihat webhookSecretAD)
+            events TEXT NULL, -- Daftar jenis event dipisahkan koma; kosong = semua event
+            is_active BOOLEAN NOT NULL DEFAULT TRUE,
+            created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            INDEX idx_api_client_webhooks_client (client_id)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+    `)
+	if err != nil {
+		log.Fatalf("Error membuat tabel api_client_webhooks: %v", err)
+	}
+	if n, err := migrateWebhookSecrets(); err != nil {
+		log.Fatalf("Error mengenkripsi secret webhook lama: %v", err)
+	} else if n > 0 {
+		log.Printf("%d secret webhook lama dienkripsi.", n)
+	}
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS webhook_outbox (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            webhook_id INT NOT NULL,
+            event_type VARCHAR(64) NOT NULL,
+            payload MEDIUMTEXT NOT NULL, -- Body JSON yang dikirim, sama persis di setiap percobaan
+            status VARCHAR(12) NOT NULL DEFAULT 'pending', -- 'pending', 'delivered', 'failed', atau 'cancelled'
+            attempts INT NOT NULL DEFAULT 0,
+            next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            last_error VARCHAR(1024) NULL,
+            created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            delivered_at TIMESTAMP NULL DEFAULT NULL,
+            INDEX idx_webhook_outbox_due (status, next_attempt_at),
+            INDEX idx_webhook_outbox_webhook (webhook_id)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+    `)
+	if err != nil {
+		log.Fatalf("Error membuat tabel webhook_outbox: %v", err)
+	}
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS webhook_deliveries (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            outbox_id BIGINT NOT NULL,
+            webhook_id INT NOT NULL,
+            attempt INT NOT NULL,
+            status_code SMALLINT NULL, -- NULL jika penerima tidak dapat dihubungi
+            error VARCHAR(1024) NOT NULL DEFAULT '',
+            duration_ms INT NOT NULL,
+            created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            INDEX idx_webhook_deliveries_webhook (webhook_id, id)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+    `)
+	if err != nil {
+		log.Fatalf("Error membuat tabel webhook_deliveries: %v", err)
+	}
+
+	// Tabel penghitung pemakaian per kunci per periode tagihan (bulan)
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS api_key_usage_periods (
+            api_key_id INT NOT NULL,
+            period CHAR(7) NOT NULL, -- Format YYYY-MM (UTC)
+            request_count BIGINT NOT NULL DEFAULT 0,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+            PRIMARY KEY (api_key_id, period)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+    `)
+	if err != nil {
+		log.Fatalf("Error membuat tabel api_key_usage_periods: %v", err)
+	}
+
+	// Tabel log setiap request terautentikasi, untuk laporan pemakaian per kunci
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS api_key_requests (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            api_key_id INT NOT NULL,
+            method VARCHAR(10) NOT NULL,
+            route VARCHAR(255) NOT NULL, -- Template rute, bukan path mentah
+            status SMALLINT NOT NULL,
+            latency_ms INT NOT NULL,
+            remote_addr VARCHAR(64) NOT NULL,
+            created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            INDEX idx_api_key_requests_key_time (api_key_id, created_at),
+            INDEX idx_api_key_requests_time (created_at)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+    `)
+	if err != nil {
+		log.Fatalf("Error membuat tabel api_key_requests: %v", err)
+	}
+
+	// Tabel insiden kebocoran API Key yang dilaporkan melalui /security/leaked-keys
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS api_key_leak_incidents (
+            id BIGINT AUTO_INCREMENT PRIMARY KEY,
+            api_key_id INT NOT NULL,
+            key_prefix VARCHAR(32) NOT NULL,
+            token_type VARCHAR(100) NOT NULL DEFAULT '',
+            source VARCHAR(100) NOT NULL DEFAULT '', -- Misalnya "content", "commit", "gist"
+            url VARCHAR(2048) NOT NULL DEFAULT '', -- Lokasi kebocoran menurut pelapor
+            was_active BOOLEAN NOT NULL, -- Apakah kunci masih aktif saat dilaporkan
+            reporter_addr VARCHAR(64) NOT NULL,
+            reported_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            INDEX idx_api_key_leak_incidents_key (api_key_id)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+    `)
+	if err != nil {
+		log.Fatalf("Error membuat tabel api_key_leak_incidents: %v", err)
+	}
+
+	// Tambahkan kolom baru ke tabel lama yang dibuat sebelum kolom tersebut ada
+	columns := []struct{ name, definition string }{
+		{"scopes", "TEXT NULL"},
+		{"allowed_routes", "TEXT NULL"},
+		{"allowed_cidrs", "TEXT NULL"},
+		{"key_type", "VARCHAR(12) NOT NULL DEFAULT 'secret'"},
+		{"environment", "VARCHAR(4) NOT NULL DEFAULT 'live'"}, // Kunci lama dianggap kunci produksi
+		{"allowed_origins", "TEXT NULL"},
+		{"replaced_by_id", "INT NULL"},
+		{"deactivate_at", "TIMESTAMP NULL DEFAULT NULL"},
+		{"expires_at", "TIMESTAMP NULL DEFAULT NULL"},
+		{"rate_limit_per_minute", "INT NULL"},
+		{"monthly_quota", "BIGINT NULL"},
+		{"quota_enforcement", "VARCHAR(4) NOT NULL DEFAULT 'hard'"},
+		{"hash_version", "TINYINT NOT NULL DEFAULT 0"}, // Baris lama memakai SHA256 tanpa pepper
+		{"client_id", "INT NULL"},
+		{"suspended_with_client", "BOOLEAN NOT NULL DEFAULT FALSE"},
+		{"expiry_notified_at", "TIMESTAMP NULL DEFAULT NULL"},
+		{"signing_secret_enc", "VARBINARY(128) NULL"}, // Kunci lama belum punya signing secret
+	}
+	for _, c := range columns {
+		if err := ensureColumn("api_keys", c.name, c.definition); err != nil {
+			log.Fatalf("Error menambahkan kolom '%s' ke tabel api_keys: %v", c.name, err)
+		}
+	}
+	// key_prefix format baru ("ak_live_" + 8 karakter) lebih panjang dari VARCHAR(10) di tabel lama
+	if err := ensureColumnLength("api_keys", "key_prefix", 32, "VARCHAR(32) NOT NULL"); err != nil {
+		log.Fatalf("Error memperlebar kolom 'key_prefix' pada tabel api_keys: %v", err)
+	}
+	if err := ensureIndex("api_keys", "idx_api_keys_client", "client_id"); err != nil {
+		log.Fatalf("Error menambahkan indeks 'idx_api_keys_client' ke tabel api_keys: %v", err)
+	}
+	if n, err := migrateAPIClients(); err != nil {
+		log.Fatalf("Error memigrasikan client_name ke tabel api_clients: %v", err)
+	} else if n > 0 {
+		log.Printf("%d API Key lama dihubungkan ke tabel api_clients berdasarkan client_name.", n)
+	}
+	log.Println("Tabel 'api_keys' siap atau sudah ada.")
+}
+
+// ensureColumn menambahkan kolom ke tabel jika kolom tersebut belum ada.
+// MySQL tidak mendukung "ADD COLUMN IF NOT EXISTS", jadi kita periksa information_schema terlebih dahulu.
+func ensureColumn(table, column, definition string) error {
+	var count int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?",
+		table, column,
+	).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("gagal memeriksa kolom: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// ensureColumnLength memperlebar kolom teks jika panjang maksimumnya masih kurang dari length.
+func ensureColumnLength(table, column string, length int, definition string) error {
+	var current sql.NullInt64
+	err := db.QueryRow(
+		"SELECT CHARACTER_MAXIMUM_LENGTH FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?",
+		table, column,
+	).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("gagal memeriksa kolom: %w", err)
+	}
+	if current.Valid && current.Int64 >= int64(length) {
+		return nil
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// ensureIndex menambahkan indeks ke tabel jika indeks dengan nama tersebut belum ada.
+func ensureIndex(table, index, columns string) error {
+	var count int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ?",
+		table, index,
+	).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("gagal memeriksa indeks: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD INDEX %s (%s)", table, index, columns))
+	return err
+}
+
+// migrateAPIClients membuat satu baris api_clients untuk setiap client_name yang belum punya klien,
+// lalu mengisi client_id pada kunci-kunci tersebut. Kunci dengan client_name yang sama (tanpa membedakan
+// huruf besar/kecil, sesuai collation tabel) menjadi milik klien yang sama.
+// Aman dijalankan berulang kali; mengembalikan jumlah kunci yang dihubungkan.
+func migrateAPIClients() (int64, error) {
+	_, err := db.Exec("INSERT IGNORE INTO api_clients (name) SELECT DISTINCT client_name FROM api_keys WHERE client_id IS NULL")
+	if err != nil {
+		return 0, fmt.Errorf("gagal membuat klien dari client_name: %w", err)
+	}
+	result, err := db.Exec("UPDATE api_keys JOIN api_clients ON api_clients.name = api_keys.client_name SET api_keys.client_id = api_clients.id WHERE api_keys.client_id IS NULL")
+	if err != nil {
+		return 0, fmt.Errorf("gagal mengisi client_id: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// generateAPIKey menghasilkan string API Key yang aman secara kriptografis dengan format:
+// ak_<lingkungan>_<30 karakter acak base62><6 karakter checksum CRC32 base62>, misalnya "ak_live_...".
+// Prefix tetap dan checksum memudahkan secret scanner mengenali kunci yang bocor, dan kunci yang salah
+// ketik bisa ditolak tanpa query ke database (lihat checkAPIKeyFormat).
+// Mengembalikan API Key mentah dan key_prefix-nya (prefix format ditambah 8 karakter acak pertama).
+func generateAPIKey(environment string) (string, string, error) {
+	if !isAPIKeyEnvironment(environment) {
+		return "", "", fmt.Errorf("lingkungan API Key '%s' tidak dikenal", environment)
+	}
+	random, err := randomBase62(apiKeyRandomLength)
+	if err != nil {
+		return "", "", fmt.Errorf("gagal menghasilkan karakter acak: %w", err)
+	}
+	head := apiKeyFormatPrefix + "_" + environment + "_"
+	apiKey := head + random + apiKeyChecksum(head+random)
+
+	// key_prefix mengikutsertakan sebagian bagian acak agar unik antar kunci
+	keyPrefixForDB := head + random[:apiKeyPrefixLength]
+
+	return apiKey, keyPrefixForDB, nil
+}
+
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// randomBase62 menghasilkan n karakter base62 acak yang terdistribusi merata
+// (byte >= 248 dibuang agar modulo 62 tidak bias).
+func randomBase62(n int) (string, error) {
+	out := make([]byte, 0, n)
+	buf := make([]byte, n+n/4)
+	for len(out) < n {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if b >= 248 {
+				continue
+			}
+			out = append(out, base62Alphabet[b%62])
+			if len(out) == n {
+				break
+			}
+		}
+	}
+	return string(out), nil
+}
+
+// apiKeyChecksum menghitung CRC32 (IEEE) dari bagian kunci sebelum checksum, di-encode sebagai
+// base62 dengan panjang tetap apiKeyChecksumLength.
+func apiKeyChecksum(s string) string {
+	sum := uint64(crc32.ChecksumIEEE([]byte(s)))
+	out := make([]byte, apiKeyChecksumLength)
+	for i := apiKeyChecksumLength - 1; i >= 0; i-- {
+		out[i] = base62Alphabet[sum%62]
+		sum /= 62
+	}
+	return string(out)
+}
+
+// isAPIKeyEnvironment melaporkan apakah env adalah penanda lingkungan yang dikenal.
+func isAPIKeyEnvironment(env string) bool {
+	return env == apiKeyEnvironmentLive || env == apiKeyEnvironmentTest
+}
+
+// checkAPIKeyFormat memeriksa bentuk API Key tanpa akses database. Kunci berformat baru (diawali "ak_")
+// harus memiliki lingkungan yang dikenal, panjang dan karakter yang benar, serta checksum yang cocok.
+// Kunci format lama (label_base64) tetap diterima selama bentuknya sesuai.
+func checkAPIKeyFormat(apiKey string) error {
+	if len(apiKey) > apiKeyMaxLength {
+		return errAPIKeyMalformed
+	}
+	if rest, ok := strings.CutPrefix(apiKey, apiKeyFormatPrefix+"_"); ok {
+		environment, body, ok := strings.Cut(rest, "_")
+		if !ok || !isAPIKeyEnvironment(environment) || len(body) != apiKeyRandomLength+apiKeyChecksumLength {
+			return errAPIKeyMalformed
+		}
+		for i := 0; i < len(body); i++ {
+			if strings.IndexByte(base62Alphabet, body[i]) < 0 {
+				return errAPIKeyMalformed
+			}
+		}
+		checked := apiKey[:len(apiKey)-apiKeyChecksumLength]
+		if subtle.ConstantTimeCompare([]byte(apiKeyChecksum(checked)), []byte(apiKey[len(checked):])) != 1 {
+			return errAPIKeyMalformed
+		}
+		return nil
+	}
+
+	// Format lama: label tanpa "_", lalu base64 URL dari 32 byte acak
+	label, encoded, ok := strings.Cut(apiKey, "_")
+	if !ok || label == "" {
+		return errAPIKeyMalformed
+	}
+	decoded, err := base64.URLEncoding.DecodeString(encoded)
+	if err != nil || len(decoded) != legacyAPIKeyRandomBytes {
+		return errAPIKeyMalformed
+	}
+	return nil
+}
+
+// loadAPIKeyPeppers membaca pepper dari variabel lingkungan API_KEY_PEPPERS (wajib) dan
+// menentukan versi pepper yang dipakai untuk kunci baru.
+func loadAPIKeyPeppers() error {
+	env := os.Getenv("API_KEY_PEPPERS")
+	if env == "" {
+		return fmt.Errorf("API_KEY_PEPPERS belum diset (contoh: API_KEY_PEPPERS=\"1:$(openssl rand -hex 32)\")")
+	}
+	peppers := make(map[int][]byte)
+	for _, entry := range strings.Split(env, ",") {
+		versionStr, pepper, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		version, err := strconv.Atoi(versionStr)
+		if !ok || err != nil || version <= legacyAPIKeyHashVersion || version > 127 || pepper == "" {
+			return fmt.Errorf("entri API_KEY_PEPPERS '%s' tidak valid (format: versi:pepper, versi 1-127)", versionStr)
+		}
+		peppers[version] = []byte(pepper)
+	}
+	apiKeyPeppers = peppers
+	currentAPIKeyHashVersion = 0
+	for version := range apiKeyPeppers {
+		if version > currentAPIKeyHashVersion {
+			currentAPIKeyHashVersion = version
+		}
+	}
+	return nil
+}
+
+// hashAPIKey menghasilkan hash API Key dengan pepper versi terbaru (format yang disimpan untuk kunci baru).
+func hashAPIKey(apiKey string) string {
+	hash, _ := hashAPIKeyVersion(apiKey, currentAPIKeyHashVersion) // Versi terbaru selalu ada di apiKeyPeppers
+	return hash
+}
+
+// hashAPIKeyVersion menghasilkan hash API Key dengan versi tertentu: HMAC-SHA256 dengan pepper versi tersebut,
+// atau SHA256 biasa untuk legacyAPIKeyHashVersion.
+func hashAPIKeyVersion(apiKey string, version int) (string, error) {
+	if version == legacyAPIKeyHashVersion {
+		hasher := sha256.New()
+		hasher.Write([]byte(apiKey))
+		return hex.EncodeToString(hasher.Sum(nil)), nil
+	}
+	pepper, ok := apiKeyPeppers[version]
+	if !ok {
+		return "", fmt.Errorf("pepper versi %d tidak dikonfigurasi", version)
+	}
+	mac := hmac.New(sha256.New, pepper)
+	mac.Write([]byte(apiKey))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// apiKeyHashCandidates mengembalikan semua hash yang mungkin tersimpan untuk API Key ini:
+// versi terbaru lebih dulu, lalu versi pepper yang lebih lama, lalu SHA256 format lama.
+func apiKeyHashCandidates(apiKey string) []string {
+	candidates := []string{hashAPIKey(apiKey)}
+	for version := currentAPIKeyHashVersion - 1; version > legacyAPIKeyHashVersion; version-- {
+		if hash, err := hashAPIKeyVersion(apiKey, version); err == nil {
+			candidates = append(candidates, hash)
+		}
+	}
+	legacy, _ := hashAPIKeyVersion(apiKey, legacyAPIKeyHashVersion)
+	return append(candidates, legacy)
+}
+
+// upgradeAPIKeyHash mengganti hash format lama dengan hash versi terbaru setelah kunci berhasil dipakai.
+// Kondisi pada api_key_hash mencegah dua request bersamaan menimpa satu sama lain.
+func upgradeAPIKeyHash(rec *APIKeyRecord, newHash string) error {
+	_, err := db.Exec(
+		"UPDATE api_keys SET api_key_hash = ?, hash_version = ? WHERE id = ? AND api_key_hash = ?",
+		newHash, currentAPIKeyHashVersion, rec.ID, rec.APIKeyHash,
+	)
+	if err != nil {
+		return fmt.Errorf("gagal meng-upgrade hash API Key ID %d: %w", rec.ID, err)
+	}
+	return nil
+}
+
+// validateAPIKeyOptions memeriksa format scope dan pola rute sebelum disimpan.
+func validateAPIKeyOptions(opts APIKeyOptions) error {
+	for _, scope := range opts.Scopes {
+		if scope == "" || strings.ContainsAny(scope, ", \t") {
+			return fmt.Errorf("scope '%s' tidak valid (tidak boleh kosong atau mengandung koma/spasi)", scope)
+		}
+	}
+	for _, route := range opts.AllowedRoutes {
+		if _, _, err := parseRoutePattern(route); err != nil {
+			return err
+		}
+	}
+	for _, cidr := range opts.AllowedCIDRs {
+		if _, err := parseCIDR(cidr); err != nil {
+			return err
+		}
+	}
+	if opts.RateLimitPerMinute != nil && *opts.RateLimitPerMinute < 0 {
+		return fmt.Errorf("rate_limit_per_minute tidak boleh negatif")
+	}
+	if opts.MonthlyQuota != nil && *opts.MonthlyQuota < 0 {
+		return fmt.Errorf("monthly_quota tidak boleh negatif")
+	}
+	switch opts.QuotaEnforcement {
+	case "", quotaEnforcementHard, quotaEnforcementSoft:
+	default:
+		return fmt.Errorf("quota_enforcement harus '%s' atau '%s'", quotaEnforcementHard, quotaEnforcementSoft)
+	}
+	switch opts.KeyType {
+	case "", apiKeyTypeSecret:
+		if len(opts.AllowedOrigins) > 0 {
+			return fmt.Errorf("allowed_origins hanya berlaku untuk kunci bertipe '%s'", apiKeyTypePublishable)
+		}
+	case apiKeyTypePublishable:
+		if len(opts.AllowedOrigins) == 0 {
+			return fmt.Errorf("kunci bertipe '%s' membutuhkan minimal satu allowed_origins", apiKeyTypePublishable)
+		}
+	default:
+		return fmt.Errorf("key_type harus '%s' atau '%s'", apiKeyTypeSecret, apiKeyTypePublishable)
+	}
+	if opts.Environment != "" && !isAPIKeyEnvironment(opts.Environment) {
+		return fmt.Errorf("environment harus '%s' atau '%s'", apiKeyEnvironmentLive, apiKeyEnvironmentTest)
+	}
+	for _, origin := range opts.AllowedOrigins {
+		if err := validateOriginPattern(origin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseRoutePattern memecah pola "METHOD /path" menjadi method dan pola path.
+// Method "*" berarti semua method. Path mendukung wildcard path.Match ("*" untuk satu segmen)
+// dan akhiran "/**" untuk semua sub-path.
+func parseRoutePattern(route string) (string, string, error) {
+	parts := strings.Fields(route)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("pola rute '%s' tidak valid (format: \"METHOD /path\")", route)
+	}
+	method, pathPattern := strings.ToUpper(parts[0]), parts[1]
+	if !strings.HasPrefix(pathPattern, "/") {
+		return "", "", fmt.Errorf("pola rute '%s' tidak valid (path harus diawali '/')", route)
+	}
+	if _, err := path.Match(strings.TrimSuffix(pathPattern, "/**"), "/"); err != nil {
+		return "", "", fmt.Errorf("pola rute '%s' tidak valid: %w", route, err)
+	}
+	return method, pathPattern, nil
+}
+
+// parseCIDR membaca CIDR IPv4 atau IPv6. Alamat tunggal tanpa panjang prefix dianggap /32 atau /128.
+func parseCIDR(cidr string) (netip.Prefix, error) {
+	if !strings.Contains(cidr, "/") {
+		addr, err := netip.ParseAddr(cidr)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("CIDR '%s' tidak valid", cidr)
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("CIDR '%s' tidak valid", cidr)
+	}
+	if prefix.Addr().Is4In6() {
+		// "::ffff:203.0.113.0/120" disamakan dengan "203.0.113.0/24"
+		if prefix.Bits() < 96 {
+			return netip.Prefix{}, fmt.Errorf("CIDR '%s' tidak valid", cidr)
+		}
+		return netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96).Masked(), nil
+	}
+	return prefix.Masked(), nil
+}
+
+// ipAllowed memeriksa apakah alamat klien berada di salah satu AllowedCIDRs.
+// Daftar kosong berarti tidak ada pembatasan alamat.
+func ipAllowed(allowedCIDRs []string, ip netip.Addr) bool {
+	if len(allowedCIDRs) == 0 {
+		return true
+	}
+	ip = ip.Unmap()
+	for _, cidr := range allowedCIDRs {
+		prefix, err := parseCIDR(cidr)
+		if err != nil {
+			continue // CIDR sudah divalidasi saat disimpan
+		}
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateOriginPattern memeriksa pola origin: host huruf kecil dengan port opsional, dan awalan "*."
+// opsional untuk semua subdomain (misalnya "app.contoh.com", "*.contoh.com", "localhost:3000").
+func validateOriginPattern(pattern string) error {
+	if strings.Contains(pattern, "/") {
+		return fmt.Errorf("origin '%s' tidak valid: gunakan host tanpa skema atau path", pattern)
+	}
+	host := strings.TrimPrefix(pattern, "*.")
+	if h, port, ok := strings.Cut(host, ":"); ok {
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			return fmt.Errorf("origin '%s' tidak valid: port salah", pattern)
+		}
+		host = h
+	}
+	if host == "" || strings.Contains(host, "*") {
+		return fmt.Errorf("origin '%s' tidak valid: wildcard hanya boleh berupa awalan '*.'", pattern)
+	}
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || strings.Trim(label, "abcdefghijklmnopqrstuvwxyz0123456789-") != "" {
+			return fmt.Errorf("origin '%s' tidak valid: gunakan host huruf kecil tanpa skema atau path", pattern)
+		}
+	}
+	return nil
+}
+
+// originAllowed memeriksa apakah host origin request (host[:port] dari header Origin atau Referer)
+// cocok dengan salah satu pola AllowedOrigins. Pola "*.contoh.com" cocok dengan semua subdomain
+// contoh.com, tetapi tidak dengan contoh.com sendiri. Pola tanpa port hanya cocok dengan origin tanpa port.
+func originAllowed(allowedOrigins []string, host string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range allowedOrigins {
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			sub, found := strings.CutSuffix(host, "."+suffix)
+			if found && sub != "" {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// routeAllowed memeriksa apakah method dan path request cocok dengan salah satu pola AllowedRoutes.
+// Daftar kosong berarti tidak ada pembatasan rute.
+func routeAllowed(allowedRoutes []string, method, requestPath string) bool {
+	if len(allowedRoutes) == 0 {
+		return true
+	}
+	for _, route := range allowedRoutes {
+		routeMethod, pathPattern, err := parseRoutePattern(route)
+		if err != nil {
+			continue
+		}
+		if routeMethod != "*" && routeMethod != method {
+			continue
+		}
+		if prefix, ok := strings.CutSuffix(pathPattern, "/**"); ok {
+			if requestPath == prefix || strings.HasPrefix(requestPath, prefix+"/") {
+				return true
+			}
+			continue
+		}
+		if matched, _ := path.Match(pathPattern, requestPath); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// hasScope memeriksa apakah daftar scope yang dimiliki kunci memenuhi scope yang dibutuhkan.
+// Mendukung "*" (semua scope) dan wildcard sumber daya seperti "reports:*".
+func hasScope(granted []string, required string) bool {
+	for _, scope := range granted {
+		if scope == required || scope == "*" {
+			return true
+		}
+		if resource, ok := strings.CutSuffix(scope, ":*"); ok && strings.HasPrefix(required, resource+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// splitScopes mengubah nilai kolom scopes (dipisahkan koma) menjadi slice.
+func splitScopes(raw string) []string {
+	var scopes []string
+	for _, scope := range strings.Split(raw, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// dbExecutor dipenuhi oleh *sql.DB maupun *sql.Tx, sehingga fungsi penyimpanan bisa dipakai di dalam transaksi.
+type dbExecutor interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// rowScanner dipenuhi oleh *sql.Row maupun *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// apiKeySelectColumns adalah daftar kolom yang dibaca oleh scanAPIKey, dengan urutan yang sama.
+const apiKeySelectColumns = "id, client_id, client_name, key_prefix, api_key_hash, hash_version, is_active, created_at, last_used_at, scopes, allowed_routes, allowed_cidrs, replaced_by_id, deactivate_at, expires_at, rate_limit_per_minute, monthly_quota, quota_enforcement, key_type, allowed_origins, environment, signing_secret_enc"
+
+// clientNotSuspendedCondition menyaring kunci milik klien yang ditangguhkan. Dipakai saat validasi agar kunci
+// tersebut ditolak meskipun is_active-nya masih TRUE, dan saat mengaktifkan ulang kunci.
+// Membutuhkan satu argumen clientStatusSuspended.
+const clientNotSuspendedCondition = "NOT EXISTS (SELECT 1 FROM api_clients WHERE api_clients.id = api_keys.client_id AND api_clients.status = ?)"
+
+// scanAPIKey membaca satu baris api_keys (dengan kolom apiKeySelectColumns) ke APIKeyRecord.
+func scanAPIKey(row rowScanner) (*APIKeyRecord, error) {
+	var apiKeyRec APIKeyRecord
+	var lastUsed sql.NullTime // Variabel untuk menampung last_used_at
+	var scopes, allowedRoutes, allowedCIDRs, allowedOrigins sql.NullString
+	var replacedByID sql.NullInt64
+	var deactivateAt, expiresAt sql.NullTime
+	var rateLimitPerMinute, monthlyQuota sql.NullInt64
+
+	err := row.Scan(
+		&apiKeyRec.ID,
+		&apiKeyRec.ClientID,
+		&apiKeyRec.ClientName,
+		&apiKeyRec.KeyPrefix,
+		&apiKeyRec.APIKeyHash, // Dipakai untuk upgrade hash format lama dan invalidasi cache
+		&apiKeyRec.HashVersion,
+		&apiKeyRec.IsActive,
+		&apiKeyRec.CreatedAt,
+		&lastUsed, // Scan ke sql.NullTime
+		&scopes,
+		&allowedRoutes,
+		&allowedCIDRs,
+		&replacedByID,
+		&deactivateAt,
+		&expiresAt,
+		&rateLimitPerMinute,
+		&monthlyQuota,
+		&apiKeyRec.QuotaEnforcement,
+		&apiKeyRec.KeyType,
+		&allowedOrigins,
+		&apiKeyRec.Environment,
+		&apiKeyRec.SigningSecretEnc,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if lastUsed.Valid {
+		apiKeyRec.LastUsedAt = &lastUsed.Time // Tetapkan nilai yang discan
+	}
+	apiKeyRec.Scopes = splitScopes(scopes.String)
+	if apiKeyRec.AllowedRoutes, err = decodeJSONList(allowedRoutes); err != nil {
+		return nil, fmt.Errorf("allowed_routes untuk API Key ID %d rusak: %w", apiKeyRec.ID, err)
+	}
+	if apiKeyRec.AllowedCIDRs, err = decodeJSONList(allowedCIDRs); err != nil {
+		return nil, fmt.Errorf("allowed_cidrs untuk API Key ID %d rusak: %w", apiKeyRec.ID, err)
+	}
+	if apiKeyRec.AllowedOrigins, err = decodeJSONList(allowedOrigins); err != nil {
+		return nil, fmt.Errorf("allowed_origins untuk API Key ID %d rusak: %w", apiKeyRec.ID, err)
+	}
+	if replacedByID.Valid {
+		apiKeyRec.ReplacedByID = &replacedByID.Int64
+	}
+	if deactivateAt.Valid {
+		apiKeyRec.DeactivateAt = &deactivateAt.Time
+	}
+	if expiresAt.Valid {
+		apiKeyRec.ExpiresAt = &expiresAt.Time
+	}
+	if rateLimitPerMinute.Valid {
+		limit := int(rateLimitPerMinute.Int64)
+		apiKeyRec.RateLimitPerMinute = &limit
+	}
+	if monthlyQuota.Valid {
+		apiKeyRec.MonthlyQuota = &monthlyQuota.Int64
+	}
+	return &apiKeyRec, nil
+}
+
+// encodeJSONList meng-encode daftar string sebagai JSON array untuk kolom TEXT. Daftar kosong disimpan sebagai NULL.
+func encodeJSONList(list []string) (sql.NullString, error) {
+	if len(list) == 0 {
+		return sql.NullString{}, nil
+	}
+	b, err := json.Marshal(list)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
+
+// decodeJSONList membaca kolom TEXT berisi JSON array string. NULL atau string kosong menghasilkan nil.
+func decodeJSONList(column sql.NullString) ([]string, error) {
+	if !column.Valid || column.String == "" {
+		return nil, nil
+	}
+	var list []string
+	if err := json.Unmarshal([]byte(column.String), &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// storeAPIKey menyimpan informasi klien beserta hash dari API Key ke database.
+// Mengembalikan APIKeyRecord tanpa hash.
+func storeAPIKey(clientName, apiKey, keyPrefixForDB string, opts APIKeyOptions) (APIKeyRecord, error) {
+	return storeAPIKeyWith(db, clientName, apiKey, keyPrefixForDB, opts)
+}
+
+// storeAPIKeyWith sama seperti storeAPIKey, tetapi memakai executor yang diberikan (misalnya transaksi).
+// Klien dengan nama clientName dibuat jika belum ada; klien yang ditangguhkan tidak bisa mendapat kunci baru.
+func storeAPIKeyWith(exec dbExecutor, clientName, apiKey, keyPrefixForDB string, opts APIKeyOptions) (APIKeyRecord, error) {
+	client, err := findOrCreateClient(exec, clientName)
+	if err != nil {
+		return APIKeyRecord{}, err
+	}
+
+	apiKeyHash := hashAPIKey(apiKey)
+	if opts.QuotaEnforcement == "" {
+		opts.QuotaEnforcement = quotaEnforcementHard
+	}
+	if opts.KeyType == "" {
+		opts.KeyType = apiKeyTypeSecret
+	}
+	if opts.Environment == "" {
+		opts.Environment = apiKeyEnvironmentLive
+	}
+
+	allowedRoutesJSON, err := encodeJSONList(opts.AllowedRoutes)
+	if err != nil {
+		return APIKeyRecord{}, fmt.Errorf("gagal meng-encode allowed_routes: %w", err)
+	}
+	allowedCIDRsJSON, err := encodeJSONList(opts.AllowedCIDRs)
+	if err != nil {
+		return APIKeyRecord{}, fmt.Errorf("gagal meng-encode allowed_cidrs: %w", err)
+	}
+	allowedOriginsJSON, err := encodeJSONList(opts.AllowedOrigins)
+	if err != nil {
+		return APIKeyRecord{}, fmt.Errorf("gagal meng-encode allowed_origins: %w", err)
+	}
+
+	// Kunci publishable ditanam di kode front-end sehingga tidak mendapat signing secret
+	var signingSecret string
+	var signingSecretEnc []byte
+	if opts.KeyType != apiKeyTypePublishable {
+		if signingSecret, signingSecretEnc, err = newSigningSecret(keyPrefixForDB); err != nil {
+			return APIKeyRecord{}, err
+		}
+	}
+
+	// Baris klien dibaca dengan shared lock di statement yang sama dengan INSERT, sehingga status dicek
+	// atomik: setClientSuspended (yang mengunci baris klien FOR UPDATE) menunggu INSERT ini selesai lalu ikut
+	// menonaktifkan kunci barunya, atau INSERT menunggu penangguhan selesai lalu tidak menyisipkan apa pun.
+	result, err := exec.Exec(
+		"INSERT INTO api_keys (client_id, client_name, key_prefix, api_key_hash, hash_version, is_active, scopes, allowed_routes, allowed_cidrs, expires_at, rate_limit_per_minute, monthly_quota, quota_enforcement, key_type, allowed_origins, environment, signing_secret_enc) "+
+			"SELECT id, name, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? FROM api_clients WHERE id = ? AND status = ? LOCK IN SHARE MODE",
+		keyPrefixForDB, apiKeyHash, currentAPIKeyHashVersion, true, strings.Join(opts.Scopes, ","), allowedRoutesJSON, allowedCIDRsJSON, opts.ExpiresAt, opts.RateLimitPerMinute, opts.MonthlyQuota, opts.QuotaEnforcement, opts.KeyType, allowedOriginsJSON, opts.Environment, signingSecretEnc,
+		client.ID, clientStatusActive,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "Duplicate entry") {
+			if strings.Contains(err.Error(), "'key_prefix'") {
+				return APIKeyRecord{}, fmt.Errorf("prefix kunci '%s' sudah digunakan, coba lagi: %w", keyPrefixForDB, err)
+			}
+			return APIKeyRecord{}, fmt.Errorf("hash kunci API sudah ada (kemungkinan tabrakan hash atau kunci duplikat): %w", err)
+		}
+		return APIKeyRecord{}, fmt.Errorf("gagal menyimpan API Key: %w", err)
+	}
+	if inserted, err := result.RowsAffected(); err != nil {
+		return APIKeyRecord{}, fmt.Errorf("gagal memeriksa hasil penyimpanan API Key: %w", err)
+	} else if inserted == 0 {
+		return APIKeyRecord{}, fmt.Errorf("tidak dapat membuat API Key untuk klien '%s': %w", client.Name, errClientSuspended)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return APIKeyRecord{}, fmt.Errorf("gagal mendapatkan ID terakhir yang dimasukkan: %w", err)
+	}
+
+	return APIKeyRecord{
+		ID:                 id,
+		ClientID:           &client.ID,
+		ClientName:         client.Name,
+		KeyPrefix:          keyPrefixForDB,
+		APIKeyHash:         apiKeyHash,
+		HashVersion:        currentAPIKeyHashVersion,
+		IsActive:           true,
+		CreatedAt:          time.Now(), // Waktu saat ini
+		Scopes:             opts.Scopes,
+		AllowedRoutes:      opts.AllowedRoutes,
+		AllowedCIDRs:       opts.AllowedCIDRs,
+		ExpiresAt:          opts.ExpiresAt,
+		RateLimitPerMinute: opts.RateLimitPerMinute,
+		MonthlyQuota:       opts.MonthlyQuota,
+		QuotaEnforcement:   opts.QuotaEnforcement,
+		KeyType:            opts.KeyType,
+		Environment:        opts.Environment,
+		AllowedOrigins:     opts.AllowedOrigins,
+		SigningSecretEnc:   signingSecretEnc,
+		SigningSecret:      signingSecret,
+	}, nil
+}
+
+// createAPIKey menghasilkan API Key baru dan menyimpannya, dengan beberapa percobaan ulang
+// untuk menangani kemungkinan tabrakan prefix yang sangat jarang terjadi.
+// Mengembalikan API Key mentah beserta record yang tersimpan.
+func createAPIKey(exec dbExecutor, clientName string, opts APIKeyOptions) (string, APIKeyRecord, error) {
+	const maxRetries = 3
+	var lastErr error
+	if opts.Environment == "" {
+		opts.Environment = apiKeyEnvironmentLive
+	}
+	for i := 0; i < maxRetries; i++ {
+		rawAPIKey, keyPrefixForDB, err := generateAPIKey(opts.Environment)
+		if err != nil {
+			return "", APIKeyRecord{}, err
+		}
+		storedRecord, err := storeAPIKeyWith(exec, clientName, rawAPIKey, keyPrefixForDB, opts)
+		if err == nil {
+			return rawAPIKey, storedRecord, nil
+		}
+		if !strings.Contains(err.Error(), "prefix kunci") {
+			return "", APIKeyRecord{}, err
+		}
+		log.Printf("Tabrakan prefix kunci, mencoba generate ulang (%d/%d)...", i+1, maxRetries)
+		lastErr = err
+	}
+	return "", APIKeyRecord{}, fmt.Errorf("gagal menyimpan API Key setelah %d percobaan: %w", maxRetries, lastErr)
+}
+
+// --- Cache Validasi API Key ---
+
+// apiKeyCacheEntry adalah satu entri cache. rec nil berarti hasil negatif (hash tidak dikenal atau kunci tidak aktif).
+type apiKeyCacheEntry struct {
+	hash      string
+	rec       *APIKeyRecord
+	expiresAt time.Time
+}
+
+// apiKeyCache adalah cache LRU berbatas dengan TTL, dari hash API Key ke APIKeyRecord.
+type apiKeyCache struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	entries  map[string]*list.Element // Nilai elemen: *apiKeyCacheEntry
+	order    *list.List               // Depan = paling baru dipakai
+}
+
+func newAPIKeyCache(capacity int, ttl time.Duration) *apiKeyCache {
+	return &apiKeyCache{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get mengembalikan entri yang belum kedaluwarsa untuk hash, atau ok == false jika tidak ada.
+func (c *apiKeyCache) get(hash string, now time.Time) (*APIKeyRecord, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[hash]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*apiKeyCacheEntry)
+	if !now.Before(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, hash)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.rec, true
+}
+
+// set menyimpan entri untuk hash dan membuang entri yang paling lama tidak dipakai jika cache penuh.
+func (c *apiKeyCache) set(hash string, rec *APIKeyRecord, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &apiKeyCacheEntry{hash: hash, rec: rec, expiresAt: now.Add(c.ttl)}
+	if elem, ok := c.entries[hash]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[hash] = c.order.PushFront(entry)
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*apiKeyCacheEntry).hash)
+	}
+}
+
+// remove menghapus entri untuk hash, jika ada.
+func (c *apiKeyCache) remove(hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[hash]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, hash)
+	}
+}
+
+// Hasil positif dan negatif disimpan di cache terpisah agar banjir kunci acak yang tidak valid
+// tidak menggeser kunci aktif yang sering dipakai.
+var (
+	validAPIKeyCache   = newAPIKeyCache(apiKeyCacheCapacity, apiKeyCacheTTL)
+	invalidAPIKeyCache = newAPIKeyCache(apiKeyNegativeCacheCapacity, apiKeyNegativeCacheTTL)
+)
+
+// signingCacheKey adalah kunci cache untuk pencarian berdasarkan key_prefix pada mode tanda tangan HMAC.
+// Awalan "prefix:" mencegah bentrok dengan kunci cache berupa hash hex.
+func signingCacheKey(keyPrefix string) string {
+	return "prefix:" + keyPrefix
+}
+
+// invalidateAPIKeyCache menghapus hash dan prefix kunci dari kedua cache. Dipanggil setiap kali status kunci
+// diubah melalui server ini (pencabutan, pengaktifan kembali, rotasi). Perubahan dari proses lain
+// (misalnya perintah CLI atau SQL manual) baru terlihat setelah TTL cache habis.
+func invalidateAPIKeyCache(hash, keyPrefix string) {
+	validAPIKeyCache.remove(hash)
+	invalidAPIKeyCache.remove(hash)
+	validAPIKeyCache.remove(signingCacheKey(keyPrefix))
+	invalidAPIKeyCache.remove(signingCacheKey(keyPrefix))
+	publishableOrigins.invalidate() // Status kunci publishable ikut menentukan origin yang dijawab preflight
+}
+
+// publishableOriginSet menyimpan gabungan allowed_origins semua kunci publishable yang aktif, untuk menjawab
+// CORS preflight (yang dikirim browser tanpa API Key sehingga kuncinya belum diketahui).
+type publishableOriginSet struct {
+	mu       sync.Mutex
+	patterns []string
+	loadedAt time.Time
+}
+
+var publishableOrigins = &publishableOriginSet{}
+
+// allows melaporkan apakah host origin diizinkan oleh salah satu kunci publishable yang aktif.
+// Daftar dimuat ulang dari database setelah apiKeyCacheTTL atau setelah invalidate.
+func (s *publishableOriginSet) allows(host string, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.loadedAt.IsZero() || now.Sub(s.loadedAt) >= apiKeyCacheTTL {
+		patterns, err := loadPublishableOrigins()
+		if err != nil {
+			return false, err
+		}
+		s.patterns = patterns
+		s.loadedAt = now
+	}
+	return originAllowed(s.patterns, host), nil
+}
+
+func (s *publishableOriginSet) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loadedAt = time.Time{}
+}
+
+// loadPublishableOrigins mengambil allowed_origins dari semua kunci publishable yang aktif.
+func loadPublishableOrigins() ([]string, error) {
+	rows, err := db.Query("SELECT id, allowed_origins FROM api_keys WHERE key_type = ? AND is_active = TRUE", apiKeyTypePublishable)
+	if err != nil {
+		return nil, fmt.Errorf("gagal memuat origin kunci publishable: %w", err)
+	}
+	defer rows.Close()
+
+	var patterns []string
+	for rows.Next() {
+		var id int64
+		var origins sql.NullString
+		if err := rows.Scan(&id, &origins); err != nil {
+			return nil, fmt.Errorf("gagal membaca origin kunci publishable: %w", err)
+		}
+		list, err := decodeJSONList(origins)
+		if err != nil {
+			log.Printf("Peringatan: allowed_origins untuk API Key ID %d rusak: %v", id, err)
+			continue
+		}
+		patterns = append(patterns, list...)
+	}
+	return patterns, rows.Err()
+}
+
+// validateAPIKey memeriksa apakah API Key yang diberikan valid dan aktif.
+// Mengembalikan record APIKey jika valid, atau error jika tidak.
+func validateAPIKey(apiKeyFromHeader string) (*APIKeyRecord, error) {
+	if apiKeyFromHeader == "" {
+		return nil, fmt.Errorf("API Key tidak boleh kosong")
+	}
+
+	// Cache selalu dikunci dengan hash versi terbaru
+	candidates := apiKeyHashCandidates(apiKeyFromHeader)
+	apiKeyHash := candidates[0]
+	now := time.Now()
+
+	// Coba cache terlebih dahulu agar kunci yang sering dipakai tidak perlu query ke database
+	if _, ok := invalidAPIKeyCache.get(apiKeyHash, now); ok {
+		return nil, errAPIKeyInvalid
+	}
+	apiKeyRec, ok := validAPIKeyCache.get(apiKeyHash, now)
+	if !ok {
+		var err error
+		apiKeyRec, err = lookupAPIKeyByHash(apiKeyFromHeader, candidates)
+		if err != nil {
+			if errors.Is(err, errAPIKeyInvalid) {
+				invalidAPIKeyCache.set(apiKeyHash, nil, now)
+			}
+			return nil, err
+		}
+		// Hanya record yang hash tersimpannya sama dengan kunci cache yang di-cache, agar
+		// invalidateAPIKeyCache(rec.APIKeyHash, ...) selalu mengenai entri yang benar
+		if apiKeyRec.APIKeyHash == apiKeyHash {
+			validAPIKeyCache.set(apiKeyHash, apiKeyRec, now)
+		}
+	}
+
+	return checkAPIKeyLifetime(apiKeyRec, now)
+}
+
+// checkAPIKeyLifetime memeriksa masa tenggang rotasi dan kedaluwarsa record yang ditemukan (dari cache atau
+// database), lalu mengembalikan salinannya agar handler tidak mengubah entri yang dibagi di cache.
+func checkAPIKeyLifetime(apiKeyRec *APIKeyRecord, now time.Time) (*APIKeyRecord, error) {
+	recCopy := *apiKeyRec
+
+	// Waktu diperiksa di sini (bukan di SQL) agar berlaku juga untuk hasil dari cache.
+	// Kunci lama yang sedang dalam masa tenggang rotasi tetap valid sampai deactivate_at terlewati.
+	if recCopy.DeactivateAt != nil && !now.Before(*recCopy.DeactivateAt) {
+		return nil, errAPIKeyInvalid
+	}
+	// Kedaluwarsa diperiksa terpisah agar pemanggil mendapat error yang berbeda
+	if recCopy.ExpiresAt != nil && !now.Before(*recCopy.ExpiresAt) {
+		return &recCopy, errAPIKeyExpired
+	}
+
+	return &recCopy, nil
+}
+
+// lookupActiveAPIKeyByPrefix mencari kunci aktif berdasarkan key_prefix (key ID pada mode tanda tangan HMAC),
+// memakai cache yang sama dengan validateAPIKey.
+func lookupActiveAPIKeyByPrefix(keyPrefix string) (*APIKeyRecord, error) {
+	cacheKey := signingCacheKey(keyPrefix)
+	now := time.Now()
+	if _, ok := invalidAPIKeyCache.get(cacheKey, now); ok {
+		return nil, errAPIKeyInvalid
+	}
+	apiKeyRec, ok := validAPIKeyCache.get(cacheKey, now)
+	if !ok {
+		var err error
+		apiKeyRec, err = scanAPIKey(db.QueryRow("SELECT "+apiKeySelectColumns+" FROM api_keys WHERE key_prefix = ? AND is_active = TRUE AND "+clientNotSuspendedCondition, keyPrefix, clientStatusSuspended))
+		if err != nil {
+			if err == sql.ErrNoRows {
+				invalidAPIKeyCache.set(cacheKey, nil, now)
+				return nil, errAPIKeyInvalid
+			}
+			return nil, fmt.Errorf("error saat memvalidasi API Key: %w", err)
+		}
+		validAPIKeyCache.set(cacheKey, apiKeyRec, now)
+	}
+	return checkAPIKeyLifetime(apiKeyRec, now)
+}
+
+// lookupAPIKeyByHash mencari kunci aktif dengan salah satu hash kandidat dan memastikan hash tersebut sesuai
+// dengan hash_version baris yang ditemukan. Hash format lama di-upgrade ke versi terbaru.
+func lookupAPIKeyByHash(apiKey string, candidates []string) (*APIKeyRecord, error) {
+	rec, err := findAPIKeyByRawKey(apiKey, candidates, true)
+	if err != nil {
+		return nil, err
+	}
+	if rec.HashVersion != currentAPIKeyHashVersion {
+		newHash := hashAPIKey(apiKey)
+		if err := upgradeAPIKeyHash(rec, newHash); err != nil {
+			log.Printf("Peringatan: %v", err)
+		} else {
+			log.Printf("Hash API Key dengan prefix '%s' di-upgrade dari versi %d ke versi %d.", rec.KeyPrefix, rec.HashVersion, currentAPIKeyHashVersion)
+			rec.APIKeyHash = newHash
+			rec.HashVersion = currentAPIKeyHashVersion
+		}
+	}
+	return rec, nil
+}
+
+// findAPIKeyByRawKey mencari kunci yang hash tersimpannya (menurut hash_version baris tersebut) cocok dengan
+// API Key mentah. activeOnly membatasi pencarian ke kunci aktif. Mengembalikan errAPIKeyInvalid jika tidak ada.
+func findAPIKeyByRawKey(apiKey string, candidates []string, activeOnly bool) (*APIKeyRecord, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(candidates)), ", ")
+	args := make([]any, len(candidates))
+	for i, hash := range candidates {
+		args[i] = hash
+	}
+	query := "SELECT " + apiKeySelectColumns + " FROM api_keys WHERE api_key_hash IN (" + placeholders + ")"
+	if activeOnly {
+		query += " AND is_active = TRUE AND " + clientNotSuspendedCondition
+		args = append(args, clientStatusSuspended)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error saat memvalidasi API Key: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rec, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error saat memvalidasi API Key: %w", err)
+		}
+		expected, err := hashAPIKeyVersion(apiKey, rec.HashVersion)
+		if err != nil {
+			log.Printf("Peringatan: API Key ID %d tidak dapat diverifikasi: %v", rec.ID, err)
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(rec.APIKeyHash)) != 1 {
+			continue // Hash cocok dengan kandidat dari versi lain, bukan versi baris ini
+		}
+		return rec, nil
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error saat memvalidasi API Key: %w", err)
+	}
+	return nil, errAPIKeyInvalid
+}
+
+// findAPIKeyByPrefix mencari API Key berdasarkan key_prefix, tanpa memandang status aktifnya.
+func findAPIKeyByPrefix(keyPrefix string) (*APIKeyRecord, error) {
+	row := db.QueryRow("SELECT "+apiKeySelectColumns+" FROM api_keys WHERE key_prefix = ?", keyPrefix)
+	apiKeyRec, err := scanAPIKey(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("API Key dengan prefix '%s' tidak ditemukan", keyPrefix)
+		}
+		return nil, fmt.Errorf("error mencari API Key: %w", err)
+	}
+	return apiKeyRec, nil
+}
+
+// rotateAPIKey menerbitkan kunci pengganti untuk klien yang sama (dengan scope dan rute yang sama),
+// lalu menandai kunci lama agar tetap valid selama masa tenggang sebelum dinonaktifkan otomatis.
+// Masa tenggang 0 menonaktifkan kunci lama seketika.
+// Mengembalikan API Key mentah yang baru, record kunci baru, dan record kunci lama yang sudah diperbarui.
+func rotateAPIKey(oldKeyID int64, gracePeriod time.Duration) (string, APIKeyRecord, *APIKeyRecord, error) {
+	if gracePeriod < 0 || gracePeriod > maxRotationGracePeriod {
+		return "", APIKeyRecord{}, nil, fmt.Errorf("masa tenggang harus antara 0 dan %s", maxRotationGracePeriod)
+	}
+
+	// Tulis pemakaian tertunda kunci lama saja agar jumlah request periode berjalan yang dipindahkan
+	// ke kunci baru akurat, tanpa menunggu flush seluruh antrean di dalam request ini
+	if err := apiKeyUsage.FlushKey(oldKeyID); err != nil {
+		log.Printf("Peringatan: Gagal menulis pemakaian tertunda API Key ID %d sebelum rotasi: %v", oldKeyID, err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", APIKeyRecord{}, nil, fmt.Errorf("gagal memulai transaksi: %w", err)
+	}
+	defer tx.Rollback() // Tidak berpengaruh jika transaksi sudah di-commit
+
+	// Kunci baris kunci lama agar dua rotasi bersamaan tidak menghasilkan dua pengganti
+	oldKey, err := scanAPIKey(tx.QueryRow("SELECT "+apiKeySelectColumns+" FROM api_keys WHERE id = ? FOR UPDATE", oldKeyID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", APIKeyRecord{}, nil, fmt.Errorf("API Key dengan ID %d tidak ditemukan", oldKeyID)
+		}
+		return "", APIKeyRecord{}, nil, fmt.Errorf("error membaca API Key lama: %w", err)
+	}
+	if !oldKey.IsActive {
+		return "", APIKeyRecord{}, nil, fmt.Errorf("API Key '%s' tidak aktif dan tidak dapat dirotasi", oldKey.KeyPrefix)
+	}
+	if oldKey.ReplacedByID != nil {
+		return "", APIKeyRecord{}, nil, fmt.Errorf("API Key '%s' sudah dirotasi sebelumnya", oldKey.KeyPrefix)
+	}
+
+	opts := APIKeyOptions{
+		Scopes:             oldKey.Scopes,
+		AllowedRoutes:      oldKey.AllowedRoutes,
+		AllowedCIDRs:       oldKey.AllowedCIDRs,
+		RateLimitPerMinute: oldKey.RateLimitPerMinute,
+		MonthlyQuota:       oldKey.MonthlyQuota,
+		QuotaEnforcement:   oldKey.QuotaEnforcement,
+		KeyType:            oldKey.KeyType,
+		Environment:        oldKey.Environment,
+		AllowedOrigins:     oldKey.AllowedOrigins,
+	}
+	if oldKey.ExpiresAt != nil {
+		// Kunci pengganti mendapat masa berlaku yang sama panjangnya dengan kunci lama, dihitung dari sekarang
+		expiresAt := time.Now().Add(oldKey.ExpiresAt.Sub(oldKey.CreatedAt))
+		opts.ExpiresAt = &expiresAt
+	}
+	rawAPIKey, newKey, err := createAPIKey(tx, oldKey.ClientName, opts)
+	if err != nil {
+		return "", APIKeyRecord{}, nil, err
+	}
+
+	// deactivate_at dihitung oleh MySQL agar konsisten dengan CURRENT_TIMESTAMP di validateAPIKey
+	if gracePeriod == 0 {
+		_, err = tx.Exec("UPDATE api_keys SET replaced_by_id = ?, deactivate_at = CURRENT_TIMESTAMP, is_active = FALSE WHERE id = ?", newKey.ID, oldKey.ID)
+	} else {
+		_, err = tx.Exec("UPDATE api_keys SET replaced_by_id = ?, deactivate_at = DATE_ADD(CURRENT_TIMESTAMP, INTERVAL ? SECOND) WHERE id = ?", newKey.ID, int64(gracePeriod.Seconds()), oldKey.ID)
+	}
+	if err != nil {
+		return "", APIKeyRecord{}, nil, fmt.Errorf("gagal memperbarui API Key lama: %w", err)
+	}
+
+	// Pemakaian periode berjalan ikut dipindahkan ke kunci baru agar rotasi tidak mereset kuota bulanan
+	period, _ := billingPeriod(time.Now())
+	_, err = tx.Exec(
+		"INSERT INTO api_key_usage_periods (api_key_id, period, request_count) SELECT ?, period, request_count FROM api_key_usage_periods WHERE api_key_id = ? AND period = ?",
+		newKey.ID, oldKey.ID, period,
+	)
+	if err != nil {
+		return "", APIKeyRecord{}, nil, fmt.Errorf("gagal memindahkan pemakaian kuota ke API Key baru: %w", err)
+	}
+
+	oldKey, err = scanAPIKey(tx.QueryRow("SELECT "+apiKeySelectColumns+" FROM api_keys WHERE id = ?", oldKey.ID))
+	if err != nil {
+		return "", APIKeyRecord{}, nil, fmt.Errorf("error membaca ulang API Key lama: %w", err)
+	}
+
+	data := keyEventData(oldKey)
+	data["new_key_prefix"] = newKey.KeyPrefix
+	data["old_key_deactivate_at"] = oldKey.DeactivateAt
+	if err := enqueueWebhookEvent(tx, oldKey.ClientID, webhookEventKeyRotated, data); err != nil {
+		return "", APIKeyRecord{}, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", APIKeyRecord{}, nil, fmt.Errorf("gagal menyimpan rotasi API Key: %w", err)
+	}
+	// Entri cache kunci lama masih memuat deactivate_at yang lama
+	invalidateAPIKeyCache(oldKey.APIKeyHash, oldKey.KeyPrefix)
+	return rawAPIKey, newKey, oldKey, nil
+}
+
+// deactivateExpiredGraceKeys menonaktifkan kunci hasil rotasi yang masa tenggangnya sudah habis.
+// Mengembalikan jumlah kunci yang dinonaktifkan.
+func deactivateExpiredGraceKeys() (int64, error) {
+	result, err := db.Exec("UPDATE api_keys SET is_active = FALSE WHERE is_active = TRUE AND deactivate_at IS NOT NULL AND deactivate_at <= CURRENT_TIMESTAMP")
+	if err != nil {
+		return 0, fmt.Errorf("gagal menonaktifkan kunci yang masa tenggangnya habis: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// startKeyDeactivationJob menjalankan deactivateExpiredGraceKeys secara berkala di background.
+func startKeyDeactivationJob(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, err := deactivateExpiredGraceKeys()
+			if err != nil {
+				log.Printf("Peringatan: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("%d API Key dinonaktifkan karena masa tenggang rotasi telah habis.", n)
+			}
+		}
+	}()
+}
+
+// APIKeyFilter berisi kriteria opsional untuk listAPIKeys.
+type APIKeyFilter struct {
+	ClientName string // Pencocokan sebagian (LIKE) pada client_name
+	ClientID   int64  // 0 berarti semua klien
+	KeyPrefix  string // Pencocokan awalan pada key_prefix
+	Active     *bool  // nil berarti semua status
+	Limit      int
+	Offset     int
+}
+
+// listAPIKeys mengambil daftar API Key sesuai filter, diurutkan dari yang terbaru.
+func listAPIKeys(filter APIKeyFilter) ([]APIKeyRecord, error) {
+	query := "SELECT " + apiKeySelectColumns + " FROM api_keys WHERE 1 = 1"
+	var args []any
+	if filter.ClientName != "" {
+		query += " AND client_name LIKE ?"
+		args = append(args, "%"+escapeLike(filter.ClientName)+"%")
+	}
+	if filter.ClientID != 0 {
+		query += " AND client_id = ?"
+		args = append(args, filter.ClientID)
+	}
+	if filter.KeyPrefix != "" {
+		query += " AND key_prefix LIKE ?"
+		args = append(args, escapeLike(filter.KeyPrefix)+"%")
+	}
+	if filter.Active != nil {
+		query += " AND is_active = ?"
+		args = append(args, *filter.Active)
+	}
+	query += " ORDER BY id DESC LIMIT ? OFFSET ?"
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error mengambil daftar API Key: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []APIKeyRecord{}
+	for rows.Next() {
+		rec, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error membaca API Key: %w", err)
+		}
+		keys = append(keys, *rec)
+	}
+	return keys, rows.Err()
+}
+
+// escapeLike meng-escape karakter wildcard LIKE agar input pengguna dicocokkan secara literal.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// setAPIKeyActive mengaktifkan atau mencabut (menonaktifkan) API Key berdasarkan key_prefix.
+// Saat diaktifkan kembali, deactivate_at dikosongkan agar kunci tidak langsung dinonaktifkan lagi
+// oleh job masa tenggang rotasi. Kunci milik klien yang ditangguhkan tidak bisa diaktifkan kembali,
+// dan kunci yang dicabut tidak ikut aktif lagi saat penangguhan kliennya dicabut.
+func setAPIKeyActive(keyPrefix string, active bool) (*APIKeyRecord, error) {
+	previous, err := findAPIKeyByPrefix(keyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if active {
+		_, err = db.Exec(
+			"UPDATE api_keys SET is_active = TRUE, deactivate_at = NULL WHERE key_prefix = ? AND "+clientNotSuspendedCondition,
+			keyPrefix, clientStatusSuspended,
+		)
+	} else {
+		_, err = db.Exec("UPDATE api_keys SET is_active = FALSE, suspended_with_client = FALSE WHERE key_prefix = ?", keyPrefix)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("gagal memperbarui status API Key: %w", err)
+	}
+	rec, err := findAPIKeyByPrefix(keyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if active && !rec.IsActive {
+		return nil, fmt.Errorf("API Key '%s' tidak dapat diaktifkan kembali: %w", keyPrefix, errClientSuspended)
+	}
+	invalidateAPIKeyCache(rec.APIKeyHash, rec.KeyPrefix)
+	if previous.IsActive && !rec.IsActive {
+		notifyKeyEvent(rec, webhookEventKeyRevoked, map[string]interface{}{"reason": "revoked"})
+	}
+	return rec, nil
+}
+
+// setAPIKeyExpiry mengubah waktu kedaluwarsa API Key berdasarkan key_prefix. nil berarti kunci tidak
+// pernah kedaluwarsa.
+func setAPIKeyExpiry(keyPrefix string, expiresAt *time.Time) (*APIKeyRecord, error) {
+	// Masa berlaku baru berarti peringatan kedaluwarsa dikirim ulang saat waktunya tiba
+	if _, err := db.Exec("UPDATE api_keys SET expires_at = ?, expiry_notified_at = NULL WHERE key_prefix = ?", expiresAt, keyPrefix); err != nil {
+		return nil, fmt.Errorf("gagal memperbarui masa berlaku API Key: %w", err)
+	}
+	rec, err := findAPIKeyByPrefix(keyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	invalidateAPIKeyCache(rec.APIKeyHash, rec.KeyPrefix)
+	return rec, nil
+}
+
+// --- Klien API ---
+
+// APIClient adalah pemilik satu atau lebih API Key (tabel api_clients).
+type APIClient struct {
+	ID           int64             `json:"id"`
+	Name         string            `json:"name"`
+	ContactEmail string            `json:"contact_email"`
+	Status       string            `json:"status"` // clientStatusActive atau clientStatusSuspended
+	Metadata     map[string]string `json:"metadata"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+	SuspendedAt  *time.Time        `json:"suspended_at,omitempty"`
+}
+
+// clientSelectColumns adalah daftar kolom yang dibaca oleh scanClient, dengan urutan yang sama.
+const clientSelectColumns = "id, name, contact_email, status, metadata, created_at, updated_at, suspended_at"
+
+// scanClient membaca satu baris api_clients (dengan kolom clientSelectColumns) ke APIClient.
+func scanClient(row rowScanner) (*APIClient, error) {
+	var client APIClient
+	var metadata sql.NullString
+	var suspendedAt sql.NullTime
+	err := row.Scan(&client.ID, &client.Name, &client.ContactEmail, &client.Status, &metadata, &client.CreatedAt, &client.UpdatedAt, &suspendedAt)
+	if err != nil {
+		return nil, err
+	}
+	if suspendedAt.Valid {
+		client.SuspendedAt = &suspendedAt.Time
+	}
+	client.Metadata = map[string]string{}
+	if metadata.Valid && metadata.String != "" {
+		if err := json.Unmarshal([]byte(metadata.String), &client.Metadata); err != nil {
+			return nil, fmt.Errorf("metadata untuk klien ID %d rusak: %w", client.ID, err)
+		}
+	}
+	return &client, nil
+}
+
+// encodeClientMetadata mengubah metadata klien menjadi JSON untuk kolom metadata (NULL jika kosong).
+func encodeClientMetadata(metadata map[string]string) (sql.NullString, error) {
+	if len(metadata) == 0 {
+		return sql.NullString{}, nil
+	}
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("gagal meng-encode metadata: %w", err)
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
+
+// validateClientName memeriksa nama klien sebelum disimpan.
+func validateClientName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("nama klien tidak boleh kosong")
+	}
+	if len(name) > 255 {
+		return fmt.Errorf("nama klien maksimal 255 karakter")
+	}
+	return nil
+}
+
+// findClientByID mencari klien berdasarkan ID.
+func findClientByID(id int64) (*APIClient, error) {
+	client, err := scanClient(db.QueryRow("SELECT "+clientSelectColumns+" FROM api_clients WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("klien dengan ID %d tidak ditemukan", id)
+		}
+		return nil, fmt.Errorf("error mencari klien: %w", err)
+	}
+	return client, nil
+}
+
+// findOrCreateClient mengembalikan klien dengan nama yang diberikan, dan membuatnya jika belum ada.
+// Dipakai saat membuat API Key berdasarkan client_name, sehingga kunci-kunci dengan nama klien yang sama
+// selalu menjadi milik satu klien.
+func findOrCreateClient(exec dbExecutor, name string) (*APIClient, error) {
+	if err := validateClientName(name); err != nil {
+		return nil, err
+	}
+	if _, err := exec.Exec("INSERT IGNORE INTO api_clients (name) VALUES (?)", name); err != nil {
+		return nil, fmt.Errorf("gagal membuat klien '%s': %w", name, err)
+	}
+	client, err := scanClient(exec.QueryRow("SELECT "+clientSelectColumns+" FROM api_clients WHERE name = ?", name))
+	if err != nil {
+		return nil, fmt.Errorf("gagal membaca klien '%s': %w", name, err)
+	}
+	return client, nil
+}
+
+// createClient membuat klien baru. Mengembalikan errClientExists jika namanya sudah dipakai.
+func createClient(name, contactEmail string, metadata map[string]string) (*APIClient, error) {
+	if err := validateClientName(name); err != nil {
+		return nil, err
+	}
+	metadataJSON, err := encodeClientMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+	result, err := db.Exec("INSERT INTO api_clients (name, contact_email, metadata) VALUES (?, ?, ?)", name, contactEmail, metadataJSON)
+	if err != nil {
+		if strings.Contains(err.Error(), "Duplicate entry") {
+			return nil, errClientExists
+		}
+		return nil, fmt.Errorf("gagal membuat klien: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("gagal mendapatkan ID klien baru: %w", err)
+	}
+	return findClientByID(id)
+}
+
+// ClientUpdate berisi perubahan opsional untuk updateClient; field nil tidak diubah.
+type ClientUpdate struct {
+	Name         *string
+	ContactEmail *string
+	Metadata     map[string]string // nil berarti tidak diubah, map kosong menghapus metadata
+}
+
+// updateClient mengubah nama, kontak, atau metadata klien. Nama baru juga disalin ke api_keys.client_name
+// di dalam transaksi yang sama agar tampilan kunci tetap konsisten.
+func updateClient(id int64, update ClientUpdate) (*APIClient, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("gagal memulai transaksi: %w", err)
+	}
+	defer tx.Rollback() // Tidak berpengaruh jika transaksi sudah di-commit
+
+	if _, err := scanClient(tx.QueryRow("SELECT "+clientSelectColumns+" FROM api_clients WHERE id = ? FOR UPDATE", id)); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("klien dengan ID %d tidak ditemukan", id)
+		}
+		return nil, fmt.Errorf("error mencari klien: %w", err)
+	}
+	if update.Name != nil {
+		if err := validateClientName(*update.Name); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec("UPDATE api_clients SET name = ? WHERE id = ?", *update.Name, id); err != nil {
+			if strings.Contains(err.Error(), "Duplicate entry") {
+				return nil, errClientExists
+			}
+			return nil, fmt.Errorf("gagal mengubah nama klien: %w", err)
+		}
+		if _, err := tx.Exec("UPDATE api_keys SET client_name = ? WHERE client_id = ?", *update.Name, id); err != nil {
+			return nil, fmt.Errorf("gagal menyalin nama klien ke API Key: %w", err)
+		}
+	}
+	if update.ContactEmail != nil {
+		if _, err := tx.Exec("UPDATE api_clients SET contact_email = ? WHERE id = ?", *update.ContactEmail, id); err != nil {
+			return nil, fmt.Errorf("gagal mengubah kontak klien: %w", err)
+		}
+	}
+	if update.Metadata != nil {
+		metadataJSON, err := encodeClientMetadata(update.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec("UPDATE api_clients SET metadata = ? WHERE id = ?", metadataJSON, id); err != nil {
+			return nil, fmt.Errorf("gagal mengubah metadata klien: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("gagal menyimpan perubahan klien: %w", err)
+	}
+	if update.Name != nil {
+		// Record kunci di cache masih memuat nama klien yang lama
+		invalidateClientKeysCache(id)
+	}
+	return findClientByID(id)
+}
+
+// ClientFilter berisi kriteria opsional untuk listClients.
+type ClientFilter struct {
+	Name   string // Pencocokan sebagian (LIKE) pada name
+	Status string // Kosong berarti semua status
+	Limit  int
+	Offset int
+}
+
+// listClients mengambil daftar klien sesuai filter, diurutkan berdasarkan nama.
+func listClients(filter ClientFilter) ([]APIClient, error) {
+	query := "SELECT " + clientSelectColumns + " FROM api_clients WHERE 1 = 1"
+	var args []any
+	if filter.Name != "" {
+		query += " AND name LIKE ?"
+		args = append(args, "%"+escapeLike(filter.Name)+"%")
+	}
+	if filter.Status != "" {
+		query += " AND status = ?"
+		args = append(args, filter.Status)
+	}
+	query += " ORDER BY name LIMIT ? OFFSET ?"
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error mengambil daftar klien: %w", err)
+	}
+	defer rows.Close()
+
+	clients := []APIClient{}
+	for rows.Next() {
+		client, err := scanClient(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error membaca klien: %w", err)
+		}
+		clients = append(clients, *client)
+	}
+	return clients, rows.Err()
+}
+
+// setClientSuspended menangguhkan klien beserta semua kunci aktifnya sekaligus, atau mencabut
+// penangguhannya. Kunci yang dinonaktifkan karena penangguhan ditandai suspended_with_client, sehingga
+// saat penangguhan dicabut hanya kunci tersebut yang aktif kembali (kunci yang dicabut sendiri-sendiri
+// atau yang masa tenggang rotasinya sudah habis tetap nonaktif).
+// Mengembalikan klien yang sudah diperbarui dan jumlah kunci yang statusnya berubah.
+func setClientSuspended(id int64, suspended bool) (*APIClient, int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, 0, fmt.Errorf("gagal memulai transaksi: %w", err)
+	}
+	defer tx.Rollback() // Tidak berpengaruh jika transaksi sudah di-commit
+
+	// Kunci baris klien secara eksklusif. storeAPIKeyWith membaca baris yang sama dengan shared lock di
+	// INSERT ... SELECT-nya, sehingga kunci baru tidak bisa lolos di antara perubahan status dan
+	// penonaktifan kunci di bawah
+	if _, err := scanClient(tx.QueryRow("SELECT "+clientSelectColumns+" FROM api_clients WHERE id = ? FOR UPDATE", id)); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, 0, fmt.Errorf("klien dengan ID %d tidak ditemukan", id)
+		}
+		return nil, 0, fmt.Errorf("error mencari klien: %w", err)
+	}
+
+	var result sql.Result
+	if suspended {
+		// Klien diberi tahu setiap kunci yang ikut dinonaktifkan (event dicatat di transaksi yang sama)
+		if err := enqueueSuspensionEvents(tx, id); err != nil {
+			return nil, 0, err
+		}
+		_, err = tx.Exec("UPDATE api_clients SET status = ?, suspended_at = COALESCE(suspended_at, CURRENT_TIMESTAMP) WHERE id = ?", clientStatusSuspended, id)
+		if err == nil {
+			result, err = tx.Exec("UPDATE api_keys SET is_active = FALSE, suspended_with_client = TRUE WHERE client_id = ? AND is_active = TRUE", id)
+		}
+	} else {
+		_, err = tx.Exec("UPDATE api_clients SET status = ?, suspended_at = NULL WHERE id = ?", clientStatusActive, id)
+		if err == nil {
+			result, err = tx.Exec(
+				"UPDATE api_keys SET is_active = TRUE WHERE client_id = ? AND suspended_with_client = TRUE AND (deactivate_at IS NULL OR deactivate_at > CURRENT_TIMESTAMP)",
+				id,
+			)
+		}
+		if err == nil {
+			_, err = tx.Exec("UPDATE api_keys SET suspended_with_client = FALSE WHERE client_id = ? AND suspended_with_client = TRUE", id)
+		}
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("gagal memperbarui status klien: %w", err)
+	}
+	affected, _ := result.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		return nil, 0, fmt.Errorf("gagal menyimpan status klien: %w", err)
+	}
+	invalidateClientKeysCache(id)
+	client, err := findClientByID(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	return client, affected, nil
+}
+
+// invalidateClientKeysCache menghapus entri cache validasi untuk semua kunci milik klien.
+func invalidateClientKeysCache(clientID int64) {
+	rows, err := db.Query("SELECT api_key_hash, key_prefix FROM api_keys WHERE client_id = ?", clientID)
+	if err != nil {
+		// Entri cache tetap kedaluwarsa sendiri setelah TTL habis
+		log.Printf("Peringatan: gagal membaca kunci klien ID %d untuk invalidasi cache: %v", clientID, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hash, prefix string
+		if err := rows.Scan(&hash, &prefix); err != nil {
+			log.Printf("Peringatan: gagal membaca kunci klien ID %d untuk invalidasi cache: %v", clientID, err)
+			return
+		}
+		invalidateAPIKeyCache(hash, prefix)
+	}
+}
+
+// --- Webhook Siklus Hidup API Key ---
+
+// ClientWebhook adalah URL milik klien yang menerima event siklus hidup API Key-nya.
+type ClientWebhook struct {
+	ID        int64     `json:"id"`
+	ClientID  int64     `json:"client_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"-"`      // Hanya ditampilkan sekali saat webhook dibuat
+	Events    []string  `json:"events"` // Kosong berarti semua event
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery adalah satu percobaan pengiriman event di log webhook_deliveries.
+type WebhookDelivery struct {
+	ID         int64     `json:"id"`
+	OutboxID   int64     `json:"event_id"`
+	EventType  string    `json:"event_type"`
+	Attempt    int       `json:"attempt"`
+	StatusCode *int      `json:"status_code"` // nil jika penerima tidak dapat dihubungi
+	Error      string    `json:"error,omitempty"`
+	DurationMS int       `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+	EventState string    `json:"event_status"` // Status event di outbox saat ini
+}
+
+// webhookEvent adalah body JSON yang dikirim ke penerima webhook.
+type webhookEvent struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	CreatedAt time.Time              `json:"created_at"`
+	ClientID  int64                  `json:"client_id"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// webhookJob adalah event outbox yang sedang dikirim beserta tujuan dan secret webhook-nya.
+type webhookJob struct {
+	outboxID  int64
+	webhookID int64
+	eventType string
+	payload   []byte
+	attempts  int // Jumlah percobaan sebelum percobaan ini
+	url       string
+	secret    string
+}
+
+// webhookHTTPClient dipakai untuk semua pengiriman webhook. Redirect tidak diikuti agar event tidak
+// terkirim ke tujuan lain selain URL yang didaftarkan. Alamat tujuan diperiksa lagi setelah DNS di-resolve
+// (webhookDialControl), sehingga host yang kemudian diarahkan ke alamat internal (DNS rebinding) tetap ditolak.
+// Proxy dari environment tidak dipakai karena koneksi ke proxy akan lolos dari pemeriksaan tersebut.
+var webhookHTTPClient = &http.Client{
+	Timeout: webhookTimeout,
+	Transport: &http.Transport{
+		DialContext:           (&net.Dialer{Timeout: webhookTimeout, Control: webhookDialControl}).DialContext,
+		TLSHandshakeTimeout:   webhookTimeout,
+		ResponseHeaderTimeout: webhookTimeout,
+		MaxIdleConnsPerHost:   2,
+		IdleConnTimeout:       90 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// webhookTargetAllowed melaporkan apakah addr boleh menjadi tujuan pengiriman webhook: hanya alamat
+// unicast publik, bukan loopback, link-local, privat (RFC 1918/ULA), multicast, atau webhookBlockedPrefixes.
+// Jika webhookAllowPrivateTargets aktif, loopback dan alamat privat juga diizinkan (link-local tetap ditolak
+// agar endpoint metadata cloud tidak terjangkau).
+func webhookTargetAllowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if webhookAllowPrivateTargets && (addr.IsLoopback() || addr.IsPrivate()) {
+		return true
+	}
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range webhookBlockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// loadWebhookTargetPolicy membaca WEBHOOK_ALLOW_PRIVATE_TARGETS (nilai boolean, misalnya "true") ke
+// webhookAllowPrivateTargets.
+func loadWebhookTargetPolicy() error {
+	env := os.Getenv("WEBHOOK_ALLOW_PRIVATE_TARGETS")
+	if env == "" {
+		return nil
+	}
+	allow, err := strconv.ParseBool(env)
+	if err != nil {
+		return fmt.Errorf("WEBHOOK_ALLOW_PRIVATE_TARGETS harus bernilai boolean (true/false): %w", err)
+	}
+	webhookAllowPrivateTargets = allow
+	return nil
+}
+
+// webhookDialControl menolak koneksi webhook ke alamat yang tidak lolos webhookTargetAllowed. Dipanggil
+// untuk setiap alamat hasil resolve DNS, tepat sebelum koneksi dibuka.
+func webhookDialControl(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("alamat tujuan webhook '%s' tidak valid: %w", address, err)
+	}
+	if !webhookTargetAllowed(addrPort.Addr()) {
+		return fmt.Errorf("%w (%s)", errWebhookTargetForbidden, addrPort.Addr())
+	}
+	return nil
+}
+
+// webhookMetrics diekspos melalui expvar (GET /admin/metrics).
+var webhookMetrics = expvar.NewMap("webhook_dispatcher")
+
+// isWebhookEventType memeriksa apakah eventType adalah event yang bisa dilanggan.
+func isWebhookEventType(eventType string) bool {
+	for _, t := range webhookEventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// validateWebhookURL memeriksa URL penerima webhook. Host di-resolve dan ditolak jika salah satu alamatnya
+// adalah alamat internal (lihat webhookTargetAllowed), agar webhook tidak bisa dipakai untuk menjangkau
+// layanan di jaringan server (SSRF). HTTP biasa diizinkan, tetapi gunakan HTTPS di produksi.
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("URL webhook harus berupa URL http(s) yang lengkap")
+	}
+	if len(raw) > 2048 {
+		return fmt.Errorf("URL webhook maksimal 2048 karakter")
+	}
+
+	host := u.Hostname()
+	var addrs []netip.Addr
+	if addr, err := netip.ParseAddr(host); err == nil {
+		addrs = []netip.Addr{addr}
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), webhookResolveTimeout)
+		defer cancel()
+		if addrs, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host); err != nil {
+			return fmt.Errorf("host URL webhook '%s' tidak dapat di-resolve", host)
+		}
+	}
+	for _, addr := range addrs {
+		if !webhookTargetAllowed(addr) {
+			return errWebhookTargetForbidden
+		}
+	}
+	return nil
+}
+
+// keyEventData berisi atribut kunci yang disertakan di setiap event API Key. API Key mentah dan hash-nya
+// tidak pernah dikirim.
+func keyEventData(rec *APIKeyRecord) map[string]interface{} {
+	return map[string]interface{}{
+		"key_prefix":  rec.KeyPrefix,
+		"client_name": rec.ClientName,
+		"environment": rec.Environment,
+		"key_type":    rec.KeyType,
+	}
+}
+
+// newWebhookPayload menyusun body JSON untuk satu event.
+func newWebhookPayload(clientID int64, eventType string, data map[string]interface{}) ([]byte, error) {
+	id, err := randomBase62(24)
+	if err != nil {
+		return nil, fmt.Errorf("gagal membuat ID event: %w", err)
+	}
+	payload, err := json.Marshal(webhookEvent{
+		ID:        "evt_" + id,
+		Type:      eventType,
+		CreatedAt: time.Now().UTC(),
+		ClientID:  clientID,
+		Data:      data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("gagal meng-encode event webhook: %w", err)
+	}
+	return payload, nil
+}
+
+// enqueueWebhookEvent mencatat event ke outbox untuk setiap webhook aktif milik klien yang melanggan
+// eventType. Jika exec adalah transaksi, event hanya tersimpan bila transaksi di-commit, sehingga event
+// selalu sesuai dengan perubahan datanya. clientID nil (kunci tanpa klien) tidak menghasilkan event.
+func enqueueWebhookEvent(exec dbExecutor, clientID *int64, eventType string, data map[string]interface{}) error {
+	if clientID == nil {
+		return nil
+	}
+	payload, err := newWebhookPayload(*clientID, eventType, data)
+	if err != nil {
+		return err
+	}
+	_, err = exec.Exec(
+		"INSERT INTO webhook_outbox (webhook_id, event_type, payload) SELECT id, ?, ? FROM api_client_webhooks WHERE client_id = ? AND is_active = TRUE AND (events IS NULL OR events = '' OR FIND_IN_SET(?, events) > 0)",
+		eventType, payload, *clientID, eventType,
+	)
+	if err != nil {
+		return fmt.Errorf("gagal mencatat event webhook %s: %w", eventType, err)
+	}
+	return nil
+}
+
+// notifyKeyEvent mencatat event untuk kunci di luar transaksi. Kegagalan hanya dicatat di log karena
+// perubahan pada kunci sudah tersimpan.
+func notifyKeyEvent(rec *APIKeyRecord, eventType string, extra map[string]interface{}) {
+	data := keyEventData(rec)
+	for k, v := range extra {
+		data[k] = v
+	}
+	if err := enqueueWebhookEvent(db, rec.ClientID, eventType, data); err != nil {
+		log.Printf("Peringatan: %v", err)
+	}
+}
+
+// enqueueSuspensionEvents mencatat event api_key.revoked untuk setiap kunci aktif klien yang akan
+// dinonaktifkan karena penangguhan. Harus dipanggil di dalam transaksi penangguhan, sebelum kunci diubah.
+func enqueueSuspensionEvents(tx *sql.Tx, clientID int64) error {
+	rows, err := tx.Query("SELECT "+apiKeySelectColumns+" FROM api_keys WHERE client_id = ? AND is_active = TRUE", clientID)
+	if err != nil {
+		return fmt.Errorf("gagal membaca kunci aktif klien: %w", err)
+	}
+	var keys []*APIKeyRecord
+	for rows.Next() {
+		rec, err := scanAPIKey(rows)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("gagal membaca kunci aktif klien: %w", err)
+		}
+		keys = append(keys, rec)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("gagal membaca kunci aktif klien: %w", err)
+	}
+	for _, rec := range keys {
+		data := keyEventData(rec)
+		data["reason"] = "client_suspended"
+		if err := enqueueWebhookEvent(tx, &clientID, webhookEventKeyRevoked, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// throttleNotifier membatasi event api_key.throttled agar klien yang terus-menerus terkena 429 tidak
+// membanjiri outbox: paling banyak satu event per kunci dan alasan setiap webhookThrottleNotifyInterval.
+type throttleNotifier struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+var throttleNotifications = &throttleNotifier{last: make(map[string]time.Time)}
+
+// notify mencatat event throttled untuk kunci jika belum ada event serupa dalam interval terakhir.
+// Event ditulis di background agar respons 429 tidak menunggu database.
+func (n *throttleNotifier) notify(rec *APIKeyRecord, reason string, now time.Time) {
+	if rec.ClientID == nil {
+		return
+	}
+	key := fmt.Sprintf("%d:%s", rec.ID, reason)
+	n.mu.Lock()
+	if last, ok := n.last[key]; ok && now.Sub(last) < webhookThrottleNotifyInterval {
+		n.mu.Unlock()
+		return
+	}
+	if len(n.last) >= apiKeyCacheCapacity {
+		for k, t := range n.last {
+			if now.Sub(t) >= webhookThrottleNotifyInterval {
+				delete(n.last, k)
+			}
+		}
+	}
+	n.last[key] = now
+	n.mu.Unlock()
+
+	// Salin data sekarang karena rec adalah record bersama dari cache validasi
+	clientID := *rec.ClientID
+	data := keyEventData(rec)
+	data["reason"] = reason
+	go func() {
+		if err := enqueueWebhookEvent(db, &clientID, webhookEventKeyThrottled, data); err != nil {
+			log.Printf("Peringatan: %v", err)
+		}
+	}()
+}
+
+// notifyExpiringKeys mencatat event api_key.expiring untuk kunci aktif yang kedaluwarsa dalam
+// apiKeyExpiryWarningDays hari dan belum pernah diberi tahu. Mengembalikan jumlah kunci yang diberi tahu.
+func notifyExpiringKeys() (int, error) {
+	rows, err := db.Query(
+		"SELECT "+apiKeySelectColumns+" FROM api_keys WHERE is_active = TRUE AND client_id IS NOT NULL AND expiry_notified_at IS NULL AND expires_at > CURRENT_TIMESTAMP AND expires_at <= DATE_ADD(CURRENT_TIMESTAMP, INTERVAL ? DAY)",
+		apiKeyExpiryWarningDays,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("gagal mencari kunci yang mendekati kedaluwarsa: %w", err)
+	}
+	var keys []*APIKeyRecord
+	for rows.Next() {
+		rec, err := scanAPIKey(rows)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("gagal membaca kunci yang mendekati kedaluwarsa: %w", err)
+		}
+		keys = append(keys, rec)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("gagal membaca kunci yang mendekati kedaluwarsa: %w", err)
+	}
+
+	notified := 0
+	for _, rec := range keys {
+		ok, err := notifyExpiringKey(rec)
+		if err != nil {
+			return notified, err
+		}
+		if ok {
+			notified++
+		}
+	}
+	return notified, nil
+}
+
+// notifyExpiringKey menandai kunci sudah diberi tahu dan mencatat event-nya dalam satu transaksi.
+// Jika proses lain sudah menandainya lebih dulu, tidak ada event yang dicatat.
+func notifyExpiringKey(rec *APIKeyRecord) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("gagal memulai transaksi: %w", err)
+	}
+	defer tx.Rollback() // Tidak berpengaruh jika transaksi sudah di-commit
+
+	result, err := tx.Exec("UPDATE api_keys SET expiry_notified_at = CURRENT_TIMESTAMP WHERE id = ? AND expiry_notified_at IS NULL", rec.ID)
+	if err != nil {
+		return false, fmt.Errorf("gagal menandai pemberitahuan kedaluwarsa: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	data := keyEventData(rec)
+	data["expires_at"] = rec.ExpiresAt
+	if err := enqueueWebhookEvent(tx, rec.ClientID, webhookEventKeyExpiring, data); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("gagal menyimpan pemberitahuan kedaluwarsa: %w", err)
+	}
+	return true, nil
+}
+
+// startKeyExpiryNotificationJob menjalankan notifyExpiringKeys secara berkala di background.
+func startKeyExpiryNotificationJob(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for ; ; <-ticker.C {
+			n, err := notifyExpiringKeys()
+			if err != nil {
+				log.Printf("Peringatan: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("Event %s dicatat untuk %d API Key.", webhookEventKeyExpiring, n)
+			}
+		}
+	}()
+}
+
+// signWebhookPayload menghasilkan nilai header tanda tangan untuk payload pada timestamp tertentu.
+// Penerima menghitung ulang HMAC yang sama dengan secret webhook-nya dan membandingkannya.
+func signWebhookPayload(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff mengembalikan jeda sebelum percobaan berikutnya setelah attempt kali gagal.
+func webhookBackoff(attempt int) time.Duration {
+	backoff := webhookBackoffBase
+	for i := 1; i < attempt && backoff < webhookBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > webhookBackoffMax {
+		return webhookBackoffMax
+	}
+	return backoff
+}
+
+// claimWebhookJobs mengambil event yang sudah waktunya dikirim dan menunda next_attempt_at-nya selama
+// webhookLease, sehingga event yang sedang dikirim tidak diambil lagi oleh proses lain. Jika proses mati
+// di tengah pengiriman, event otomatis diambil ulang setelah lease habis.
+func claimWebhookJobs(limit int) ([]webhookJob, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("gagal memulai transaksi: %w", err)
+	}
+	defer tx.Rollback() // Tidak berpengaruh jika transaksi sudah di-commit
+
+	rows, err := tx.Query(`
+        SELECT o.id, o.webhook_id, o.event_type, o.payload, o.attempts, w.client_id, w.url, w.secret_enc
+        FROM webhook_outbox o JOIN api_client_webhooks w ON w.id = o.webhook_id
+        WHERE o.status = 'pending' AND o.next_attempt_at <= CURRENT_TIMESTAMP
+        ORDER BY o.next_attempt_at, o.id
+        LIMIT ? FOR UPDATE`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("gagal mengambil event webhook: %w", err)
+	}
+	var jobs []webhookJob
+	var ids []string
+	for rows.Next() {
+		var job webhookJob
+		var clientID int64
+		var secretEnc []byte
+		if err := rows.Scan(&job.outboxID, &job.webhookID, &job.eventType, &job.payload, &job.attempts, &clientID, &job.url, &secretEnc); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("gagal membaca event webhook: %w", err)
+		}
+		if job.secret, err = openSecret(secretEnc, webhookSecretAD(clientID)); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("gagal mendekripsi secret webhook ID %d (API_KEY_SIGNING_KEY berbeda?): %w", job.webhookID, err)
+		}
+		jobs = append(jobs, job)
+		ids = append(ids, strconv.FormatInt(job.outboxID, 10))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("gagal membaca event webhook: %w", err)
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+
+	// ID berasal dari database (integer), jadi aman digabung langsung ke query
+	_, err = tx.Exec(
+		"UPDATE webhook_outbox SET next_attempt_at = DATE_ADD(CURRENT_TIMESTAMP, INTERVAL ? SECOND) WHERE id IN ("+strings.Join(ids, ", ")+")",
+		int64(webhookLease.Seconds()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("gagal mengklaim event webhook: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("gagal mengklaim event webhook: %w", err)
+	}
+	return jobs, nil
+}
+
+// deliverWebhook mengirim satu event ke penerimanya. Respons 2xx dianggap berhasil.
+// Mengembalikan status HTTP (0 jika penerima tidak dapat dihubungi).
+func deliverWebhook(client *http.Client, job webhookJob, now time.Time) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, job.url, bytes.NewReader(job.payload))
+	if err != nil {
+		return 0, fmt.Errorf("request webhook tidak valid: %w", err)
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "api-keys-webhook/1")
+	req.Header.Set(webhookIDHeader, strconv.FormatInt(job.outboxID, 10))
+	req.Header.Set(webhookEventHeader, job.eventType)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, signWebhookPayload(job.secret, timestamp, job.payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // Habiskan body agar koneksi bisa dipakai ulang
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("penerima membalas dengan status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// recordWebhookAttempt mencatat hasil satu percobaan ke log pengiriman dan memperbarui status event:
+// delivered jika berhasil, dijadwalkan ulang dengan backoff jika gagal, atau failed setelah
+// webhookMaxAttempts percobaan.
+func recordWebhookAttempt(job webhookJob, statusCode int, deliveryErr error, duration time.Duration) error {
+	attempt := job.attempts + 1
+	var code sql.NullInt64
+	if statusCode != 0 {
+		code = sql.NullInt64{Int64: int64(statusCode), Valid: true}
+	}
+	errText := ""
+	if deliveryErr != nil {
+		errText = truncate(deliveryErr.Error(), 1024)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("gagal memulai transaksi: %w", err)
+	}
+	defer tx.Rollback() // Tidak berpengaruh jika transaksi sudah di-commit
+
+	_, err = tx.Exec(
+		"INSERT INTO webhook_deliveries (outbox_id, webhook_id, attempt, status_code, error, duration_ms) VALUES (?, ?, ?, ?, ?, ?)",
+		job.outboxID, job.webhookID, attempt, code, errText, duration.Milliseconds(),
+	)
+	if err != nil {
+		return fmt.Errorf("gagal mencatat pengiriman webhook: %w", err)
+	}
+	switch {
+	case deliveryErr == nil:
+		_, err = tx.Exec("UPDATE webhook_outbox SET status = 'delivered', attempts = ?, last_error = NULL, delivered_at = CURRENT_TIMESTAMP WHERE id = ?", attempt, job.outboxID)
+	case attempt >= webhookMaxAttempts:
+		_, err = tx.Exec("UPDATE webhook_outbox SET status = 'failed', attempts = ?, last_error = ? WHERE id = ?", attempt, errText, job.outboxID)
+	default:
+		_, err = tx.Exec(
+			"UPDATE webhook_outbox SET attempts = ?, last_error = ?, next_attempt_at = DATE_ADD(CURRENT_TIMESTAMP, INTERVAL ? SECOND) WHERE id = ?",
+			attempt, errText, int64(webhookBackoff(attempt).Seconds()), job.outboxID,
+		)
+	}
+	if err != nil {
+		return fmt.Errorf("gagal memperbarui status event webhook: %w", err)
+	}
+	return tx.Commit()
+}
+
+// dispatchWebhooks mengirim satu batch event yang sudah waktunya secara paralel.
+// Mengembalikan jumlah event yang diproses.
+func dispatchWebhooks(client *http.Client) (int, error) {
+	jobs, err := claimWebhookJobs(webhookBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job webhookJob) {
+			defer wg.Done()
+			start := time.Now()
+			statusCode, deliveryErr := deliverWebhook(client, job, start)
+			if deliveryErr == nil {
+				webhookMetrics.Add("delivered", 1)
+			} else {
+				webhookMetrics.Add("failed_attempts", 1)
+				if job.attempts+1 >= webhookMaxAttempts {
+					webhookMetrics.Add("dead", 1)
+					log.Printf("Peringatan: Event webhook %d (%s) gagal permanen setelah %d percobaan: %v", job.outboxID, job.eventType, job.attempts+1, deliveryErr)
+				}
+			}
+			if err := recordWebhookAttempt(job, statusCode, deliveryErr, time.Since(start)); err != nil {
+				// Event akan diambil ulang setelah lease habis dan mungkin terkirim dua kali;
+				// penerima dapat mendeteksi duplikat dari header X-Webhook-Id.
+				log.Printf("Peringatan: %v", err)
+			}
+		}(job)
+	}
+	wg.Wait()
+	return len(jobs), nil
+}
+
+// runWebhookDispatcher memeriksa outbox setiap webhookPollInterval dan mengirim event yang sudah
+// waktunya, batch demi batch sampai tidak ada yang tersisa. Saat stop ditutup, batch yang sedang
+// dikirim diselesaikan lalu done ditutup; event lain tetap tersimpan di outbox untuk dikirim nanti.
+func runWebhookDispatcher(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		for {
+			n, err := dispatchWebhooks(webhookHTTPClient)
+			if err != nil {
+				log.Printf("Peringatan: %v", err)
+				break
+			}
+			if n < webhookBatchSize {
+				break
+			}
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// webhookSecretAD adalah additional data enkripsi secret webhook, agar ciphertext tidak bisa dipindahkan ke
+// webhook milik klien lain.
+func webhookSecretAD(clientID int64) string {
+	return "webhook:" + strconv.FormatInt(clientID, 10)
+}
+
+// migrateWebhookSecrets mengenkripsi secret webhook dari skema lama (kolom secret berisi secret mentah) ke
+// kolom secret_enc, lalu menghapus kolom secret. Aman dijalankan berulang kali; mengembalikan jumlah
+// secret yang dienkripsi.
+func migrateWebhookSecrets() (int64, error) {
+	var count int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'api_client_webhooks' AND COLUMN_NAME = 'secret'",
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("gagal memeriksa kolom: %w", err)
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	if err := ensureColumn("api_client_webhooks", "secret_enc", "VARBINARY(128) NULL AFTER url"); err != nil {
+		return 0, fmt.Errorf("gagal menambahkan kolom secret_enc: %w", err)
+	}
+
+	rows, err := db.Query("SELECT id, client_id, secret FROM api_client_webhooks WHERE secret_enc IS NULL")
+	if err != nil {
+		return 0, fmt.Errorf("gagal membaca secret webhook: %w", err)
+	}
+	type plainSecret struct {
+		id, clientID int64
+		secret       string
+	}
+	var pending []plainSecret
+	for rows.Next() {
+		var p plainSecret
+		if err := rows.Scan(&p.id, &p.clientID, &p.secret); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("gagal membaca secret webhook: %w", err)
+		}
+		pending = append(pending, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("gagal membaca secret webhook: %w", err)
+	}
+
+	for _, p := range pending {
+		enc, err := sealSecret(p.secret, webhookSecretAD(p.clientID))
+		if err != nil {
+			return 0, fmt.Errorf("gagal mengenkripsi secret webhook ID %d: %w", p.id, err)
+		}
+		if _, err := db.Exec("UPDATE api_client_webhooks SET secret_enc = ? WHERE id = ?", enc, p.id); err != nil {
+			return 0, fmt.Errorf("gagal menyimpan secret webhook ID %d: %w", p.id, err)
+		}
+	}
+	// Kolom mentah baru dihapus setelah semua secret terenkripsi, sehingga migrasi yang terhenti bisa diulang
+	if _, err := db.Exec("ALTER TABLE api_client_webhooks DROP COLUMN secret, MODIFY COLUMN secret_enc VARBINARY(128) NOT NULL"); err != nil {
+		return 0, fmt.Errorf("gagal menghapus kolom secret mentah: %w", err)
+	}
+	return int64(len(pending)), nil
+}
+
+// createWebhook mendaftarkan webhook baru untuk klien dengan secret acak. Secret disimpan terenkripsi
+// dengan kunci yang sama dengan signing secret API Key dan hanya dikembalikan sekali ini.
+func createWebhook(clientID int64, rawURL string, events []string) (*ClientWebhook, error) {
+	if _, err := findClientByID(clientID); err != nil {
+		return nil, err
+	}
+	secret, err := randomBase62(32)
+	if err != nil {
+		return nil, fmt.Errorf("gagal membuat secret webhook: %w", err)
+	}
+	secret = "whsec_" + secret
+	secretEnc, err := sealSecret(secret, webhookSecretAD(clientID))
+	if err != nil {
+		return nil, fmt.Errorf("gagal mengenkripsi secret webhook: %w", err)
+	}
+	result, err := db.Exec(
+		"INSERT INTO api_client_webhooks (client_id, url, secret_enc, events) VALUES (?, ?, ?, ?)",
+		clientID, rawURL, secretEnc, strings.Join(events, ","),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("gagal menyimpan webhook: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("gagal mendapatkan ID webhook baru: %w", err)
+	}
+	return &ClientWebhook{
+		ID:        id,
+		ClientID:  clientID,
+		URL:       rawURL,
+		Secret:    secret,
+		Events:    events,
+		IsActive:  true,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// listWebhooks mengambil semua webhook milik klien, termasuk yang sudah dihapus (tidak aktif).
+func listWebhooks(clientID int64) ([]ClientWebhook, error) {
+	rows, err := db.Query("SELECT id, client_id, url, events, is_active, created_at FROM api_client_webhooks WHERE client_id = ? ORDER BY id", clientID)
+	if err != nil {
+		return nil, fmt.Errorf("error mengambil daftar webhook: %w", err)
+	}
+	defer rows.Close()
+	webhooks := []ClientWebhook{}
+	for rows.Next() {
+		var wh ClientWebhook
+		var events sql.NullString
+		if err := rows.Scan(&wh.ID, &wh.ClientID, &wh.URL, &events, &wh.IsActive, &wh.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error membaca webhook: %w", err)
+		}
+		wh.Events = splitScopes(events.String)
+		webhooks = append(webhooks, wh)
+	}
+	return webhooks, rows.Err()
+}
+
+// findWebhook mencari webhook milik klien tertentu.
+func findWebhook(clientID, webhookID int64) (*ClientWebhook, error) {
+	var wh ClientWebhook
+	var events sql.NullString
+	err := db.QueryRow(
+		"SELECT id, client_id, url, events, is_active, created_at FROM api_client_webhooks WHERE id = ? AND client_id = ?",
+		webhookID, clientID,
+	).Scan(&wh.ID, &wh.ClientID, &wh.URL, &events, &wh.IsActive, &wh.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("webhook dengan ID %d tidak ditemukan", webhookID)
+		}
+		return nil, fmt.Errorf("error mencari webhook: %w", err)
+	}
+	wh.Events = splitScopes(events.String)
+	return &wh, nil
+}
+
+// deactivateWebhook menonaktifkan webhook dan membatalkan event yang belum terkirim. Baris webhook
+// tidak dihapus agar log pengirimannya tetap bisa dibaca.
+func deactivateWebhook(clientID, webhookID int64) error {
+	if _, err := findWebhook(clientID, webhookID); err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("gagal memulai transaksi: %w", err)
+	}
+	defer tx.Rollback() // Tidak berpengaruh jika transaksi sudah di-commit
+	if _, err := tx.Exec("UPDATE api_client_webhooks SET is_active = FALSE WHERE id = ?", webhookID); err != nil {
+		return fmt.Errorf("gagal menonaktifkan webhook: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE webhook_outbox SET status = 'cancelled' WHERE webhook_id = ? AND status = 'pending'", webhookID); err != nil {
+		return fmt.Errorf("gagal membatalkan event webhook: %w", err)
+	}
+	return tx.Commit()
+}
+
+// enqueueWebhookPing mencatat event webhook.ping khusus untuk satu webhook.
+func enqueueWebhookPing(wh *ClientWebhook) error {
+	payload, err := newWebhookPayload(wh.ClientID, webhookEventPing, map[string]interface{}{"webhook_id": wh.ID})
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec("INSERT INTO webhook_outbox (webhook_id, event_type, payload) VALUES (?, ?, ?)", wh.ID, webhookEventPing, payload); err != nil {
+		return fmt.Errorf("gagal mencatat event %s: %w", webhookEventPing, err)
+	}
+	return nil
+}
+
+// listWebhookDeliveries mengambil log pengiriman terbaru untuk satu webhook.
+func listWebhookDeliveries(webhookID int64, limit int) ([]WebhookDelivery, error) {
+	rows, err := db.Query(`
+        SELECT d.id, d.outbox_id, o.event_type, d.attempt, d.status_code, d.error, d.duration_ms, d.created_at, o.status
+        FROM webhook_deliveries d JOIN webhook_outbox o ON o.id = d.outbox_id
+        WHERE d.webhook_id = ?
+        ORDER BY d.id DESC LIMIT ?`, webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error mengambil log pengiriman webhook: %w", err)
+	}
+	defer rows.Close()
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		var code sql.NullInt64
+		if err := rows.Scan(&d.ID, &d.OutboxID, &d.EventType, &d.Attempt, &code, &d.Error, &d.DurationMS, &d.CreatedAt, &d.EventState); err != nil {
+			return nil, fmt.Errorf("error membaca log pengiriman webhook: %w", err)
+		}
+		if code.Valid {
+			statusCode := int(code.Int64)
+			d.StatusCode = &statusCode
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// --- Laporan Kebocoran API Key ---
+
+// LeakedKeyReport adalah satu token dalam laporan kebocoran, dengan bentuk payload yang dipakai
+// program partner secret scanning (misalnya GitHub).
+type LeakedKeyReport struct {
+	Token  string `json:"token"`
+	Type   string `json:"type"`
+	URL    string `json:"url"`
+	Source string `json:"source"`
+}
+
+// LeakedKeyResult adalah hasil pemeriksaan satu token yang dilaporkan.
+type LeakedKeyResult struct {
+	TokenRaw  string `json:"token_raw"`
+	TokenType string `json:"token_type"`
+	Label     string `json:"label"` // "true_positive" jika token adalah API Key yang terdaftar, selain itu "false_positive"
+}
+
+const (
+	leakLabelTruePositive  = "true_positive"
+	leakLabelFalsePositive = "false_positive"
+)
+
+// verifyLeakReportSignature memeriksa header tanda tangan "sha256=<hex>" terhadap HMAC-SHA256 body
+// dengan leakReportSecret. Selalu gagal jika leakReportSecret kosong.
+func verifyLeakReportSignature(body []byte, header string) bool {
+	if leakReportSecret == "" {
+		return false
+	}
+	signatureHex, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	signature, err := hex.DecodeString(signatureHex)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(leakReportSecret))
+	mac.Write(body)
+	return hmac.Equal(signature, mac.Sum(nil))
+}
+
+// handleLeakedKey mencocokkan satu token yang dilaporkan dengan API Key yang tersimpan. Jika cocok,
+// kunci dinonaktifkan dan insiden dicatat (juga untuk kunci yang sudah tidak aktif).
+func handleLeakedKey(report LeakedKeyReport, reporterAddr string) (LeakedKeyResult, error) {
+	result := LeakedKeyResult{TokenRaw: report.Token, TokenType: report.Type, Label: leakLabelFalsePositive}
+	if report.Token == "" || checkAPIKeyFormat(report.Token) != nil {
+		return result, nil
+	}
+	rec, err := findAPIKeyByRawKey(report.Token, apiKeyHashCandidates(report.Token), false)
+	if errors.Is(err, errAPIKeyInvalid) {
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	result.Label = leakLabelTruePositive
+
+	tx, err := db.Begin()
+	if err != nil {
+		return result, fmt.Errorf("gagal memulai transaksi: %w", err)
+	}
+	defer tx.Rollback()
+	// suspended_with_client dikosongkan agar kunci yang bocor tidak aktif lagi saat penangguhan kliennya dicabut
+	if _, err := tx.Exec("UPDATE api_keys SET is_active = FALSE, suspended_with_client = FALSE WHERE id = ?", rec.ID); err != nil {
+		return result, fmt.Errorf("gagal menonaktifkan API Key yang bocor: %w", err)
+	}
+	if rec.IsActive {
+		data := keyEventData(rec)
+		data["reason"] = "leaked"
+		data["leak_url"] = report.URL
+		if err := enqueueWebhookEvent(tx, rec.ClientID, webhookEventKeyRevoked, data); err != nil {
+			return result, err
+		}
+	}
+	_, err = tx.Exec(
+		"INSERT INTO api_key_leak_incidents (api_key_id, key_prefix, token_type, source, url, was_active, reporter_addr) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		rec.ID, rec.KeyPrefix, truncate(report.Type, 100), truncate(report.Source, 100), truncate(report.URL, 2048), rec.IsActive, reporterAddr,
+	)
+	if err != nil {
+		return result, fmt.Errorf("gagal mencatat insiden kebocoran: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("gagal menyimpan insiden kebocoran: %w", err)
+	}
+
+	invalidateAPIKeyCache(rec.APIKeyHash, rec.KeyPrefix)
+	invalidateAPIKeyCache(hashAPIKey(report.Token), rec.KeyPrefix) // Kunci cache jika hash tersimpan masih format lama
+	if rec.IsActive {
+		log.Printf("PERINGATAN KEAMANAN: API Key bocor dilaporkan dan dinonaktifkan (Klien: %s, Prefix: %s, URL: %s)", rec.ClientName, rec.KeyPrefix, report.URL)
+	} else {
+		log.Printf("API Key bocor dilaporkan tetapi sudah tidak aktif (Klien: %s, Prefix: %s, URL: %s)", rec.ClientName, rec.KeyPrefix, report.URL)
+	}
+	return result, nil
+}
+
+// truncate memotong s menjadi paling banyak n byte agar muat di kolom database.
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// --- Penulisan Pemakaian API Key per Batch ---
+
+// pendingUsage adalah pemakaian satu kunci yang belum ditulis ke database.
+type pendingUsage struct {
+	lastUsedAt time.Time
+	periods    map[string]int64 // Periode tagihan -> jumlah request yang belum ditulis
+}
+
+// apiKeyUsageWriter menggabungkan pemakaian per ID kunci di memori (last_used_at dan kenaikan
+// api_key_usage_periods), lalu menulisnya ke database per batch setiap interval dan saat shutdown.
+// Ini menggantikan satu goroutine + satu UPDATE untuk setiap request.
+type apiKeyUsageWriter struct {
+	mu      sync.Mutex
+	pending map[int64]*pendingUsage
+	maxKeys int
+	stop    chan struct{}
+	done    chan struct{}
+
+	// Metrik, juga diekspos melalui expvar di /admin/metrics
+	flushedKeys    expvar.Int // Jumlah kunci yang berhasil ditulis
+	flushedBatches expvar.Int // Jumlah flush yang berhasil
+	droppedUpdates expvar.Int // Pemakaian yang dibuang karena jumlah kunci tertunda mencapai batas
+	flushErrors    expvar.Int // Jumlah flush yang gagal
+}
+
+func newAPIKeyUsageWriter(maxKeys int) *apiKeyUsageWriter {
+	w := &apiKeyUsageWriter{
+		pending: make(map[int64]*pendingUsage),
+		maxKeys: maxKeys,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	metrics := expvar.NewMap("api_key_usage_writer")
+	metrics.Set("flushed_keys", &w.flushedKeys)
+	metrics.Set("flushed_batches", &w.flushedBatches)
+	metrics.Set("dropped_updates", &w.droppedUpdates)
+	metrics.Set("flush_errors", &w.flushErrors)
+	metrics.Set("pending_keys", expvar.Func(func() any {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return len(w.pending)
+	}))
+	return w
+}
+
+var apiKeyUsage = newAPIKeyUsageWriter(usageWriterMaxPendingKeys)
+
+// Record mencatat satu pemakaian kunci. period berisi periode tagihan jika request dihitung
+// terhadap kuota bulanan, atau kosong jika tidak. Tidak pernah memblokir pada database.
+func (w *apiKeyUsageWriter) Record(apiKeyID int64, at time.Time, period string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	usage, ok := w.pending[apiKeyID]
+	if !ok {
+		if len(w.pending) >= w.maxKeys {
+			w.droppedUpdates.Add(1)
+			return
+		}
+		usage = &pendingUsage{periods: make(map[string]int64)}
+		w.pending[apiKeyID] = usage
+	}
+	if at.After(usage.lastUsedAt) {
+		usage.lastUsedAt = at
+	}
+	if period != "" {
+		usage.periods[period]++
+	}
+}
+
+// Run menulis pemakaian tertunda setiap interval sampai Stop dipanggil.
+func (w *apiKeyUsageWriter) Run(interval time.Duration) {
+	defer close(w.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.Flush()
+		case <-w.stop:
+			w.Flush()
+			return
+		}
+	}
+}
+
+// Stop menghentikan Run setelah flush terakhir selesai.
+func (w *apiKeyUsageWriter) Stop() {
+	close(w.stop)
+	<-w.done
+}
+
+// Flush menulis semua pemakaian tertunda ke database. Jika gagal, pemakaian dikembalikan ke antrean
+// untuk dicoba lagi pada flush berikutnya.
+func (w *apiKeyUsageWriter) Flush() {
+	w.mu.Lock()
+	batch := w.pending
+	w.pending = make(map[int64]*pendingUsage)
+	w.mu.Unlock()
+
+	chunk := make(map[int64]*pendingUsage, min(len(batch), usageWriterBatchSize))
+	for id, usage := range batch {
+		chunk[id] = usage
+		if len(chunk) >= usageWriterBatchSize {
+			w.flushChunk(chunk)
+			chunk = make(map[int64]*pendingUsage, usageWriterBatchSize)
+		}
+	}
+	if len(chunk) > 0 {
+		w.flushChunk(chunk)
+	}
+}
+
+// PendingCount mengembalikan jumlah request kunci pada periode tagihan yang belum ditulis ke database.
+func (w *apiKeyUsageWriter) PendingCount(apiKeyID int64, period string) int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if usage, ok := w.pending[apiKeyID]; ok {
+		return usage.periods[period]
+	}
+	return 0
+}
+
+// FlushKey menulis pemakaian tertunda satu kunci saja. Jika gagal, pemakaian dikembalikan ke antrean.
+func (w *apiKeyUsageWriter) FlushKey(apiKeyID int64) error {
+	w.mu.Lock()
+	usage, ok := w.pending[apiKeyID]
+	delete(w.pending, apiKeyID)
+	w.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	chunk := map[int64]*pendingUsage{apiKeyID: usage}
+	if err := writeUsageBatch(chunk); err != nil {
+		w.flushErrors.Add(1)
+		w.requeue(chunk)
+		return err
+	}
+	w.flushedKeys.Add(1)
+	w.flushedBatches.Add(1)
+	return nil
+}
+
+func (w *apiKeyUsageWriter) flushChunk(chunk map[int64]*pendingUsage) {
+	if err := writeUsageBatch(chunk); err != nil {
+		w.flushErrors.Add(1)
+		log.Printf("Peringatan: Gagal menulis pemakaian %d API Key: %v", len(chunk), err)
+		w.requeue(chunk)
+		return
+	}
+	w.flushedKeys.Add(int64(len(chunk)))
+	w.flushedBatches.Add(1)
+}
+
+// requeue menggabungkan kembali batch yang gagal ditulis ke antrean tertunda.
+func (w *apiKeyUsageWriter) requeue(batch map[int64]*pendingUsage) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for id, failed := range batch {
+		usage, ok := w.pending[id]
+		if !ok {
+			if len(w.pending) >= w.maxKeys {
+				w.droppedUpdates.Add(1)
+				continue
+			}
+			w.pending[id] = failed
+			continue
+		}
+		if failed.lastUsedAt.After(usage.lastUsedAt) {
+			usage.lastUsedAt = failed.lastUsedAt
+		}
+		for period, n := range failed.periods {
+			usage.periods[period] += n
+		}
+	}
+}
+
+// writeUsageBatch menulis satu batch pemakaian dalam satu transaksi: satu UPDATE untuk last_used_at
+// dan satu upsert multi-baris untuk api_key_usage_periods.
+func writeUsageBatch(batch map[int64]*pendingUsage) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("gagal memulai transaksi: %w", err)
+	}
+	defer tx.Rollback()
+
+	var cases, ids []string
+	var caseArgs, idArgs []any
+	var periodRows []string
+	var periodArgs []any
+	for id, usage := range batch {
+		cases = append(cases, "WHEN ? THEN ?")
+		caseArgs = append(caseArgs, id, usage.lastUsedAt)
+		ids = append(ids, "?")
+		idArgs = append(idArgs, id)
+		for period, n := range usage.periods {
+			periodRows = append(periodRows, "(?, ?, ?)")
+			periodArgs = append(periodArgs, id, period, n)
+		}
+	}
+
+	// GREATEST menjaga agar last_used_at tidak mundur jika instance lain sudah menulis waktu yang lebih baru
+	_, err = tx.Exec(
+		"UPDATE api_keys SET last_used_at = GREATEST(COALESCE(last_used_at, '1970-01-01'), CASE id "+strings.Join(cases, " ")+" END) WHERE id IN ("+strings.Join(ids, ", ")+")",
+		append(caseArgs, idArgs...)...,
+	)
+	if err != nil {
+		return fmt.Errorf("gagal memperbarui last_used_at: %w", err)
+	}
+	if len(periodRows) > 0 {
+		_, err = tx.Exec(
+			"INSERT INTO api_key_usage_periods (api_key_id, period, request_count) VALUES "+strings.Join(periodRows, ", ")+
+				" ON DUPLICATE KEY UPDATE request_count = request_count + VALUES(request_count)",
+			periodArgs...,
+		)
+		if err != nil {
+			return fmt.Errorf("gagal menyimpan pemakaian periode: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// --- Rate Limiting per API Key ---
+
+// RateLimit mendeskripsikan batas request: Requests request per Window.
+type RateLimit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// RateLimitResult adalah hasil satu pemeriksaan rate limit.
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int           // Kapasitas bucket (jumlah request per window)
+	Remaining  int           // Sisa request yang boleh dilakukan saat ini
+	ResetAfter time.Duration // Waktu sampai bucket terisi penuh kembali
+	RetryAfter time.Duration // Waktu tunggu sampai request berikutnya diizinkan (hanya jika Allowed == false)
+}
+
+// RateLimitStore menyimpan state rate limit per API Key.
+// Implementasi default adalah memoryRateLimitStore; untuk beberapa instance server,
+// buat implementasi yang memakai penyimpanan bersama (misalnya Redis) dan tetapkan ke variabel rateLimiter.
+type RateLimitStore interface {
+	// Take mencoba memakai satu token untuk kunci dengan ID apiKeyID.
+	Take(apiKeyID int64, limit RateLimit, now time.Time) (RateLimitResult, error)
+}
+
+// tokenBucket adalah state satu bucket: jumlah token tersisa dan waktu terakhir diisi ulang.
+type tokenBucket struct {
+	tokens     float64
+	lastRefill time.Time
+}
+
+// memoryRateLimitStore adalah RateLimitStore berbasis token bucket yang disimpan di memori proses.
+type memoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[int64]*tokenBucket
+}
+
+// newMemoryRateLimitStore membuat memoryRateLimitStore dan menjalankan pembersihan bucket yang
+// sudah penuh kembali (tidak dipakai) setiap cleanupInterval.
+func newMemoryRateLimitStore(cleanupInterval time.Duration) *memoryRateLimitStore {
+	store := &memoryRateLimitStore{buckets: make(map[int64]*tokenBucket)}
+	go func() {
+		ticker := time.NewTicker(cleanupInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			store.cleanup(now, cleanupInterval)
+		}
+	}()
+	return store
+}
+
+// Take mengisi ulang bucket sesuai waktu yang berlalu lalu mencoba memakai satu token.
+func (s *memoryRateLimitStore) Take(apiKeyID int64, limit RateLimit, now time.Time) (RateLimitResult, error) {
+	capacity := float64(limit.Requests)
+	ratePerSecond := capacity / limit.Window.Seconds()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, ok := s.buckets[apiKeyID]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, lastRefill: now}
+		s.buckets[apiKeyID] = bucket
+	}
+	elapsed := now.Sub(bucket.lastRefill).Seconds()
+	if elapsed > 0 {
+		bucket.tokens = math.Min(capacity, bucket.tokens+elapsed*ratePerSecond)
+		bucket.lastRefill = now
+	}
+	// Batas per kunci bisa diturunkan saat bucket sedang terisi
+	bucket.tokens = math.Min(bucket.tokens, capacity)
+
+	result := RateLimitResult{Limit: limit.Requests}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - bucket.tokens) / ratePerSecond * float64(time.Second))
+	}
+	result.Remaining = int(bucket.tokens)
+	result.ResetAfter = time.Duration((capacity - bucket.tokens) / ratePerSecond * float64(time.Second))
+	return result, nil
+}
+
+// cleanup menghapus bucket yang tidak dipakai selama idleAfter agar map tidak tumbuh tanpa batas.
+// Bucket yang dihapus akan dibuat kembali dalam keadaan penuh, sama seperti hasil pengisian ulang.
+func (s *memoryRateLimitStore) cleanup(now time.Time, idleAfter time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, bucket := range s.buckets {
+		if now.Sub(bucket.lastRefill) > idleAfter {
+			delete(s.buckets, id)
+		}
+	}
+}
+
+// rateLimiter adalah penyimpanan rate limit yang dipakai apiKeyAuthMiddleware.
+var rateLimiter RateLimitStore = newMemoryRateLimitStore(rateLimitCleanupInterval)
+
+// rateLimitFor mengembalikan batas yang berlaku untuk kunci: override per kunci atau nilai default.
+// ok bernilai false jika kunci tidak dibatasi (override 0).
+func rateLimitFor(rec *APIKeyRecord) (RateLimit, bool) {
+	requests := defaultRateLimitPerMinute
+	if rec.RateLimitPerMinute != nil {
+		requests = *rec.RateLimitPerMinute
+	}
+	if requests <= 0 {
+		return RateLimit{}, false
+	}
+	return RateLimit{Requests: requests, Window: time.Minute}, true
+}
+
+// setRateLimitHeaders menulis header RateLimit-* (draft IETF "RateLimit header fields for HTTP").
+func setRateLimitHeaders(w http.ResponseWriter, limit RateLimit, result RateLimitResult) {
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", limit.Requests, int(limit.Window.Seconds())))
+}
+
+// ceilSeconds membulatkan durasi ke atas dalam satuan detik.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// --- Kuota Bulanan per API Key ---
+
+// Mode penegakan kuota bulanan.
+const (
+	quotaEnforcementHard = "hard" // Request ditolak (429) setelah kuota habis
+	quotaEnforcementSoft = "soft" // Request tetap dilayani, hanya diberi header dan dicatat di log
+)
+
+// billingPeriod mengembalikan periode tagihan (bulan kalender UTC, format "2006-01") untuk waktu t,
+// beserta waktu awal periode berikutnya (saat kuota direset).
+func billingPeriod(t time.Time) (string, time.Time) {
+	t = t.UTC()
+	start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start.Format("2006-01"), start.AddDate(0, 1, 0)
+}
+
+// QuotaStatus adalah ringkasan pemakaian satu kunci dalam periode tagihan berjalan.
+type QuotaStatus struct {
+	Period       string    `json:"period"`
+	RequestCount int64     `json:"request_count"`
+	MonthlyQuota *int64    `json:"monthly_quota"` // nil berarti tanpa kuota
+	Remaining    *int64    `json:"remaining"`     // nil berarti tanpa kuota
+	Enforcement  string    `json:"enforcement"`
+	ResetsAt     time.Time `json:"resets_at"`
+	Exceeded     bool      `json:"exceeded"`
+}
+
+// consumeQuota mencatat satu request untuk kunci yang memiliki kuota bulanan dengan satu upsert atomik di
+// api_key_usage_periods. Hitungan hanya ada di database, sehingga semua instance berbagi kuota yang sama
+// dan request bersamaan tidak bisa melampaui kuota hard: kenaikan hanya terjadi selama request_count masih
+// di bawah kuota. Request yang ditolak dikembalikan dengan counted == false.
+// Kunci tanpa kuota tidak melewati fungsi ini; pemakaiannya dihitung per batch oleh apiKeyUsageWriter.
+func consumeQuota(rec *APIKeyRecord, now time.Time) (status QuotaStatus, counted bool, err error) {
+	period, resetsAt := billingPeriod(now)
+	limit := int64(math.MaxInt64) // Kuota soft: request selalu dihitung
+	if rec.QuotaEnforcement == quotaEnforcementHard {
+		limit = *rec.MonthlyQuota
+		if limit <= 0 {
+			count, err := periodRequestCount(rec.ID, period)
+			return buildQuotaStatus(rec, count, period, resetsAt), false, err
+		}
+	}
+
+	// LAST_INSERT_ID(expr) mengembalikan nilai baru request_count lewat LastInsertId tanpa query kedua
+	result, err := db.Exec(`
+        INSERT INTO api_key_usage_periods (api_key_id, period, request_count) VALUES (?, ?, 1)
+        ON DUPLICATE KEY UPDATE request_count = IF(request_count < ?, LAST_INSERT_ID(request_count + 1), request_count)`,
+		rec.ID, period, limit,
+	)
+	if err != nil {
+		return QuotaStatus{}, false, fmt.Errorf("gagal mencatat pemakaian kuota: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return QuotaStatus{}, false, fmt.Errorf("gagal membaca hasil pencatatan kuota: %w", err)
+	}
+	switch affected {
+	case 1: // Baris baru untuk periode ini
+		return buildQuotaStatus(rec, 1, period, resetsAt), true, nil
+	case 2: // Baris yang ada dinaikkan
+		count, err := result.LastInsertId()
+		if err != nil {
+			return QuotaStatus{}, false, fmt.Errorf("gagal membaca hasil pencatatan kuota: %w", err)
+		}
+		return buildQuotaStatus(rec, count, period, resetsAt), true, nil
+	}
+
+	// Tidak ada baris yang berubah: kuota hard sudah habis
+	count, err := periodRequestCount(rec.ID, period)
+	return buildQuotaStatus(rec, count, period, resetsAt), false, err
+}
+
+// periodRequestCount membaca jumlah request kunci yang sudah tersimpan untuk satu periode tagihan.
+func periodRequestCount(apiKeyID int64, period string) (int64, error) {
+	var count int64
+	err := db.QueryRow("SELECT request_count FROM api_key_usage_periods WHERE api_key_id = ? AND period = ?", apiKeyID, period).Scan(&count)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("gagal membaca pemakaian API Key: %w", err)
+	}
+	return count, nil
+}
+
+// currentQuotaStatus mengembalikan pemakaian kunci saat ini tanpa mencatat request: jumlah di database ditambah
+// pemakaian yang masih menunggu ditulis oleh apiKeyUsageWriter.
+func currentQuotaStatus(rec *APIKeyRecord, now time.Time) (QuotaStatus, error) {
+	period, resetsAt := billingPeriod(now)
+	count, err := periodRequestCount(rec.ID, period)
+	if err != nil {
+		return QuotaStatus{}, err
+	}
+	count += apiKeyUsage.PendingCount(rec.ID, period)
+	return buildQuotaStatus(rec, count, period, resetsAt), nil
+}
+
+// buildQuotaStatus menyusun QuotaStatus dari jumlah request dan pengaturan kuota kunci.
+func buildQuotaStatus(rec *APIKeyRecord, count int64, period string, resetsAt time.Time) QuotaStatus {
+	status := QuotaStatus{
+		Period:       period,
+		RequestCount: count,
+		MonthlyQuota: rec.MonthlyQuota,
+		Enforcement:  rec.QuotaEnforcement,
+		ResetsAt:     resetsAt,
+	}
+	if rec.MonthlyQuota != nil {
+		remaining := max(*rec.MonthlyQuota-count, 0)
+		status.Remaining = &remaining
+		status.Exceeded = count >= *rec.MonthlyQuota
+	}
+	return status
+}
+
+// setQuotaHeaders menulis header sisa kuota bulanan. Tidak ada header jika kunci tidak memiliki kuota.
+func setQuotaHeaders(w http.ResponseWriter, status QuotaStatus) {
+	if status.MonthlyQuota == nil {
+		return
+	}
+	w.Header().Set("X-Quota-Limit", strconv.FormatInt(*status.MonthlyQuota, 10))
+	w.Header().Set("X-Quota-Remaining", strconv.FormatInt(*status.Remaining, 10))
+	w.Header().Set("X-Quota-Reset", status.ResetsAt.Format(time.RFC3339))
+}
+
+// --- Log Request per API Key ---
+
+// usageLogEntry adalah satu request terautentikasi yang akan disimpan ke api_key_requests.
+type usageLogEntry struct {
+	APIKeyID   int64
+	Method     string
+	Route      string // Template rute mux, misalnya "/admin/api-keys/{prefix}"
+	Status     int
+	Latency    time.Duration
+	RemoteAddr string
+	CreatedAt  time.Time
+}
+
+// usageLogQueue menampung entri log sebelum ditulis per batch oleh runUsageLogWriter.
+var usageLogQueue = make(chan usageLogEntry, usageLogQueueSize)
+
+// enqueueUsageLog memasukkan entri ke antrean tanpa memblokir request. Jika antrean penuh, entri dibuang.
+func enqueueUsageLog(entry usageLogEntry) {
+	select {
+	case usageLogQueue <- entry:
+	default:
+		log.Printf("Peringatan: Antrean log request penuh, entri untuk API Key ID %d dibuang.", entry.APIKeyID)
+	}
+}
+
+// runUsageLogWriter menulis entri dari usageLogQueue ke database per batch, setiap kali batch penuh
+// atau setiap usageLogFlushInterval. Saat stop ditutup, sisa antrean ditulis lalu done ditutup.
+func runUsageLogWriter(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(usageLogFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]usageLogEntry, 0, usageLogBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := insertUsageLogs(batch); err != nil {
+			log.Printf("Peringatan: %d entri log request gagal disimpan: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case entry := <-usageLogQueue:
+			batch = append(batch, entry)
+			if len(batch) >= usageLogBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-stop:
+			for {
+				select {
+				case entry := <-usageLogQueue:
+					batch = append(batch, entry)
+					if len(batch) >= usageLogBatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// insertUsageLogs menyimpan beberapa entri log dengan satu INSERT multi-baris.
+func insertUsageLogs(entries []usageLogEntry) error {
+	placeholders := make([]string, 0, len(entries))
+	args := make([]any, 0, len(entries)*7)
+	for _, e := range entries {
+		placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?, ?)")
+		args = append(args, e.APIKeyID, e.Method, e.Route, e.Status, e.Latency.Milliseconds(), e.RemoteAddr, e.CreatedAt)
+	}
+	_, err := db.Exec(
+		"INSERT INTO api_key_requests (api_key_id, method, route, status, latency_ms, remote_addr, created_at) VALUES "+strings.Join(placeholders, ", "),
+		args...,
+	)
+	return err
+}
+
+// UsageReportRow adalah satu baris laporan agregat: jumlah request per hari, rute, dan status.
+type UsageReportRow struct {
+	Day          string  `json:"day"`
+	Method       string  `json:"method"`
+	Route        string  `json:"route"`
+	Status       int     `json:"status"`
+	Count        int64   `json:"count"`
+	AvgLatencyMS float64 `json:"avg_latency_ms"`
+}
+
+// usageReport mengagregasi log request satu kunci antara from (inklusif) dan to (eksklusif).
+func usageReport(apiKeyID int64, from, to time.Time) ([]UsageReportRow, error) {
+	rows, err := db.Query(`
+        SELECT DATE_FORMAT(created_at, '%Y-%m-%d') AS day, method, route, status, COUNT(*), AVG(latency_ms)
+        FROM api_key_requests
+        WHERE api_key_id = ? AND created_at >= ? AND created_at < ?
+        GROUP BY day, method, route, status
+        ORDER BY day, route, method, status`,
+		apiKeyID, from, to,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("gagal membuat laporan pemakaian: %w", err)
+	}
+	defer rows.Close()
+
+	report := []UsageReportRow{}
+	for rows.Next() {
+		var row UsageReportRow
+		if err := rows.Scan(&row.Day, &row.Method, &row.Route, &row.Status, &row.Count, &row.AvgLatencyMS); err != nil {
+			return nil, fmt.Errorf("gagal membaca laporan pemakaian: %w", err)
+		}
+		report = append(report, row)
+	}
+	return report, rows.Err()
+}
+
+// pruneUsageLogs menghapus log request yang lebih tua dari retentionDays, sedikit demi sedikit
+// agar tidak mengunci tabel terlalu lama. Mengembalikan jumlah baris yang dihapus.
+func pruneUsageLogs(retentionDays int) (int64, error) {
+	var total int64
+	for {
+		result, err := db.Exec("DELETE FROM api_key_requests WHERE created_at < DATE_SUB(CURRENT_TIMESTAMP, INTERVAL ? DAY) LIMIT 10000", retentionDays)
+		if err != nil {
+			return total, fmt.Errorf("gagal menghapus log request lama: %w", err)
+		}
+		n, _ := result.RowsAffected()
+		total += n
+		if n < 10000 {
+			return total, nil
+		}
+	}
+}
+
+// startUsageLogPruneJob menjalankan pruneUsageLogs secara berkala di background.
+func startUsageLogPruneJob(interval time.Duration, retentionDays int) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, err := pruneUsageLogs(retentionDays)
+			if err != nil {
+				log.Printf("Peringatan: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("%d log request API Key yang lebih tua dari %d hari dihapus.", n, retentionDays)
+			}
+		}
+	}()
+}
+
+// statusRecorder membungkus http.ResponseWriter untuk mencatat status code yang dikirim handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap memungkinkan http.ResponseController mengakses ResponseWriter asli.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// routeTemplate mengembalikan template rute mux untuk request (misalnya "/admin/api-keys/{prefix}")
+// agar laporan tidak terpecah per nilai path. Jika tidak tersedia, path mentah yang dipakai.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return r.URL.Path
+}
+
+// --- Mode Tanda Tangan HMAC ---
+
+// loadSigningEncryptionKey membaca API_KEY_SIGNING_KEY (64 karakter hex) ke apiKeySigningEncryptionKey.
+func loadSigningEncryptionKey() error {
+	env := os.Getenv("API_KEY_SIGNING_KEY")
+	if env == "" {
+		return fmt.Errorf("API_KEY_SIGNING_KEY belum diset (buat dengan: openssl rand -hex 32)")
+	}
+	key, err := hex.DecodeString(env)
+	if err != nil || len(key) != 32 {
+		return fmt.Errorf("API_KEY_SIGNING_KEY harus berisi 64 karakter hex (32 byte)")
+	}
+	apiKeySigningEncryptionKey = key
+	return nil
+}
+
+// signingSecretAEAD membuat AES-256-GCM dari apiKeySigningEncryptionKey.
+func signingSecretAEAD() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(apiKeySigningEncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("kunci enkripsi signing secret tidak valid: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealSecret mengenkripsi secret dengan signingSecretAEAD dan mengembalikan nonce||ciphertext untuk disimpan.
+// additionalData mengikat ciphertext ke pemiliknya, sehingga tidak bisa dipindahkan ke baris lain.
+func sealSecret(secret, additionalData string) ([]byte, error) {
+	aead, err := signingSecretAEAD()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("gagal membuat nonce enkripsi secret: %w", err)
+	}
+	return aead.Seal(nonce, nonce, []byte(secret), []byte(additionalData)), nil
+}
+
+// openSecret mendekripsi hasil sealSecret dengan additionalData yang sama.
+func openSecret(enc []byte, additionalData string) (string, error) {
+	aead, err := signingSecretAEAD()
+	if err != nil {
+		return "", err
+	}
+	if len(enc) < aead.NonceSize() {
+		return "", fmt.Errorf("ciphertext terlalu pendek")
+	}
+	nonce, ciphertext := enc[:aead.NonceSize()], enc[aead.NonceSize():]
+	secret, err := aead.Open(nil, nonce, ciphertext, []byte(additionalData))
+	if err != nil {
+		return "", err
+	}
+	return string(secret), nil
+}
+
+// newSigningSecret membuat signing secret acak untuk kunci dengan key_prefix tertentu. Mengembalikan secret
+// dalam bentuk hex (untuk ditampilkan sekali ke klien) dan versi terenkripsinya (untuk disimpan).
+// key_prefix dipakai sebagai additional data agar ciphertext tidak bisa dipindahkan ke baris kunci lain.
+func newSigningSecret(keyPrefix string) (string, []byte, error) {
+	raw := make([]byte, signingSecretBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", nil, fmt.Errorf("gagal membuat signing secret acak: %w", err)
+	}
+	secret := hex.EncodeToString(raw)
+	enc, err := sealSecret(secret, keyPrefix)
+	if err != nil {
+		return "", nil, err
+	}
+	return secret, enc, nil
+}
+
+// decryptSigningSecret mendekripsi signing secret milik rec. Kunci tanpa signing secret menghasilkan
+// errSignatureInvalid.
+func decryptSigningSecret(rec *APIKeyRecord) (string, error) {
+	if len(rec.SigningSecretEnc) == 0 {
+		return "", errSignatureInvalid
+	}
+	secret, err := openSecret(rec.SigningSecretEnc, rec.KeyPrefix)
+	if err != nil {
+		return "", fmt.Errorf("gagal mendekripsi signing secret API Key '%s' (API_KEY_SIGNING_KEY berbeda?): %w", rec.KeyPrefix, err)
+	}
+	return secret, nil
+}
+
+// replaceSigningSecret mengganti signing secret kunci dengan secret acak baru (atau menghapusnya jika revoke
+// bernilai true). Secret lama langsung tidak berlaku. Mengembalikan secret baru dalam bentuk hex.
+func replaceSigningSecret(rec *APIKeyRecord, revoke bool) (string, error) {
+	var secret string
+	var secretEnc []byte
+	if !revoke {
+		var err error
+		if secret, secretEnc, err = newSigningSecret(rec.KeyPrefix); err != nil {
+			return "", err
+		}
+	}
+	if _, err := db.Exec("UPDATE api_keys SET signing_secret_enc = ? WHERE id = ?", secretEnc, rec.ID); err != nil {
+		return "", fmt.Errorf("gagal menyimpan signing secret API Key '%s': %w", rec.KeyPrefix, err)
+	}
+	invalidateAPIKeyCache(rec.APIKeyHash, rec.KeyPrefix)
+	return secret, nil
+}
+
+// canonicalSignedRequest menyusun string yang ditandatangani: method, path (ter-escape), query dengan
+// parameter terurut, hex SHA-256 body, timestamp, dan nonce, masing-masing dipisahkan baris baru.
+func canonicalSignedRequest(r *http.Request, bodyDigest, timestamp, nonce string) string {
+	return strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.Query().Encode(),
+		bodyDigest,
+		timestamp,
+		nonce,
+	}, "\n")
+}
+
+// validNonce memeriksa bentuk nonce: 16-64 karakter huruf, angka, '-' atau '_'.
+func validNonce(nonce string) bool {
+	if len(nonce) < 16 || len(nonce) > 64 {
+		return false
+	}
+	return strings.Trim(nonce, base62Alphabet+"-_") == ""
+}
+
+// nonceCache mengingat nonce yang sudah dipakai sampai timestamp request-nya keluar dari jendela waktu,
+// sehingga request bertanda tangan yang sama tidak bisa diputar ulang.
+type nonceCache struct {
+	mu       sync.Mutex
+	capacity int
+	seen     map[string]time.Time // Kunci "key_prefix:nonce" -> waktu nonce boleh dilupakan
+}
+
+// newNonceCache membuat nonceCache dan menjalankan pembersihan nonce kedaluwarsa setiap cleanupInterval.
+func newNonceCache(capacity int, cleanupInterval time.Duration) *nonceCache {
+	c := &nonceCache{capacity: capacity, seen: make(map[string]time.Time)}
+	go func() {
+		ticker := time.NewTicker(cleanupInterval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			c.cleanup(now)
+		}
+	}()
+	return c
+}
+
+var signedRequestNonces = newNonceCache(signedRequestNonceCapacity, time.Minute)
+
+// use mencatat nonce untuk kunci tertentu. Mengembalikan errNonceReused jika nonce sudah dipakai. Jika cache
+// penuh, request ditolak (fail closed) karena replay tidak lagi bisa dideteksi.
+func (c *nonceCache) use(keyPrefix, nonce string, forgetAt, now time.Time) error {
+	key := keyPrefix + ":" + nonce
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if expiry, ok := c.seen[key]; ok && now.Before(expiry) {
+		return errNonceReused
+	}
+	if len(c.seen) >= c.capacity {
+		return fmt.Errorf("cache nonce penuh (%d entri)", c.capacity)
+	}
+	c.seen[key] = forgetAt
+	return nil
+}
+
+func (c *nonceCache) cleanup(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, expiry := range c.seen {
+		if !now.Before(expiry) {
+			delete(c.seen, key)
+		}
+	}
+}
+
+// validateSignedRequest memverifikasi request pada mode tanda tangan HMAC dan mengembalikan record kuncinya.
+// Body dibaca untuk dihitung digest-nya lalu dipasang kembali agar tetap bisa dibaca handler.
+func validateSignedRequest(w http.ResponseWriter, r *http.Request, now time.Time) (*APIKeyRecord, error) {
+	keyPrefix := r.Header.Get(apiKeyIDHeader)
+	timestamp := r.Header.Get(apiKeyTimestampHeader)
+	nonce := r.Header.Get(apiKeyNonceHeader)
+	signature, err := hex.DecodeString(r.Header.Get(apiKeySignatureHeader))
+	if keyPrefix == "" || err != nil || len(signature) != sha256.Size || !validNonce(nonce) {
+		return nil, errSignatureInvalid
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, errSignatureInvalid
+	}
+	signedAt := time.Unix(unix, 0)
+	if signedAt.Before(now.Add(-signedRequestMaxClockSkew)) || signedAt.After(now.Add(signedRequestMaxClockSkew)) {
+		return nil, errSignatureExpired
+	}
+
+	rec, err := lookupActiveAPIKeyByPrefix(keyPrefix)
+	if err != nil && !errors.Is(err, errAPIKeyExpired) {
+		return nil, err
+	}
+	if rec.KeyType == apiKeyTypePublishable {
+		return nil, errSignatureInvalid // Kunci publishable tidak memiliki signing secret
+	}
+
+	body, readErr := io.ReadAll(http.MaxBytesReader(w, r.Body, signedRequestMaxBodyBytes))
+	if readErr != nil {
+		return nil, fmt.Errorf("gagal membaca body request: %w", readErr)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	bodyDigest := sha256.Sum256(body)
+
+	signingSecret, secretErr := decryptSigningSecret(rec)
+	if secretErr != nil {
+		return nil, secretErr
+	}
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	mac.Write([]byte(canonicalSignedRequest(r, hex.EncodeToString(bodyDigest[:]), timestamp, nonce)))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, errSignatureInvalid
+	}
+
+	// Nonce dicatat setelah tanda tangan valid agar pihak lain tidak bisa "menghabiskan" nonce milik klien
+	if nonceErr := signedRequestNonces.use(rec.KeyPrefix, nonce, signedAt.Add(signedRequestMaxClockSkew), now); nonceErr != nil {
+		return nil, nonceErr
+	}
+	return rec, err // err berisi errAPIKeyExpired jika kunci sudah kedaluwarsa
+}
+
+// --- Alamat Klien ---
+
+// loadTrustedProxies membaca TRUSTED_PROXIES (misalnya "10.0.0.0/8,127.0.0.1") ke trustedProxies.
+func loadTrustedProxies() error {
+	env := os.Getenv("TRUSTED_PROXIES")
+	if env == "" {
+		return nil
+	}
+	for _, cidr := range strings.Split(env, ",") {
+		prefix, err := parseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return err
+		}
+		trustedProxies = append(trustedProxies, prefix)
+	}
+	return nil
+}
+
+// isTrustedProxy melaporkan apakah ip termasuk salah satu trustedProxies.
+func isTrustedProxy(ip netip.Addr) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestClientIP menentukan alamat asli klien. Jika koneksi datang dari proxy tepercaya, X-Forwarded-For
+// dibaca dari kanan ke kiri dan alamat pertama yang bukan proxy tepercaya dianggap sebagai klien; entri di
+// sebelah kirinya bisa dipalsukan klien sehingga diabaikan. ok == false jika alamat tidak dapat dibaca.
+func requestClientIP(r *http.Request) (netip.Addr, bool) {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	ip := addrPort.Addr().Unmap()
+	if !isTrustedProxy(ip) {
+		return ip, true
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			return netip.Addr{}, false // Header rusak: jangan menebak alamat klien
+		}
+		ip = hop.Unmap()
+		if !isTrustedProxy(ip) {
+			return ip, true
+		}
+	}
+	// Semua hop adalah proxy tepercaya; pakai alamat paling kiri
+	return ip, true
+}
+
+// --- Origin Request (untuk Kunci Publishable) ---
+
+// requestOriginHost mengembalikan host[:port] asal request dari header Origin, atau dari Referer jika
+// Origin tidak dikirim (browser tidak selalu mengirim Origin untuk request GET same-origin).
+// ok == false jika tidak ada keduanya atau nilainya tidak dapat dibaca (misalnya Origin "null").
+func requestOriginHost(r *http.Request) (string, bool) {
+	value := r.Header.Get("Origin")
+	if value == "" {
+		value = r.Header.Get("Referer")
+	}
+	if value == "" {
+		return "", false
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", false
+	}
+	return strings.ToLower(u.Host), true
+}
+
+// setCORSHeaders mengizinkan browser dari origin request membaca respons.
+func setCORSHeaders(w http.ResponseWriter, origin string) {
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Expose-Headers", corsExposeHeaders)
+	w.Header().Add("Vary", "Origin")
+}
+
+// serveCORSPreflight menjawab request OPTIONS preflight. Preflight dikirim tanpa API Key, jadi origin
+// diperiksa terhadap gabungan allowed_origins semua kunci publishable yang aktif; origin lain tidak
+// mendapat header CORS sehingga browser membatalkan request sebenarnya.
+func serveCORSPreflight(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Origin")
+	origin := r.Header.Get("Origin")
+	requestMethod := r.Header.Get("Access-Control-Request-Method")
+	host, ok := requestOriginHost(r)
+	if origin == "" || !ok || requestMethod == "" {
+		http.Error(w, "Preflight CORS membutuhkan header Origin dan Access-Control-Request-Method.", http.StatusBadRequest)
+		return
+	}
+	allowed, err := publishableOrigins.allows(host, time.Now())
+	if err != nil {
+		log.Printf("Error memeriksa origin preflight %s: %v", origin, err)
+		http.Error(w, "Terjadi kesalahan internal.", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		log.Printf("Preflight CORS ditolak untuk origin %s", origin)
+		http.Error(w, "Origin tidak diizinkan.", http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Methods", requestMethod)
+	w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+	w.Header().Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAgeSeconds))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// --- Middleware Autentikasi API Key ---
+
+// apiKeyFromRequest membaca API Key mentah dari sumber pertama (sesuai urutan sources) yang berisi nilai.
+func apiKeyFromRequest(r *http.Request, sources []APIKeySource) (string, APIKeySource) {
+	for _, source := range sources {
+		var apiKey string
+		switch source {
+		case apiKeySourceHeader:
+			apiKey = r.Header.Get(apiKeyHeader)
+		case apiKeySourceAuthorization:
+			scheme, credentials, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+			if ok && strings.EqualFold(scheme, apiKeyAuthScheme) {
+				apiKey = strings.TrimSpace(credentials)
+			}
+		case apiKeySourceQuery:
+			apiKey = r.URL.Query().Get(apiKeyQueryParam)
+		}
+		if apiKey != "" {
+			return apiKey, source
+		}
+	}
+	return "", ""
+}
+
+// redactAPIKeyQuery mengganti nilai parameter api_key pada request URI agar kunci tidak tercatat di log.
+func redactAPIKeyQuery(requestURI string) string {
+	path, rawQuery, ok := strings.Cut(requestURI, "?")
+	if !ok {
+		return requestURI
+	}
+	params := strings.Split(rawQuery, "&")
+	for i, param := range params {
+		name, _, _ := strings.Cut(param, "=")
+		if unescaped, err := url.QueryUnescape(name); err == nil && unescaped == apiKeyQueryParam {
+			params[i] = name + "=" + redactedQueryText
+		}
+	}
+	return path + "?" + strings.Join(params, "&")
+}
+
+// authenticateRawAPIKey memvalidasi API Key mentah dari sumber yang diizinkan. Jika gagal, respons error
+// sudah ditulis dan ok == false.
+func authenticateRawAPIKey(w http.ResponseWriter, r *http.Request, sources []APIKeySource) (*APIKeyRecord, bool) {
+	apiKey, _ := apiKeyFromRequest(r, sources)
+	if apiKey == "" {
+		log.Println("Upaya akses tanpa API Key.")
+		http.Error(w, "Akses Ditolak: API Key diperlukan.", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	// Tolak kunci yang bentuknya salah (misalnya salah ketik) sebelum menyentuh cache atau database
+	if err := checkAPIKeyFormat(apiKey); err != nil {
+		log.Printf("Upaya akses dengan API Key berformat salah ('%s')", apiKey[:min(len(apiKey), 12)]+"...")
+		http.Error(w, "Akses Ditolak: Format API Key tidak valid.", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	apiKeyRecord, err := validateAPIKey(apiKey)
+	if errors.Is(err, errAPIKeyExpired) {
+		log.Printf("Upaya akses dengan API Key kedaluwarsa (Prefix: %s, kedaluwarsa: %s)", apiKeyRecord.KeyPrefix, apiKeyRecord.ExpiresAt.Format(time.RFC3339))
+		http.Error(w, "Akses Ditolak: API Key sudah kedaluwarsa.", http.StatusUnauthorized)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Upaya akses dengan API Key tidak valid ('%s'): %v", apiKey[:min(len(apiKey), 12)]+"...", err) // Log prefix kunci
+		http.Error(w, "Akses Ditolak: API Key tidak valid atau tidak aktif.", http.StatusForbidden)
+		return nil, false
+	}
+	return apiKeyRecord, true
+}
+
+// authenticateSignedRequest memvalidasi request pada mode tanda tangan HMAC. Jika gagal, respons error
+// sudah ditulis dan ok == false.
+func authenticateSignedRequest(w http.ResponseWriter, r *http.Request) (*APIKeyRecord, bool) {
+	keyPrefix := r.Header.Get(apiKeyIDHeader)
+	keyPrefix = keyPrefix[:min(len(keyPrefix), 32)] // Hanya untuk log
+	apiKeyRecord, err := validateSignedRequest(w, r, time.Now())
+	switch {
+	case err == nil:
+		return apiKeyRecord, true
+	case errors.Is(err, errAPIKeyExpired):
+		log.Printf("Upaya akses bertanda tangan dengan API Key kedaluwarsa (Prefix: %s, kedaluwarsa: %s)", apiKeyRecord.KeyPrefix, apiKeyRecord.ExpiresAt.Format(time.RFC3339))
+		http.Error(w, "Akses Ditolak: API Key sudah kedaluwarsa.", http.StatusUnauthorized)
+	case errors.Is(err, errSignatureInvalid), errors.Is(err, errSignatureExpired), errors.Is(err, errNonceReused):
+		log.Printf("Upaya akses bertanda tangan ditolak (Prefix: '%s'): %v", keyPrefix, err)
+		http.Error(w, "Akses Ditolak: "+err.Error()+".", http.StatusUnauthorized)
+	case errors.Is(err, errAPIKeyInvalid):
+		log.Printf("Upaya akses bertanda tangan dengan key ID tidak valid ('%s')", keyPrefix)
+		http.Error(w, "Akses Ditolak: API Key tidak valid atau tidak aktif.", http.StatusForbidden)
+	default:
+		log.Printf("Error memverifikasi request bertanda tangan (Prefix: '%s'): %v", keyPrefix, err)
+		http.Error(w, "Akses Ditolak: Request bertanda tangan tidak dapat diverifikasi.", http.StatusBadRequest)
+	}
+	return nil, false
+}
+
+// apiKeyAuthMiddleware mewajibkan API Key dari defaultAPIKeySources (atau request bertanda tangan HMAC).
+func apiKeyAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return apiKeyAuthMiddlewareFrom(defaultAPIKeySources...)(next)
+}
+
+// apiKeyAuthMiddlewareFrom membuat middleware autentikasi API Key yang membaca kunci dari sources,
+// dicoba sesuai urutan, misalnya apiKeyAuthMiddlewareFrom(apiKeySourceHeader, apiKeySourceQuery).
+func apiKeyAuthMiddlewareFrom(sources ...APIKeySource) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return apiKeyAuthHandler(sources, next)
+	}
+}
+
+func apiKeyAuthHandler(sources []APIKeySource, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Preflight CORS dari browser tidak membawa API Key, jadi dijawab sebelum pemeriksaan kunci
+		if r.Method == http.MethodOptions {
+			serveCORSPreflight(w, r)
+			return
+		}
+
+		// Request bertanda tangan HMAC membawa key ID dan tanda tangan, bukan API Key mentah
+		var apiKeyRecord *APIKeyRecord
+		var ok bool
+		if r.Header.Get(apiKeySignatureHeader) != "" {
+			apiKeyRecord, ok = authenticateSignedRequest(w, r)
+		} else {
+			apiKeyRecord, ok = authenticateRawAPIKey(w, r, sources)
+		}
+		if !ok {
+			return
+		}
+
+		// Mulai dari sini request sudah terautentikasi: catat method, rute, status, dan latensinya
+		clientIP, clientIPOK := requestClientIP(r)
+		clientAddr := r.RemoteAddr
+		if clientIPOK {
+			clientAddr = clientIP.String()
+		}
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		w = recorder
+		defer func() {
+			status := recorder.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			enqueueUsageLog(usageLogEntry{
+				APIKeyID:   apiKeyRecord.ID,
+				Method:     r.Method,
+				Route:      routeTemplate(r),
+				Status:     status,
+				Latency:    time.Since(start),
+				RemoteAddr: clientAddr,
+				CreatedAt:  start,
+			})
+		}()
+
+		// Periksa pembatasan alamat klien milik kunci
+		if len(apiKeyRecord.AllowedCIDRs) > 0 && (!clientIPOK || !ipAllowed(apiKeyRecord.AllowedCIDRs, clientIP)) {
+			log.Printf("Akses ditolak untuk klien %s (Prefix: %s): alamat %s tidak diizinkan untuk kunci ini.", apiKeyRecord.ClientName, apiKeyRecord.KeyPrefix, clientAddr)
+			http.Error(w, "Akses Ditolak: API Key tidak diizinkan dipakai dari alamat ini.", http.StatusForbidden)
+			return
+		}
+
+		// Kunci publishable hanya berlaku dari origin yang terdaftar untuk kunci tersebut
+		if apiKeyRecord.KeyType == apiKeyTypePublishable {
+			host, ok := requestOriginHost(r)
+			if !ok || !originAllowed(apiKeyRecord.AllowedOrigins, host) {
+				log.Printf("Akses ditolak untuk klien %s (Prefix: %s): origin '%s' tidak diizinkan untuk kunci ini.", apiKeyRecord.ClientName, apiKeyRecord.KeyPrefix, host)
+				http.Error(w, "Akses Ditolak: API Key tidak diizinkan dipakai dari origin ini.", http.StatusForbidden)
+				return
+			}
+			if origin := r.Header.Get("Origin"); origin != "" {
+				setCORSHeaders(w, origin)
+			}
+		}
+
+		// Periksa pembatasan method/path milik kunci
+		if !routeAllowed(apiKeyRecord.AllowedRoutes, r.Method, r.URL.Path) {
+			log.Printf("Akses ditolak untuk klien %s (Prefix: %s): rute %s %s tidak diizinkan untuk kunci ini.", apiKeyRecord.ClientName, apiKeyRecord.KeyPrefix, r.Method, r.URL.Path)
+			http.Error(w, "Akses Ditolak: API Key tidak diizinkan mengakses rute ini.", http.StatusForbidden)
+			return
+		}
+
+		// Kunci test hanya diterima rute yang secara eksplisit dipasang dengan acceptsTestKeys
+		if apiKeyRecord.Environment != apiKeyEnvironmentLive && !testKeysAccepted(r.Context()) {
+			log.Printf("Akses ditolak untuk klien %s (Prefix: %s): kunci test tidak diizinkan untuk rute %s %s.", apiKeyRecord.ClientName, apiKeyRecord.KeyPrefix, r.Method, r.URL.Path)
+			http.Error(w, "Akses Ditolak: Rute ini tidak menerima API Key test.", http.StatusForbidden)
+			return
+		}
+
+		// Batasi jumlah request per kunci
+		if limit, ok := rateLimitFor(apiKeyRecord); ok {
+			result, err := rateLimiter.Take(apiKeyRecord.ID, limit, time.Now())
+			if err != nil {
+				// Jika penyimpanan rate limit bermasalah, request tetap dilayani (fail open)
+				log.Printf("Peringatan: Gagal memeriksa rate limit untuk API Key ID %d: %v", apiKeyRecord.ID, err)
+			} else {
+				setRateLimitHeaders(w, limit, result)
+				if !result.Allowed {
+					log.Printf("Rate limit terlampaui untuk klien %s (Prefix: %s)", apiKeyRecord.ClientName, apiKeyRecord.KeyPrefix)
+					throttleNotifications.notify(apiKeyRecord, "rate_limit", time.Now())
+					w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+					http.Error(w, "Terlalu banyak request. Coba lagi nanti.", http.StatusTooManyRequests)
+					return
+				}
+			}
+		}
+
+		// Catat pemakaian terhadap kuota bulanan. Kunci berkuota dihitung langsung di database;
+		// kunci tanpa kuota dihitung per batch oleh apiKeyUsageWriter.
+		var countedPeriod string // Periode tagihan yang dihitung per batch
+		if apiKeyRecord.MonthlyQuota == nil {
+			countedPeriod, _ = billingPeriod(time.Now())
+		} else if quotaStatus, counted, err := consumeQuota(apiKeyRecord, time.Now()); err != nil {
+			// Sama seperti rate limit, kegagalan membaca kuota tidak memblokir request
+			log.Printf("Peringatan: Gagal memeriksa kuota untuk API Key ID %d: %v", apiKeyRecord.ID, err)
+		} else {
+			setQuotaHeaders(w, quotaStatus)
+			if !counted {
+				log.Printf("Kuota bulanan habis untuk klien %s (Prefix: %s, periode %s)", apiKeyRecord.ClientName, apiKeyRecord.KeyPrefix, quotaStatus.Period)
+				throttleNotifications.notify(apiKeyRecord, "monthly_quota", time.Now())
+				w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(time.Until(quotaStatus.ResetsAt))))
+				http.Error(w, "Kuota bulanan API Key sudah habis.", http.StatusTooManyRequests)
+				return
+			}
+			if quotaStatus.Exceeded {
+				log.Printf("Peringatan: Klien %s (Prefix: %s) melampaui kuota bulanan soft (%d/%d)", apiKeyRecord.ClientName, apiKeyRecord.KeyPrefix, quotaStatus.RequestCount, *quotaStatus.MonthlyQuota)
+			}
+		}
+
+		// API Key valid
+		log.Printf("Akses diberikan untuk klien: %s (ID Kunci: %d, Prefix: %s)", apiKeyRecord.ClientName, apiKeyRecord.ID, apiKeyRecord.KeyPrefix)
+		setExpiryWarningHeaders(w, apiKeyRecord)
+
+		// Catat penggunaan API Key; ditulis ke database per batch oleh apiKeyUsageWriter
+		apiKeyUsage.Record(apiKeyRecord.ID, time.Now(), countedPeriod)
+
+		// Simpan record API Key dan lingkungannya di context agar bisa dipakai oleh requireScopes,
+		// envHandler, dan handler selanjutnya
+		ctx := context.WithValue(r.Context(), apiKeyRecordContextKey, apiKeyRecord)
+		ctx = context.WithValue(ctx, apiKeyEnvironmentContextKey, apiKeyRecord.Environment)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+// apiKeyEndOfLife mengembalikan waktu paling awal kunci berhenti berlaku: expires_at atau
+// akhir masa tenggang rotasi (deactivate_at). Mengembalikan nil jika keduanya tidak ada.
+func apiKeyEndOfLife(rec *APIKeyRecord) *time.Time {
+	end := rec.ExpiresAt
+	if rec.DeactivateAt != nil && (end == nil || rec.DeactivateAt.Before(*end)) {
+		end = rec.DeactivateAt
+	}
+	return end
+}
+
+// setExpiryWarningHeaders menambahkan header "Sunset" (RFC 8594) dan "Warning" jika kunci akan berhenti
+// berlaku dalam apiKeyExpiryWarningDays hari, agar tim klien mendapat peringatan melalui lalu lintas biasa.
+func setExpiryWarningHeaders(w http.ResponseWriter, rec *APIKeyRecord) {
+	end := apiKeyEndOfLife(rec)
+	if end == nil {
+		return
+	}
+	remaining := time.Until(*end)
+	if remaining > apiKeyExpiryWarningDays*24*time.Hour {
+		return
+	}
+	reason := "kedaluwarsa"
+	if end == rec.DeactivateAt {
+		reason = "dinonaktifkan karena sudah dirotasi"
+	}
+	w.Header().Set("Sunset", end.UTC().Format(http.TimeFormat))
+	w.Header().Set("Warning", fmt.Sprintf(`299 - "API Key %s akan %s dalam %d hari (%s)"`,
+		rec.KeyPrefix, reason, int(remaining.Hours()/24), end.UTC().Format(time.RFC3339)))
+	log.Printf("Peringatan: API Key klien %s (Prefix: %s) akan %s pada %s", rec.ClientName, rec.KeyPrefix, reason, end.Format(time.RFC3339))
+}
+
+// apiKeyRecordFromContext mengambil *APIKeyRecord yang disimpan oleh apiKeyAuthMiddleware.
+func apiKeyRecordFromContext(ctx context.Context) (*APIKeyRecord, bool) {
+	rec, ok := ctx.Value(apiKeyRecordContextKey).(*APIKeyRecord)
+	return rec, ok
+}
+
+// apiKeyEnvironmentFromContext mengembalikan lingkungan ("live" atau "test") dari API Key yang terautentikasi.
+func apiKeyEnvironmentFromContext(ctx context.Context) (string, bool) {
+	env, ok := ctx.Value(apiKeyEnvironmentContextKey).(string)
+	return env, ok
+}
+
+// acceptsTestKeys menandai rute agar apiKeyAuthMiddleware menerima kunci test; tanpa penanda ini kunci test
+// selalu ditolak dengan status 403. Dipasang di luar apiKeyAuthMiddleware, dan hanya untuk rute yang
+// memakai envHandler dengan handler sandbox atau yang hanya menyentuh data milik kunci itu sendiri.
+func acceptsTestKeys(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), testKeysAcceptedContextKey, true)))
+	}
+}
+
+// testKeysAccepted melaporkan apakah rute request ini dipasang dengan acceptsTestKeys.
+func testKeysAccepted(ctx context.Context) bool {
+	accepted, _ := ctx.Value(testKeysAcceptedContextKey).(bool)
+	return accepted
+}
+
+// envHandler memilih handler berdasarkan lingkungan kunci: live untuk kunci produksi dan sandbox untuk
+// kunci test, sehingga trafik sandbox tidak pernah menyentuh data produksi. Jika sandbox nil, kunci test
+// tetap ditolak. Harus dipasang di dalam apiKeyAuthMiddleware, dan rutenya ditandai dengan acceptsTestKeys
+// agar kunci test sampai ke sini, misalnya:
+//
+//	acceptsTestKeys(apiKeyAuthMiddleware(envHandler(createOrderHandler, sandboxCreateOrderHandler)))
+func envHandler(live, sandbox http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		env, ok := apiKeyEnvironmentFromContext(r.Context())
+		if !ok {
+			log.Printf("envHandler dipasang tanpa apiKeyAuthMiddleware untuk rute %s %s", r.Method, r.URL.Path)
+			http.Error(w, "Akses Ditolak: API Key diperlukan.", http.StatusUnauthorized)
+			return
+		}
+		if env == apiKeyEnvironmentLive {
+			live(w, r)
+			return
+		}
+		if sandbox == nil {
+			apiKeyRecord, _ := apiKeyRecordFromContext(r.Context())
+			log.Printf("Akses ditolak untuk klien %s (Prefix: %s): kunci test tidak diizinkan untuk rute %s %s.", apiKeyRecord.ClientName, apiKeyRecord.KeyPrefix, r.Method, r.URL.Path)
+			http.Error(w, "Akses Ditolak: Rute ini tidak menerima API Key test.", http.StatusForbidden)
+			return
+		}
+		sandbox(w, r)
+	}
+}
+
+// requireScopes membuat middleware tingkat rute yang mewajibkan API Key memiliki semua scope yang disebutkan.
+// Harus dipasang di dalam apiKeyAuthMiddleware, misalnya:
+//
+//	apiKeyAuthMiddleware(requireScopes("reports:read")(reportsHandler))
+func requireScopes(scopes ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			apiKeyRecord, ok := apiKeyRecordFromContext(r.Context())
+			if !ok {
+				log.Printf("requireScopes dipasang tanpa apiKeyAuthMiddleware untuk rute %s %s", r.Method, r.URL.Path)
+				http.Error(w, "Akses Ditolak: API Key diperlukan.", http.StatusUnauthorized)
+				return
+			}
+			for _, scope := range scopes {
+				if !hasScope(apiKeyRecord.Scopes, scope) {
+					log.Printf("Akses ditolak untuk klien %s (Prefix: %s): scope '%s' tidak dimiliki.", apiKeyRecord.ClientName, apiKeyRecord.KeyPrefix, scope)
+					http.Error(w, fmt.Sprintf("Akses Ditolak: API Key tidak memiliki scope '%s'.", scope), http.StatusForbidden)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		}
+	}
+}
+
+// Fungsi utilitas min
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// --- Perintah CLI Pengelolaan API Key ---
+// Perintah ini dijalankan langsung terhadap database tanpa menjalankan server, sehingga tim operasional
+// tidak perlu menulis SQL manual. Catatan: cache validasi di server yang sedang berjalan baru melihat
+// perubahan (misalnya pencabutan) setelah TTL cache habis.
+
+// cliCommand adalah satu subperintah command line.
+type cliCommand struct {
+	usage string // Argumen dan opsi, ditampilkan oleh "help"
+	run   func(args []string) error
+}
+
+var cliCommands = map[string]cliCommand{
+	"listkeys":      {"[-client nama] [-client-id id] [-prefix awalan] [-active true|false] [-limit n] [-offset n] [-json]", cliListKeys},
+	"showkey":       {"[-json] <key_prefix>", cliShowKey},
+	"revokekey":     {"[-json] <key_prefix>", cliSetKeyActive(false)},
+	"reactivatekey": {"[-json] <key_prefix>", cliSetKeyActive(true)},
+	"rotatekey":     {"[-json] <key_prefix> [masa_tenggang, misalnya 24h]", cliRotateKey},
+	"setexpiry":     {"[-json] <key_prefix> <YYYY-MM-DD | RFC3339 | 30d | never>", cliSetExpiry},
+	"keyusage":      {"[-from YYYY-MM-DD] [-to YYYY-MM-DD] [-json] <key_prefix>", cliKeyUsage},
+}
+
+// printCLIHelp menampilkan daftar perintah CLI yang tersedia.
+func printCLIHelp() {
+	names := make([]string, 0, len(cliCommands))
+	for name := range cliCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Println("Perintah yang tersedia:")
+	fmt.Println("  go run main.go initclient [NamaKlienOpsional] [scope1,scope2] [live|test]")
+	fmt.Println("  go run main.go initadmin [nama]")
+	for _, name := range names {
+		fmt.Printf("  go run main.go %s %s\n", name, cliCommands[name].usage)
+	}
+}
+
+// newCLIFlagSet membuat FlagSet untuk satu perintah dengan opsi -json yang selalu tersedia.
+func newCLIFlagSet(name string) (*flag.FlagSet, *bool) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "tampilkan hasil dalam format JSON")
+	return fs, asJSON
+}
+
+// cliPrefixArg mengambil satu argumen key_prefix wajib setelah opsi diparse.
+func cliPrefixArg(fs *flag.FlagSet) (string, error) {
+	if fs.NArg() < 1 {
+		return "", fmt.Errorf("key_prefix diperlukan")
+	}
+	return fs.Arg(0), nil
+}
+
+// printCLIResult menulis v sebagai JSON jika asJSON, atau memanggil table untuk menulis tabel teks.
+func printCLIResult(asJSON bool, v interface{}, table func(tw *tabwriter.Writer)) error {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	table(tw)
+	return tw.Flush()
+}
+
+// formatCLITime menampilkan waktu opsional untuk tabel CLI.
+func formatCLITime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// formatCLIList menampilkan daftar string untuk tabel CLI.
+func formatCLIList(items []string) string {
+	if len(items) == 0 {
+		return "-"
+	}
+	return strings.Join(items, ",")
+}
+
+// apiKeyStatusLabel meringkas status kunci untuk ditampilkan di CLI.
+func apiKeyStatusLabel(rec *APIKeyRecord, now time.Time) string {
+	switch {
+	case !rec.IsActive:
+		return "nonaktif"
+	case rec.ExpiresAt != nil && !now.Before(*rec.ExpiresAt):
+		return "kedaluwarsa"
+	case rec.DeactivateAt != nil:
+		return "masa tenggang"
+	default:
+		return "aktif"
+	}
+}
+
+// printAPIKeyDetail menulis metadata satu kunci sebagai pasangan nama-nilai.
+func printAPIKeyDetail(tw *tabwriter.Writer, rec *APIKeyRecord) {
+	clientID := "-"
+	if rec.ClientID != nil {
+		clientID = strconv.FormatInt(*rec.ClientID, 10)
+	}
+	rateLimit := "default"
+	if rec.RateLimitPerMinute != nil {
+		rateLimit = strconv.Itoa(*rec.RateLimitPerMinute)
+	}
+	quota := "-"
+	if rec.MonthlyQuota != nil {
+		quota = fmt.Sprintf("%d (%s)", *rec.MonthlyQuota, rec.QuotaEnforcement)
+	}
+	fmt.Fprintf(tw, "Prefix:\t%s\n", rec.KeyPrefix)
+	fmt.Fprintf(tw, "Klien:\t%s (ID %s)\n", rec.ClientName, clientID)
+	fmt.Fprintf(tw, "Status:\t%s\n", apiKeyStatusLabel(rec, time.Now()))
+	fmt.Fprintf(tw, "Lingkungan:\t%s\n", rec.Environment)
+	fmt.Fprintf(tw, "Tipe:\t%s\n", rec.KeyType)
+	fmt.Fprintf(tw, "Scope:\t%s\n", formatCLIList(rec.Scopes))
+	fmt.Fprintf(tw, "Rute diizinkan:\t%s\n", formatCLIList(rec.AllowedRoutes))
+	fmt.Fprintf(tw, "CIDR diizinkan:\t%s\n", formatCLIList(rec.AllowedCIDRs))
+	fmt.Fprintf(tw, "Origin diizinkan:\t%s\n", formatCLIList(rec.AllowedOrigins))
+	fmt.Fprintf(tw, "Rate limit/menit:\t%s\n", rateLimit)
+	fmt.Fprintf(tw, "Kuota bulanan:\t%s\n", quota)
+	fmt.Fprintf(tw, "Dibuat:\t%s\n", formatCLITime(&rec.CreatedAt))
+	fmt.Fprintf(tw, "Terakhir dipakai:\t%s\n", formatCLITime(rec.LastUsedAt))
+	fmt.Fprintf(tw, "Kedaluwarsa:\t%s\n", formatCLITime(rec.ExpiresAt))
+	fmt.Fprintf(tw, "Nonaktif otomatis:\t%s\n", formatCLITime(rec.DeactivateAt))
+}
+
+// cliListKeys menampilkan daftar API Key dengan filter yang sama seperti GET /admin/api-keys.
+func cliListKeys(args []string) error {
+	fs, asJSON := newCLIFlagSet("listkeys")
+	filter := APIKeyFilter{}
+	fs.StringVar(&filter.ClientName, "client", "", "filter nama klien (sebagian)")
+	fs.Int64Var(&filter.ClientID, "client-id", 0, "filter ID klien")
+	fs.StringVar(&filter.KeyPrefix, "prefix", "", "filter awalan key_prefix")
+	active := fs.String("active", "", "filter status: true atau false")
+	fs.IntVar(&filter.Limit, "limit", 100, "jumlah maksimum kunci")
+	fs.IntVar(&filter.Offset, "offset", 0, "jumlah kunci yang dilewati")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *active != "" {
+		v, err := strconv.ParseBool(*active)
+		if err != nil {
+			return fmt.Errorf("opsi -active harus true atau false")
+		}
+		filter.Active = &v
+	}
+	if filter.Limit < 1 || filter.Limit > 1000 || filter.Offset < 0 {
+		return fmt.Errorf("opsi -limit harus antara 1 dan 1000 dan -offset tidak boleh negatif")
+	}
+
+	keys, err := listAPIKeys(filter)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return printCLIResult(*asJSON, keys, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "PREFIX\tKLIEN\tSTATUS\tLINGKUNGAN\tTIPE\tSCOPE\tTERAKHIR DIPAKAI\tKEDALUWARSA")
+		for i := range keys {
+			rec := &keys[i]
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				rec.KeyPrefix, rec.ClientName, apiKeyStatusLabel(rec, now), rec.Environment, rec.KeyType,
+				formatCLIList(rec.Scopes), formatCLITime(rec.LastUsedAt), formatCLITime(rec.ExpiresAt))
+		}
+	})
+}
+
+// cliShowKey menampilkan metadata satu API Key berdasarkan key_prefix.
+func cliShowKey(args []string) error {
+	fs, asJSON := newCLIFlagSet("showkey")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	keyPrefix, err := cliPrefixArg(fs)
+	if err != nil {
+		return err
+	}
+	rec, err := findAPIKeyByPrefix(keyPrefix)
+	if err != nil {
+		return err
+	}
+	return printCLIResult(*asJSON, rec, func(tw *tabwriter.Writer) { printAPIKeyDetail(tw, rec) })
+}
+
+// cliSetKeyActive membuat perintah untuk mencabut (active=false) atau mengaktifkan kembali (active=true) API Key.
+func cliSetKeyActive(active bool) func(args []string) error {
+	return func(args []string) error {
+		name := "revokekey"
+		if active {
+			name = "reactivatekey"
+		}
+		fs, asJSON := newCLIFlagSet(name)
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		keyPrefix, err := cliPrefixArg(fs)
+		if err != nil {
+			return err
+		}
+		rec, err := setAPIKeyActive(keyPrefix, active)
+		if err != nil {
+			return err
+		}
+		action := "dicabut"
+		if active {
+			action = "diaktifkan kembali"
+		}
+		log.Printf("API Key '%s' milik klien %s %s melalui CLI", rec.KeyPrefix, rec.ClientName, action)
+		return printCLIResult(*asJSON, rec, func(tw *tabwriter.Writer) { printAPIKeyDetail(tw, rec) })
+	}
+}
+
+// cliRotateKey merotasi API Key dan menampilkan kunci mentah penggantinya (hanya sekali).
+func cliRotateKey(args []string) error {
+	fs, asJSON := newCLIFlagSet("rotatekey")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	keyPrefix, err := cliPrefixArg(fs)
+	if err != nil {
+		return err
+	}
+	gracePeriod, err := parseGracePeriod(fs.Arg(1))
+	if err != nil {
+		return fmt.Errorf("masa tenggang tidak valid: %w", err)
+	}
+
+	oldKey, err := findAPIKeyByPrefix(keyPrefix)
+	if err != nil {
+		return err
+	}
+	rawAPIKey, newKey, oldKey, err := rotateAPIKey(oldKey.ID, gracePeriod)
+	if err != nil {
+		return fmt.Errorf("gagal merotasi API Key '%s': %w", keyPrefix, err)
+	}
+	log.Println("API Key mentah dan signing secret pengganti hanya ditampilkan sekali. SIMPAN INI!")
+	result := map[string]interface{}{
+		"api_key":        rawAPIKey,
+		"signing_secret": newKey.SigningSecret,
+		"new_key":        newKey,
+		"old_key":        oldKey,
+		"deactivates":    oldKey.DeactivateAt,
+	}
+	return printCLIResult(*asJSON, result, func(tw *tabwriter.Writer) {
+		fmt.Fprintf(tw, "API Key baru:\t%s\n", rawAPIKey)
+		if newKey.SigningSecret != "" {
+			fmt.Fprintf(tw, "Signing secret baru:\t%s\n", newKey.SigningSecret)
+		}
+		fmt.Fprintf(tw, "Prefix baru:\t%s\n", newKey.KeyPrefix)
+		fmt.Fprintf(tw, "Klien:\t%s\n", newKey.ClientName)
+		fmt.Fprintf(tw, "Kunci lama:\t%s\n", oldKey.KeyPrefix)
+		fmt.Fprintf(tw, "Kunci lama berlaku sampai:\t%s\n", formatCLITime(oldKey.DeactivateAt))
+	})
+}
+
+// parseExpiryArg membaca waktu kedaluwarsa untuk setexpiry: tanggal YYYY-MM-DD (akhir hari UTC),
+// waktu RFC3339, jumlah hari dari sekarang ("30d"), atau "never" untuk menghapus masa berlaku.
+func parseExpiryArg(raw string, now time.Time) (*time.Time, error) {
+	if raw == "never" {
+		return nil, nil
+	}
+	var expiresAt time.Time
+	if days, ok := strings.CutSuffix(raw, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("jumlah hari '%s' tidak valid", raw)
+		}
+		expiresAt = now.AddDate(0, 0, n)
+	} else if t, err := time.Parse("2006-01-02", raw); err == nil {
+		expiresAt = t.AddDate(0, 0, 1).Add(-time.Second) // Berlaku sampai akhir tanggal tersebut (UTC)
+	} else if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		expiresAt = t
+	} else {
+		return nil, fmt.Errorf("waktu '%s' harus berformat YYYY-MM-DD, RFC3339, <n>d, atau never", raw)
+	}
+	if !expiresAt.After(now) {
+		return nil, fmt.Errorf("waktu kedaluwarsa harus di masa depan; gunakan revokekey untuk mencabut kunci")
+	}
+	expiresAt = expiresAt.UTC()
+	return &expiresAt, nil
+}
+
+// cliSetExpiry mengubah atau menghapus waktu kedaluwarsa API Key.
+func cliSetExpiry(args []string) error {
+	fs, asJSON := newCLIFlagSet("setexpiry")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		return fmt.Errorf("key_prefix dan waktu kedaluwarsa diperlukan")
+	}
+	expiresAt, err := parseExpiryArg(fs.Arg(1), time.Now())
+	if err != nil {
+		return err
+	}
+	rec, err := setAPIKeyExpiry(fs.Arg(0), expiresAt)
+	if err != nil {
+		return err
+	}
+	log.Printf("Masa berlaku API Key '%s' milik klien %s diubah menjadi %s melalui CLI", rec.KeyPrefix, rec.ClientName, formatCLITime(rec.ExpiresAt))
+	return printCLIResult(*asJSON, rec, func(tw *tabwriter.Writer) { printAPIKeyDetail(tw, rec) })
+}
+
+// cliKeyUsage menampilkan kuota periode berjalan dan laporan pemakaian agregat satu API Key.
+// Pemakaian yang masih tertunda di memori server yang sedang berjalan belum ikut terhitung.
+func cliKeyUsage(args []string) error {
+	fs, asJSON := newCLIFlagSet("keyusage")
+	rawFrom := fs.String("from", "", "tanggal awal laporan (YYYY-MM-DD, UTC)")
+	rawTo := fs.String("to", "", "tanggal akhir laporan, inklusif (YYYY-MM-DD, UTC)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	keyPrefix, err := cliPrefixArg(fs)
+	if err != nil {
+		return err
+	}
+	from, to, err := parseReportRange(*rawFrom, *rawTo)
+	if err != nil {
+		return err
+	}
+	rec, err := findAPIKeyByPrefix(keyPrefix)
+	if err != nil {
+		return err
+	}
+	status, err := currentQuotaStatus(rec, time.Now())
+	if err != nil {
+		return err
+	}
+	report, err := usageReport(rec.ID, from, to)
+	if err != nil {
+		return err
+	}
+
+	result := map[string]interface{}{
+		"key_prefix": rec.KeyPrefix,
+		"usage":      status,
+		"from":       from.Format("2006-01-02"),
+		"to":         to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"rows":       report,
+	}
+	return printCLIResult(*asJSON, result, func(tw *tabwriter.Writer) {
+		quota, remaining := "tanpa kuota", "-"
+		if status.MonthlyQuota != nil {
+			quota = fmt.Sprintf("%d (%s)", *status.MonthlyQuota, status.Enforcement)
+			remaining = strconv.FormatInt(*status.Remaining, 10)
+		}
+		fmt.Fprintf(tw, "Prefix:\t%s (%s)\n", rec.KeyPrefix, rec.ClientName)
+		fmt.Fprintf(tw, "Periode:\t%s\n", status.Period)
+		fmt.Fprintf(tw, "Request periode ini:\t%d\n", status.RequestCount)
+		fmt.Fprintf(tw, "Kuota:\t%s\n", quota)
+		fmt.Fprintf(tw, "Sisa kuota:\t%s\n", remaining)
+		fmt.Fprintf(tw, "Laporan:\t%s s.d. %s\n\n", from.Format("2006-01-02"), to.AddDate(0, 0, -1).Format("2006-01-02"))
+		fmt.Fprintln(tw, "TANGGAL\tMETHOD\tRUTE\tSTATUS\tJUMLAH\tRATA-RATA LATENSI (ms)")
+		for _, row := range report {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%.1f\n", row.Day, row.Method, row.Route, row.Status, row.Count, row.AvgLatencyMS)
+		}
+	})
+}
+
+// --- Handler Rute ---
+
+// registerClientHandler menangani pembuatan API Key baru untuk klien.
+// Endpoint ini hanya bisa diakses admin (dipasang di belakang adminAuthMiddleware).
+func registerClientHandler(w http.ResponseWriter, r *http.Request) {
+	var requestBody struct {
+		ClientName    string   `json:"client_name"`     // Klien dibuat otomatis jika belum ada
+		ClientID      *int64   `json:"client_id"`       // Opsional, pengganti client_name untuk klien yang sudah ada
+		Scopes        []string `json:"scopes"`          // Opsional, misalnya ["reports:read"]
+		AllowedRoutes []string `json:"allowed_routes"`  // Opsional, misalnya ["GET /api/reports/**"]
+		AllowedCIDRs  []string `json:"allowed_cidrs"`   // Opsional, misalnya ["203.0.113.0/24", "2001:db8::/32"]
+		ExpiresInDays int      `json:"expires_in_days"` // Opsional, 0 berarti tidak pernah kedaluwarsa
+		// Opsional, override rate limit per menit; 0 berarti tanpa batas
+		RateLimitPerMinute *int `json:"rate_limit_per_minute"`
+		// Opsional, jatah request per bulan dan mode penegakannya ("hard" atau "soft")
+		MonthlyQuota     *int64 `json:"monthly_quota"`
+		QuotaEnforcement string `json:"quota_enforcement"`
+		Environment      string `json:"environment"` // Opsional, "live" (default) atau "test"
+		// Opsional, "secret" (default) atau "publishable"; kunci publishable membutuhkan allowed_origins
+		KeyType        string   `json:"key_type"`
+		AllowedOrigins []string `json:"allowed_origins"` // Misalnya ["app.contoh.com", "*.contoh.com"]
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Request body tidak valid.", http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.ClientID != nil {
+		client, err := findClientByID(*requestBody.ClientID)
+		if err != nil {
+			writeAdminLookupError(w, err)
+			return
+		}
+		requestBody.ClientName = client.Name
+	}
+	if requestBody.ClientName == "" {
+		http.Error(w, "Nama klien ('client_name') atau 'client_id' diperlukan.", http.StatusBadRequest)
+		return
+	}
+	if err := validateClientName(requestBody.ClientName); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.ExpiresInDays < 0 {
+		http.Error(w, "'expires_in_days' tidak boleh negatif.", http.StatusBadRequest)
+		return
+	}
+
+	opts := APIKeyOptions{
+		Scopes:             requestBody.Scopes,
+		AllowedRoutes:      requestBody.AllowedRoutes,
+		AllowedCIDRs:       requestBody.AllowedCIDRs,
+		RateLimitPerMinute: requestBody.RateLimitPerMinute,
+		MonthlyQuota:       requestBody.MonthlyQuota,
+		QuotaEnforcement:   requestBody.QuotaEnforcement,
+		KeyType:            requestBody.KeyType,
+		Environment:        requestBody.Environment,
+		AllowedOrigins:     requestBody.AllowedOrigins,
+	}
+	if requestBody.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, requestBody.ExpiresInDays)
+		opts.ExpiresAt = &expiresAt
+	}
+	if err := validateAPIKeyOptions(opts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Generate API Key baru lalu simpan hash-nya ke database
+	rawAPIKey, storedRecord, err := createAPIKey(db, requestBody.ClientName, opts)
+	if errors.Is(err, errClientSuspended) {
+		http.Error(w, fmt.Sprintf("Klien '%s' sedang ditangguhkan; API Key baru tidak dapat dibuat.", requestBody.ClientName), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error membuat API Key untuk klien '%s': %v", requestBody.ClientName, err)
+		http.Error(w, "Gagal membuat API Key.", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("API Key baru dibuat untuk klien: %s, Prefix: %s", storedRecord.ClientName, storedRecord.KeyPrefix)
+	notifyKeyEvent(&storedRecord, webhookEventKeyCreated, map[string]interface{}{"expires_at": storedRecord.ExpiresAt, "scopes": storedRecord.Scopes})
+	if storedRecord.KeyType == apiKeyTypePublishable {
+		publishableOrigins.invalidate()
+	}
+
+	// Kirim API Key MENTAH ke klien. Ini adalah SATU-SATUNYA saat klien melihat kunci ini.
+	response := map[string]interface{}{
+		"message":               "API Key berhasil dibuat. Simpan kunci ini dengan aman!",
+		"client_id":             storedRecord.ClientID,
+		"client_name":           storedRecord.ClientName,
+		"api_key":               rawAPIKey, // Kunci mentah
+		"key_prefix":            storedRecord.KeyPrefix,
+		"scopes":                storedRecord.Scopes,
+		"allowed_routes":        storedRecord.AllowedRoutes,
+		"allowed_cidrs":         storedRecord.AllowedCIDRs,
+		"expires_at":            storedRecord.ExpiresAt,
+		"rate_limit_per_minute": storedRecord.RateLimitPerMinute,
+		"monthly_quota":         storedRecord.MonthlyQuota,
+		"quota_enforcement":     storedRecord.QuotaEnforcement,
+		"key_type":              storedRecord.KeyType,
+		"environment":           storedRecord.Environment,
+		"allowed_origins":       storedRecord.AllowedOrigins,
+	}
+	addSigningSecret(response, storedRecord)
+	writeJSON(w, http.StatusCreated, response)
+}
+
+// addSigningSecret menambahkan key ID dan signing secret untuk mode tanda tangan HMAC ke respons pembuatan
+// kunci. Kunci publishable tidak mendapat signing secret karena ditanam di kode front-end.
+func addSigningSecret(response map[string]interface{}, rec APIKeyRecord) {
+	if rec.KeyType == apiKeyTypePublishable {
+		return
+	}
+	response["key_id"] = rec.KeyPrefix
+	response["signing_secret"] = rec.SigningSecret
+}
+
+// parseGracePeriod membaca masa tenggang rotasi dalam format durasi Go (misalnya "24h", "90m").
+// String kosong menghasilkan defaultRotationGracePeriod.
+func parseGracePeriod(raw string) (time.Duration, error) {
+	if raw == "" {
+		return defaultRotationGracePeriod, nil
+	}
+	gracePeriod, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("grace_period '%s' tidak valid (contoh: \"24h\")", raw)
+	}
+	if gracePeriod < 0 || gracePeriod > maxRotationGracePeriod {
+		return 0, fmt.Errorf("grace_period harus antara 0 dan %s", maxRotationGracePeriod)
+	}
+	return gracePeriod, nil
+}
+
+// rotateKeyHandler menerbitkan kunci pengganti untuk API Key yang dipakai pada request ini.
+// Kunci lama tetap berlaku selama masa tenggang agar klien bisa berganti kunci tanpa downtime.
+func rotateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	apiKeyRecord, _ := apiKeyRecordFromContext(r.Context())
+	serveKeyRotation(w, r, apiKeyRecord)
+}
+
+// serveKeyRotation membaca grace_period opsional dari body, merotasi kunci, dan menulis respons berisi kunci baru.
+// Dipakai oleh rotasi mandiri (rotateKeyHandler) maupun rotasi oleh admin.
+func serveKeyRotation(w http.ResponseWriter, r *http.Request, apiKeyRecord *APIKeyRecord) {
+	var requestBody struct {
+		GracePeriod string `json:"grace_period"` // Opsional, misalnya "48h"
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+			http.Error(w, "Request body tidak valid.", http.StatusBadRequest)
+			return
+		}
+	}
+	gracePeriod, err := parseGracePeriod(requestBody.GracePeriod)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rawAPIKey, newKey, oldKey, err := rotateAPIKey(apiKeyRecord.ID, gracePeriod)
+	if err != nil {
+		if strings.Contains(err.Error(), "sudah dirotasi") {
+			http.Error(w, "API Key ini sudah dirotasi. Gunakan kunci penggantinya.", http.StatusConflict)
+			return
+		}
+		if strings.Contains(err.Error(), "tidak aktif") {
+			http.Error(w, "API Key tidak aktif dan tidak dapat dirotasi.", http.StatusConflict)
+			return
+		}
+		log.Printf("Error merotasi API Key '%s': %v", apiKeyRecord.KeyPrefix, err)
+		http.Error(w, "Gagal merotasi API Key.", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("API Key '%s' milik klien %s dirotasi menjadi '%s' (masa tenggang: %s)", oldKey.KeyPrefix, newKey.ClientName, newKey.KeyPrefix, gracePeriod)
+
+	response := map[string]interface{}{
+		"message":               "API Key pengganti berhasil dibuat. Simpan kunci ini dengan aman!",
+		"client_name":           newKey.ClientName,
+		"api_key":               rawAPIKey, // Kunci mentah
+		"key_prefix":            newKey.KeyPrefix,
+		"scopes":                newKey.Scopes,
+		"allowed_routes":        newKey.AllowedRoutes,
+		"allowed_cidrs":         newKey.AllowedCIDRs,
+		"expires_at":            newKey.ExpiresAt,
+		"old_key_prefix":        oldKey.KeyPrefix,
+		"old_key_deactivate_at": oldKey.DeactivateAt,
+	}
+	addSigningSecret(response, newKey)
+	writeJSON(w, http.StatusCreated, response)
+}
+
+// signingSecretHandler menerbitkan signing secret baru untuk kunci yang dipakai (POST) atau mencabutnya
+// (DELETE). Secret lama langsung tidak berlaku, dan secret baru hanya ditampilkan sekali di respons ini.
+// Dipakai oleh kunci lama yang belum punya signing secret, atau untuk mengganti secret yang bocor.
+func signingSecretHandler(w http.ResponseWriter, r *http.Request) {
+	apiKeyRecord, _ := apiKeyRecordFromContext(r.Context())
+	if apiKeyRecord.KeyType == apiKeyTypePublishable {
+		http.Error(w, "Kunci publishable tidak mendukung mode tanda tangan.", http.StatusForbidden)
+		return
+	}
+	revoke := r.Method == http.MethodDelete
+	secret, err := replaceSigningSecret(apiKeyRecord, revoke)
+	if err != nil {
+		log.Printf("Error mengganti signing secret API Key '%s': %v", apiKeyRecord.KeyPrefix, err)
+		http.Error(w, "Gagal mengganti signing secret.", http.StatusInternalServerError)
+		return
+	}
+	if revoke {
+		log.Printf("Signing secret API Key '%s' dicabut", apiKeyRecord.KeyPrefix)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"message": "Signing secret dicabut. Mode tanda tangan HMAC tidak dapat dipakai sampai secret baru diterbitkan.",
+			"key_id":  apiKeyRecord.KeyPrefix,
+		})
+		return
+	}
+	log.Printf("Signing secret baru diterbitkan untuk API Key '%s'", apiKeyRecord.KeyPrefix)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"message":        "Signing secret baru berhasil dibuat. Simpan secret ini dengan aman; secret tidak dapat ditampilkan lagi.",
+		"key_id":         apiKeyRecord.KeyPrefix,
+		"signing_secret": secret,
+	})
+}
+
+// --- Handler Admin ---
+// Semua handler di bawah ini dipasang di belakang adminAuthMiddleware.
+
+// adminAuthMiddleware mewajibkan API Key yang memiliki scope admin.
+func adminAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return apiKeyAuthMiddleware(requireScopes(adminScope)(next))
+}
+
+// writeJSON menulis respons JSON dengan status yang diberikan.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// adminListAPIKeysHandler menampilkan daftar API Key dengan filter query opsional:
+// client_name, client_id, prefix, active (true/false), limit, dan offset.
+func adminListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := APIKeyFilter{
+		ClientName: q.Get("client_name"),
+		KeyPrefix:  q.Get("prefix"),
+		Limit:      100,
+	}
+	if raw := q.Get("active"); raw != "" {
+		active, err := strconv.ParseBool(raw)
+		if err != nil {
+			http.Error(w, "Parameter 'active' harus true atau false.", http.StatusBadRequest)
+			return
+		}
+		filter.Active = &active
+	}
+	if raw := q.Get("client_id"); raw != "" {
+		clientID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || clientID < 1 {
+			http.Error(w, "Parameter 'client_id' tidak valid.", http.StatusBadRequest)
+			return
+		}
+		filter.ClientID = clientID
+	}
+	if raw := q.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > 1000 {
+			http.Error(w, "Parameter 'limit' harus antara 1 dan 1000.", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+	if raw := q.Get("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			http.Error(w, "Parameter 'offset' tidak valid.", http.StatusBadRequest)
+			return
+		}
+		filter.Offset = offset
+	}
+
+	keys, err := listAPIKeys(filter)
+	if err != nil {
+		log.Printf("Error mengambil daftar API Key: %v", err)
+		http.Error(w, "Gagal mengambil daftar API Key.", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"api_keys": keys,
+		"count":    len(keys),
+		"limit":    filter.Limit,
+		"offset":   filter.Offset,
+	})
+}
+
+// adminGetAPIKeyHandler menampilkan metadata satu API Key berdasarkan key_prefix.
+func adminGetAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	rec, err := findAPIKeyByPrefix(mux.Vars(r)["prefix"])
+	if err != nil {
+		writeAdminLookupError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rec)
+}
+
+// adminSetAPIKeyActiveHandler membuat handler untuk mencabut (active=false) atau mengaktifkan kembali (active=true) API Key.
+func adminSetAPIKeyActiveHandler(active bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keyPrefix := mux.Vars(r)["prefix"]
+		rec, err := setAPIKeyActive(keyPrefix, active)
+		if err != nil {
+			writeAdminLookupError(w, err)
+			return
+		}
+		admin, _ := apiKeyRecordFromContext(r.Context())
+		action := "dicabut"
+		if active {
+			action = "diaktifkan kembali"
+		}
+		log.Printf("API Key '%s' milik klien %s %s oleh admin %s", rec.KeyPrefix, rec.ClientName, action, admin.KeyPrefix)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"message": fmt.Sprintf("API Key '%s' berhasil %s.", rec.KeyPrefix, action),
+			"api_key": rec,
+		})
+	}
+}
+
+// adminRotateAPIKeyHandler merotasi API Key milik klien mana pun berdasarkan key_prefix.
+func adminRotateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	rec, err := findAPIKeyByPrefix(mux.Vars(r)["prefix"])
+	if err != nil {
+		writeAdminLookupError(w, err)
+		return
+	}
+	serveKeyRotation(w, r, rec)
+}
+
+// clientIDFromRequest membaca ID klien dari variabel rute {id}.
+func clientIDFromRequest(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("ID klien tidak valid")
+	}
+	return id, nil
+}
+
+// adminListClientsHandler menampilkan daftar klien dengan filter query opsional:
+// name, status (active/suspended), limit, dan offset.
+func adminListClientsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := ClientFilter{
+		Name:   q.Get("name"),
+		Status: q.Get("status"),
+		Limit:  100,
+	}
+	if filter.Status != "" && filter.Status != clientStatusActive && filter.Status != clientStatusSuspended {
+		http.Error(w, fmt.Sprintf("Parameter 'status' harus '%s' atau '%s'.", clientStatusActive, clientStatusSuspended), http.StatusBadRequest)
+		return
+	}
+	if raw := q.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > 1000 {
+			http.Error(w, "Parameter 'limit' harus antara 1 dan 1000.", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+	if raw := q.Get("offset"); raw != "" {
+		offset, err := strconv.Atoi(raw)
+		if err != nil || offset < 0 {
+			http.Error(w, "Parameter 'offset' tidak valid.", http.StatusBadRequest)
+			return
+		}
+		filter.Offset = offset
+	}
+
+	clients, err := listClients(filter)
+	if err != nil {
+		log.Printf("Error mengambil daftar klien: %v", err)
+		http.Error(w, "Gagal mengambil daftar klien.", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"clients": clients,
+		"count":   len(clients),
+		"limit":   filter.Limit,
+		"offset":  filter.Offset,
+	})
+}
+
+// adminCreateClientHandler membuat klien baru tanpa API Key; kunci ditambahkan lewat POST /admin/api-keys
+// dengan client_id klien ini.
+func adminCreateClientHandler(w http.ResponseWriter, r *http.Request) {
+	var requestBody struct {
+		Name         string            `json:"name"`
+		ContactEmail string            `json:"contact_email"` // Opsional
+		Metadata     map[string]string `json:"metadata"`      // Opsional, misalnya {"kontrak": "K-2024-01"}
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Request body tidak valid.", http.StatusBadRequest)
+		return
+	}
+	if err := validateClientName(requestBody.Name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	client, err := createClient(requestBody.Name, requestBody.ContactEmail, requestBody.Metadata)
+	if err != nil {
+		writeAdminLookupError(w, err)
+		return
 	}
-	log.Println("Tabel 'api_keys' siap atau sudah ada.")
+	admin, _ := apiKeyRecordFromContext(r.Context())
+	log.Printf("Klien '%s' (ID %d) dibuat oleh admin %s", client.Name, client.ID, admin.KeyPrefix)
+	writeJSON(w, http.StatusCreated, client)
 }
 
-// generateAPIKey menghasilkan string API Key yang aman secara kriptografis.
-// Format: PREFIX_RANDOMBYTES (misalnya, "sk_"... untuk secret key)
-// Mengembalikan API Key mentah dan prefix-nya.
-func generateAPIKey(prefix string, length int) (string, string, error) {
-	if length <= 0 {
-		length = 32 // Default length for random bytes
+// adminGetClientHandler menampilkan satu klien beserta semua API Key miliknya.
+func adminGetClientHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := clientIDFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	client, err := findClientByID(id)
+	if err != nil {
+		writeAdminLookupError(w, err)
+		return
 	}
-	randomBytes := make([]byte, length)
-	_, err := rand.Read(randomBytes)
+	keys, err := listAPIKeys(APIKeyFilter{ClientID: id, Limit: 1000})
 	if err != nil {
-		return "", "", fmt.Errorf("gagal menghasilkan byte acak: %w", err)
+		log.Printf("Error mengambil API Key klien ID %d: %v", id, err)
+		http.Error(w, "Gagal mengambil API Key klien.", http.StatusInternalServerError)
+		return
 	}
-	// Menggunakan base64 URL encoding untuk karakter yang aman di URL dan header
-	apiKey := prefix + "_" + base64.URLEncoding.EncodeToString(randomBytes)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"client":   client,
+		"api_keys": keys,
+	})
+}
 
-	// Ambil prefix dari API Key yang baru dibuat untuk disimpan
-	// Pastikan tidak melebihi panjang API Key itu sendiri
-	var keyPrefixForDB string
-	if len(apiKey) > apiKeyPrefixLength {
-		keyPrefixForDB = apiKey[:apiKeyPrefixLength]
-	} else {
-		keyPrefixForDB = apiKey
+// adminUpdateClientHandler mengubah nama, kontak, atau metadata klien. Field yang tidak dikirim tidak diubah.
+func adminUpdateClientHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := clientIDFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var requestBody struct {
+		Name         *string           `json:"name"`
+		ContactEmail *string           `json:"contact_email"`
+		Metadata     map[string]string `json:"metadata"` // Objek kosong {} menghapus metadata
 	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Request body tidak valid.", http.StatusBadRequest)
+		return
+	}
+	if requestBody.Name != nil {
+		if err := validateClientName(*requestBody.Name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	client, err := updateClient(id, ClientUpdate{
+		Name:         requestBody.Name,
+		ContactEmail: requestBody.ContactEmail,
+		Metadata:     requestBody.Metadata,
+	})
+	if err != nil {
+		writeAdminLookupError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, client)
+}
 
-	return apiKey, keyPrefixForDB, nil
+// adminSetClientSuspendedHandler membuat handler untuk menangguhkan (suspended=true) atau mengaktifkan
+// kembali (suspended=false) klien beserta semua API Key-nya.
+func adminSetClientSuspendedHandler(suspended bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := clientIDFromRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		client, affected, err := setClientSuspended(id, suspended)
+		if err != nil {
+			writeAdminLookupError(w, err)
+			return
+		}
+		admin, _ := apiKeyRecordFromContext(r.Context())
+		action := "diaktifkan kembali"
+		if suspended {
+			action = "ditangguhkan"
+		}
+		log.Printf("Klien '%s' (ID %d) %s oleh admin %s; %d API Key ikut berubah status", client.Name, client.ID, action, admin.KeyPrefix, affected)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"message":       fmt.Sprintf("Klien '%s' berhasil %s.", client.Name, action),
+			"client":        client,
+			"keys_affected": affected,
+		})
+	}
 }
 
-// hashAPIKey menghasilkan hash SHA256 dari API Key.
-func hashAPIKey(apiKey string) string {
-	hasher := sha256.New()
-	hasher.Write([]byte(apiKey))
-	return hex.EncodeToString(hasher.Sum(nil))
+// webhookFromRequest membaca ID klien dan ID webhook dari variabel rute lalu mencari webhook-nya.
+func webhookFromRequest(r *http.Request) (*ClientWebhook, error) {
+	clientID, err := clientIDFromRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	webhookID, err := strconv.ParseInt(mux.Vars(r)["webhookID"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("webhook dengan ID '%s' tidak ditemukan", mux.Vars(r)["webhookID"])
+	}
+	return findWebhook(clientID, webhookID)
 }
 
-// storeAPIKey menyimpan informasi klien beserta hash dari API Key ke database.
-// Mengembalikan APIKeyRecord tanpa hash.
-func storeAPIKey(clientName, apiKey, keyPrefixForDB string) (APIKeyRecord, error) {
-	apiKeyHash := hashAPIKey(apiKey)
+// adminListWebhooksHandler menampilkan semua webhook milik klien (tanpa secret).
+func adminListWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	clientID, err := clientIDFromRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := findClientByID(clientID); err != nil {
+		writeAdminLookupError(w, err)
+		return
+	}
+	webhooks, err := listWebhooks(clientID)
+	if err != nil {
+		log.Printf("Error mengambil webhook klien ID %d: %v", clientID, err)
+		http.Error(w, "Gagal mengambil daftar webhook.", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"webhooks": webhooks})
+}
 
-	result, err := db.Exec(
-		"INSERT INTO api_keys (client_name, key_prefix, api_key_hash, is_active) VALUES (?, ?, ?, ?)",
-		clientName, keyPrefixForDB, apiKeyHash, true,
-	)
+// adminCreateWebhookHandler mendaftarkan webhook untuk klien. Secret untuk memverifikasi tanda tangan
+// hanya ditampilkan sekali di respons ini.
+func adminCreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	clientID, err := clientIDFromRequest(r)
 	if err != nil {
-		if strings.Contains(err.Error(), "Duplicate entry") {
-			if strings.Contains(err.Error(), "'key_prefix'") {
-				return APIKeyRecord{}, fmt.Errorf("prefix kunci '%s' sudah digunakan, coba lagi: %w", keyPrefixForDB, err)
-			}
-			return APIKeyRecord{}, fmt.Errorf("hash kunci API sudah ada (kemungkinan tabrakan hash atau kunci duplikat): %w", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var requestBody struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"` // Opsional, kosong berarti semua event
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, "Request body tidak valid.", http.StatusBadRequest)
+		return
+	}
+	if err := validateWebhookURL(requestBody.URL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, event := range requestBody.Events {
+		if !isWebhookEventType(event) {
+			http.Error(w, fmt.Sprintf("Event '%s' tidak dikenal. Event yang tersedia: %s.", event, strings.Join(webhookEventTypes, ", ")), http.StatusBadRequest)
+			return
 		}
-		return APIKeyRecord{}, fmt.Errorf("gagal menyimpan API Key: %w", err)
 	}
 
-	id, err := result.LastInsertId()
+	wh, err := createWebhook(clientID, requestBody.URL, requestBody.Events)
 	if err != nil {
-		return APIKeyRecord{}, fmt.Errorf("gagal mendapatkan ID terakhir yang dimasukkan: %w", err)
+		writeAdminLookupError(w, err)
+		return
 	}
-
-	return APIKeyRecord{
-		ID:         id,
-		ClientName: clientName,
-		KeyPrefix:  keyPrefixForDB,
-		IsActive:   true,
-		CreatedAt:  time.Now(), // Waktu saat ini
-	}, nil
+	admin, _ := apiKeyRecordFromContext(r.Context())
+	log.Printf("Webhook %d untuk klien ID %d didaftarkan oleh admin %s", wh.ID, clientID, admin.KeyPrefix)
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"message": "Webhook berhasil didaftarkan. Simpan secret ini untuk memverifikasi tanda tangan!",
+		"webhook": wh,
+		"secret":  wh.Secret,
+	})
 }
 
-// validateAPIKey memeriksa apakah API Key yang diberikan valid dan aktif.
-// Mengembalikan record APIKey jika valid, atau error jika tidak.
-func validateAPIKey(apiKeyFromHeader string) (*APIKeyRecord, error) {
-	if apiKeyFromHeader == "" {
-		return nil, fmt.Errorf("API Key tidak boleh kosong")
+// adminDeleteWebhookHandler menonaktifkan webhook dan membatalkan event yang belum terkirim.
+func adminDeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	wh, err := webhookFromRequest(r)
+	if err != nil {
+		writeAdminLookupError(w, err)
+		return
 	}
+	if err := deactivateWebhook(wh.ClientID, wh.ID); err != nil {
+		writeAdminLookupError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	apiKeyHash := hashAPIKey(apiKeyFromHeader)
-
-	var apiKeyRec APIKeyRecord
-	var lastUsed sql.NullTime // Variabel untuk menampung last_used_at
-
-	row := db.QueryRow(
-		"SELECT id, client_name, key_prefix, api_key_hash, is_active, created_at, last_used_at FROM api_keys WHERE api_key_hash = ? AND is_active = TRUE",
-		apiKeyHash,
-	)
-	err := row.Scan(
-		&apiKeyRec.ID,
-		&apiKeyRec.ClientName,
-		&apiKeyRec.KeyPrefix,
-		&apiKeyRec.APIKeyHash, // Meskipun kita tidak membutuhkannya lagi, kita scan untuk konsistensi
-		&apiKeyRec.IsActive,
-		&apiKeyRec.CreatedAt,
-		&lastUsed, // Scan ke sql.NullTime
-	)
+// adminPingWebhookHandler mengirim event webhook.ping ke satu webhook untuk menguji penerimanya.
+func adminPingWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	wh, err := webhookFromRequest(r)
+	if err != nil {
+		writeAdminLookupError(w, err)
+		return
+	}
+	if !wh.IsActive {
+		http.Error(w, "Webhook tidak aktif.", http.StatusConflict)
+		return
+	}
+	if err := enqueueWebhookPing(wh); err != nil {
+		log.Printf("Error mencatat ping webhook %d: %v", wh.ID, err)
+		http.Error(w, "Gagal mencatat ping webhook.", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"message": fmt.Sprintf("Event %s dijadwalkan; lihat hasilnya di log pengiriman.", webhookEventPing),
+	})
+}
 
+// adminWebhookDeliveriesHandler menampilkan log pengiriman terbaru untuk satu webhook.
+func adminWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	wh, err := webhookFromRequest(r)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("API Key tidak valid atau tidak aktif")
-		}
-		return nil, fmt.Errorf("error saat memvalidasi API Key: %w", err)
+		writeAdminLookupError(w, err)
+		return
+	}
+	deliveries, err := listWebhookDeliveries(wh.ID, webhookDeliveryLogLimit)
+	if err != nil {
+		log.Printf("Error mengambil log pengiriman webhook %d: %v", wh.ID, err)
+		http.Error(w, "Gagal mengambil log pengiriman webhook.", http.StatusInternalServerError)
+		return
 	}
-	apiKeyRec.LastUsedAt = lastUsed // Tetapkan nilai yang discan
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"webhook":    wh,
+		"deliveries": deliveries,
+	})
+}
 
-	return &apiKeyRec, nil
+// writeAdminLookupError memetakan error pencarian API Key atau klien ke respons 404, 409, atau 500.
+func writeAdminLookupError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errClientSuspended) || errors.Is(err, errClientExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if strings.Contains(err.Error(), "tidak ditemukan") {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	log.Printf("Error admin API Key: %v", err)
+	http.Error(w, "Error internal server.", http.StatusInternalServerError)
 }
 
-// recordAPIKeyUsage memperbarui kolom last_used_at untuk API Key yang diberikan.
-func recordAPIKeyUsage(apiKeyID int64) error {
-	_, err := db.Exec("UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?", apiKeyID)
+// usageHandler menampilkan pemakaian dan kuota bulanan untuk API Key yang dipakai pada request ini.
+func usageHandler(w http.ResponseWriter, r *http.Request) {
+	apiKeyRecord, _ := apiKeyRecordFromContext(r.Context())
+	status, err := currentQuotaStatus(apiKeyRecord, time.Now())
 	if err != nil {
-		return fmt.Errorf("gagal mencatat penggunaan API Key: %w", err)
+		log.Printf("Error membaca pemakaian API Key ID %d: %v", apiKeyRecord.ID, err)
+		http.Error(w, "Gagal membaca pemakaian API Key.", http.StatusInternalServerError)
+		return
 	}
-	return nil
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"client_name": apiKeyRecord.ClientName,
+		"key_prefix":  apiKeyRecord.KeyPrefix,
+		"usage":       status,
+	})
 }
 
-// --- Middleware Autentikasi API Key ---
-
-func apiKeyAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		apiKey := r.Header.Get(apiKeyHeader)
-		if apiKey == "" {
-			log.Println("Upaya akses tanpa API Key.")
-			http.Error(w, "Akses Ditolak: API Key diperlukan.", http.StatusUnauthorized)
-			return
+// parseReportRange membaca parameter from/to (format YYYY-MM-DD, UTC) untuk laporan pemakaian.
+// Tanggal to bersifat inklusif; nilai kosong berarti default (usageReportDefaultDays hari terakhir
+// termasuk hari ini).
+func parseReportRange(rawFrom, rawTo string) (time.Time, time.Time, error) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	from := today.AddDate(0, 0, -(usageReportDefaultDays - 1))
+	to := today
+	var err error
+	if rawFrom != "" {
+		if from, err = time.Parse("2006-01-02", rawFrom); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("parameter 'from' harus berformat YYYY-MM-DD")
 		}
-
-		apiKeyRecord, err := validateAPIKey(apiKey)
-		if err != nil {
-			log.Printf("Upaya akses dengan API Key tidak valid ('%s'): %v", apiKey[:min(len(apiKey), 12)]+"...", err) // Log prefix kunci
-			http.Error(w, "Akses Ditolak: API Key tidak valid atau tidak aktif.", http.StatusForbidden)
-			return
+	}
+	if rawTo != "" {
+		if to, err = time.Parse("2006-01-02", rawTo); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("parameter 'to' harus berformat YYYY-MM-DD")
 		}
-
-		// API Key valid
-		log.Printf("Akses diberikan untuk klien: %s (ID Kunci: %d, Prefix: %s)", apiKeyRecord.ClientName, apiKeyRecord.ID, apiKeyRecord.KeyPrefix)
-
-		// Catat penggunaan API Key (bisa dijalankan sebagai goroutine jika tidak ingin memblokir)
-		go func(id int64) {
-			if err := recordAPIKeyUsage(id); err != nil {
-				log.Printf("Peringatan: Gagal mencatat penggunaan API Key untuk ID %d: %v", id, err)
-			}
-		}(apiKeyRecord.ID)
-
-		// Anda bisa menambahkan informasi klien ke context request jika diperlukan oleh handler selanjutnya
-		// ctx := context.WithValue(r.Context(), "clientName", apiKeyRecord.ClientName)
-		// next.ServeHTTP(w, r.WithContext(ctx))
-		next.ServeHTTP(w, r)
 	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("parameter 'to' tidak boleh sebelum 'from'")
+	}
+	if to.Sub(from) >= usageReportMaxDays*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("rentang laporan maksimum %d hari", usageReportMaxDays)
+	}
+	return from, to.AddDate(0, 0, 1), nil
 }
 
-// Fungsi utilitas min
-func min(a, b int) int {
-	if a < b {
-		return a
+// serveUsageReport menulis laporan pemakaian agregat untuk satu kunci.
+func serveUsageReport(w http.ResponseWriter, r *http.Request, apiKeyRecord *APIKeyRecord) {
+	from, to, err := parseReportRange(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	return b
+	report, err := usageReport(apiKeyRecord.ID, from, to)
+	if err != nil {
+		log.Printf("Error membuat laporan pemakaian untuk API Key ID %d: %v", apiKeyRecord.ID, err)
+		http.Error(w, "Gagal membuat laporan pemakaian.", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"client_name": apiKeyRecord.ClientName,
+		"key_prefix":  apiKeyRecord.KeyPrefix,
+		"from":        from.Format("2006-01-02"),
+		"to":          to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"rows":        report,
+	})
 }
 
-// --- Handler Rute ---
-
-// registerClientHandler menangani pembuatan API Key baru untuk klien.
-// PENTING: Endpoint ini idealnya harus diamankan (misalnya, hanya untuk admin).
-// Untuk contoh ini, kita biarkan terbuka.
-func registerClientHandler(w http.ResponseWriter, r *http.Request) {
-	var requestBody struct {
-		ClientName string `json:"client_name"`
-	}
+// usageReportHandler menampilkan laporan pemakaian untuk API Key yang dipakai pada request ini.
+func usageReportHandler(w http.ResponseWriter, r *http.Request) {
+	apiKeyRecord, _ := apiKeyRecordFromContext(r.Context())
+	serveUsageReport(w, r, apiKeyRecord)
+}
 
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "Request body tidak valid.", http.StatusBadRequest)
+// adminUsageReportHandler menampilkan laporan pemakaian untuk kunci mana pun berdasarkan key_prefix.
+func adminUsageReportHandler(w http.ResponseWriter, r *http.Request) {
+	rec, err := findAPIKeyByPrefix(mux.Vars(r)["prefix"])
+	if err != nil {
+		writeAdminLookupError(w, err)
 		return
 	}
+	serveUsageReport(w, r, rec)
+}
 
-	if requestBody.ClientName == "" {
-		http.Error(w, "Nama klien ('client_name') diperlukan.", http.StatusBadRequest)
+// leakedKeysReportHandler menerima laporan kunci yang bocor dari pelapor (misalnya program partner
+// secret scanning) berupa array JSON [{"token", "type", "url", "source"}]. Setiap token yang cocok dengan
+// API Key terdaftar dinonaktifkan dan dicatat sebagai insiden. Endpoint ini tidak memakai API Key, sehingga
+// body wajib ditandatangani dengan HMAC-SHA256 memakai LEAK_REPORT_SECRET; tanda tangan diperiksa sebelum
+// token apa pun di-hash atau dicari. Tanpa LEAK_REPORT_SECRET endpoint ini selalu membalas 503.
+func leakedKeysReportHandler(w http.ResponseWriter, r *http.Request) {
+	if leakReportSecret == "" {
+		http.Error(w, "Laporan kebocoran belum dikonfigurasi di server ini.", http.StatusServiceUnavailable)
 		return
 	}
-
-	// Generate API Key baru
-	// "myapp" adalah contoh prefix, Anda bisa membuatnya lebih dinamis atau tetap
-	rawAPIKey, keyPrefixForDB, err := generateAPIKey("myapp", 32) // 32 byte random menghasilkan ~43 char base64
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, leakReportMaxBodyBytes))
 	if err != nil {
-		log.Printf("Error menghasilkan API Key: %v", err)
-		http.Error(w, "Gagal menghasilkan API Key.", http.StatusInternalServerError)
+		http.Error(w, "Body laporan terlalu besar atau tidak dapat dibaca.", http.StatusBadRequest)
+		return
+	}
+	if !verifyLeakReportSignature(body, r.Header.Get(leakReportSignatureHeader)) {
+		log.Printf("Laporan kebocoran dengan tanda tangan tidak valid dari %s", r.RemoteAddr)
+		http.Error(w, "Tanda tangan laporan tidak valid.", http.StatusUnauthorized)
 		return
 	}
 
-	// Simpan API Key (hash-nya) ke database
-	// Loop kecil untuk menangani kemungkinan tabrakan prefix yang sangat jarang terjadi
-	var storedRecord APIKeyRecord
-	maxRetries := 3
-	for i := 0; i < maxRetries; i++ {
-		storedRecord, err = storeAPIKey(requestBody.ClientName, rawAPIKey, keyPrefixForDB)
-		if err == nil {
-			break // Berhasil disimpan
-		}
-		if strings.Contains(err.Error(), "prefix kunci") && i < maxRetries-1 {
-			log.Printf("Tabrakan prefix kunci, mencoba generate ulang (%d/%d)...", i+1, maxRetries)
-			rawAPIKey, keyPrefixForDB, err = generateAPIKey("myapp", 32) // Generate ulang
-			if err != nil {
-				log.Printf("Error menghasilkan API Key ulang: %v", err)
-				http.Error(w, "Gagal menghasilkan API Key ulang.", http.StatusInternalServerError)
-				return
-			}
-			continue
-		}
-		log.Printf("Error menyimpan API Key untuk klien '%s': %v", requestBody.ClientName, err)
-		http.Error(w, "Gagal menyimpan API Key.", http.StatusInternalServerError)
+	var reports []LeakedKeyReport
+	if err := json.Unmarshal(body, &reports); err != nil {
+		http.Error(w, "Body laporan harus berupa array JSON.", http.StatusBadRequest)
 		return
 	}
-	if err != nil { // Jika masih error setelah retry
-		log.Printf("Gagal menyimpan API Key setelah %d percobaan untuk klien '%s': %v", maxRetries, requestBody.ClientName, err)
-		http.Error(w, "Gagal menyimpan API Key setelah beberapa percobaan.", http.StatusInternalServerError)
+	if len(reports) == 0 || len(reports) > leakReportMaxTokens {
+		http.Error(w, fmt.Sprintf("Laporan harus berisi 1 sampai %d token.", leakReportMaxTokens), http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("API Key baru dibuat untuk klien: %s, Prefix: %s", storedRecord.ClientName, storedRecord.KeyPrefix)
-
-	// Kirim API Key MENTAH ke klien. Ini adalah SATU-SATUNYA saat klien melihat kunci ini.
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message":     "API Key berhasil dibuat. Simpan kunci ini dengan aman!",
-		"client_name": storedRecord.ClientName,
-		"api_key":     rawAPIKey, // Kunci mentah
-		"key_prefix":  storedRecord.KeyPrefix,
-	})
+	results := make([]LeakedKeyResult, 0, len(reports))
+	for _, report := range reports {
+		result, err := handleLeakedKey(report, r.RemoteAddr)
+		if err != nil {
+			log.Printf("Error memproses laporan kebocoran: %v", err)
+			http.Error(w, "Gagal memproses laporan kebocoran.", http.StatusInternalServerError)
+			return
+		}
+		results = append(results, result)
+	}
+	writeJSON(w, http.StatusOK, results)
 }
 
 // protectedResourceHandler adalah contoh endpoint yang dilindungi.
@@ -317,6 +5478,55 @@ func protectedResourceHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// reportsHandler adalah contoh endpoint baca yang membutuhkan scope "reports:read".
+func reportsHandler(w http.ResponseWriter, r *http.Request) {
+	apiKeyRecord, _ := apiKeyRecordFromContext(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Laporan untuk klien %s.", apiKeyRecord.ClientName),
+		"data": []map[string]interface{}{
+			{"id": 1, "report": "Penjualan Harian"},
+			{"id": 2, "report": "Stok Gudang"},
+		},
+	})
+}
+
+// sandboxReportsHandler adalah versi sandbox dari reportsHandler untuk kunci test: mengembalikan data contoh
+// yang tetap, bukan data produksi.
+func sandboxReportsHandler(w http.ResponseWriter, r *http.Request) {
+	apiKeyRecord, _ := apiKeyRecordFromContext(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Laporan SANDBOX untuk klien %s.", apiKeyRecord.ClientName),
+		"data": []map[string]interface{}{
+			{"id": 1, "report": "Contoh Laporan"},
+		},
+		"environment": apiKeyEnvironmentTest,
+	})
+}
+
+// createOrderHandler adalah contoh endpoint tulis yang membutuhkan scope "orders:write".
+func createOrderHandler(w http.ResponseWriter, r *http.Request) {
+	apiKeyRecord, _ := apiKeyRecordFromContext(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Pesanan berhasil dibuat oleh klien %s.", apiKeyRecord.ClientName),
+	})
+}
+
+// sandboxCreateOrderHandler adalah versi sandbox dari createOrderHandler: request divalidasi dan dijawab
+// seperti biasa, tetapi tidak ada pesanan yang benar-benar dibuat.
+func sandboxCreateOrderHandler(w http.ResponseWriter, r *http.Request) {
+	apiKeyRecord, _ := apiKeyRecordFromContext(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":     fmt.Sprintf("Pesanan SANDBOX diterima dari klien %s (tidak diproses).", apiKeyRecord.ClientName),
+		"environment": apiKeyEnvironmentTest,
+	})
+}
+
 // publicResourceHandler adalah contoh endpoint publik.
 func publicResourceHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -329,6 +5539,23 @@ func publicResourceHandler(w http.ResponseWriter, r *http.Request) {
 // --- Fungsi Main ---
 
 func main() {
+	// Muat pepper hash API Key sebelum kunci apa pun dibuat atau divalidasi
+	if err := loadAPIKeyPeppers(); err != nil {
+		log.Fatalf("Error konfigurasi pepper API Key: %v", err)
+	}
+	if err := loadTrustedProxies(); err != nil {
+		log.Fatalf("Error konfigurasi TRUSTED_PROXIES: %v", err)
+	}
+	if err := loadSigningEncryptionKey(); err != nil {
+		log.Fatalf("Error konfigurasi signing secret API Key: %v", err)
+	}
+	if err := loadWebhookTargetPolicy(); err != nil {
+		log.Fatalf("Error konfigurasi webhook: %v", err)
+	}
+	if webhookAllowPrivateTargets {
+		log.Println("Peringatan: WEBHOOK_ALLOW_PRIVATE_TARGETS aktif, webhook boleh mengarah ke loopback dan jaringan privat. Jangan gunakan di produksi.")
+	}
+
 	// Inisialisasi database
 	initDB()
 	defer func() {
@@ -345,13 +5572,24 @@ func main() {
 		if len(os.Args) > 2 {
 			clientName = os.Args[2] // Ambil nama klien dari argumen kedua jika ada
 		}
+		var opts APIKeyOptions
+		if len(os.Args) > 3 {
+			opts.Scopes = splitScopes(os.Args[3]) // Scope opsional dipisahkan koma, misalnya "reports:read,orders:write"
+		}
+		opts.Environment = apiKeyEnvironmentLive
+		if len(os.Args) > 4 {
+			opts.Environment = os.Args[4] // Lingkungan opsional: "live" (default) atau "test"
+		}
+		if err := validateAPIKeyOptions(opts); err != nil {
+			log.Fatalf("Opsi untuk initclient tidak valid: %v", err)
+		}
 
-		rawAPIKey, keyPrefixForDB, err := generateAPIKey("init", 32)
+		rawAPIKey, keyPrefixForDB, err := generateAPIKey(opts.Environment)
 		if err != nil {
 			log.Fatalf("Gagal generate API Key untuk initclient: %v", err)
 		}
 
-		_, err = storeAPIKey(clientName, rawAPIKey, keyPrefixForDB)
+		rec, err := storeAPIKey(clientName, rawAPIKey, keyPrefixForDB, opts)
 		if err != nil {
 			if strings.Contains(err.Error(), "sudah digunakan") || strings.Contains(err.Error(), "sudah ada") {
 				log.Printf("Klien '%s' atau API Key-nya mungkin sudah ada.", clientName)
@@ -360,11 +5598,58 @@ func main() {
 			}
 		} else {
 			log.Printf("API Key MENTAH untuk klien '%s' (prefix: %s) adalah: %s. SIMPAN INI!", clientName, keyPrefixForDB, rawAPIKey)
+			log.Printf("Signing secret untuk mode tanda tangan HMAC (key ID: %s) adalah: %s", rec.KeyPrefix, rec.SigningSecret)
 			log.Println("Ini hanya ditampilkan sekali saat inisialisasi.")
 		}
 		return // Keluar setelah inisialisasi
 	}
 
+	// Buat API Key admin (scope "admin") untuk mengakses endpoint /admin: go run main.go initadmin [nama]
+	if len(os.Args) > 1 && os.Args[1] == "initadmin" {
+		clientName := "Admin"
+		if len(os.Args) > 2 {
+			clientName = os.Args[2]
+		}
+		rawAPIKey, rec, err := createAPIKey(db, clientName, APIKeyOptions{Scopes: []string{adminScope}})
+		if err != nil {
+			log.Fatalf("Gagal membuat API Key admin: %v", err)
+		}
+		log.Printf("API Key ADMIN MENTAH untuk '%s' (prefix: %s) adalah: %s. SIMPAN INI!", rec.ClientName, rec.KeyPrefix, rawAPIKey)
+		log.Printf("Signing secret untuk mode tanda tangan HMAC (key ID: %s) adalah: %s", rec.KeyPrefix, rec.SigningSecret)
+		log.Println("Ini hanya ditampilkan sekali saat inisialisasi.")
+		return
+	}
+
+	// Perintah pengelolaan API Key dari command line, misalnya: go run main.go listkeys -active true
+	if len(os.Args) > 1 {
+		if cmd, ok := cliCommands[os.Args[1]]; ok {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				log.Fatalf("Perintah %s gagal: %v", os.Args[1], err)
+			}
+			return
+		}
+		if os.Args[1] == "help" {
+			printCLIHelp()
+			return
+		}
+	}
+
+	// Nonaktifkan kunci lama secara otomatis setelah masa tenggang rotasinya habis
+	startKeyDeactivationJob(keyDeactivationInterval)
+
+	// Tulis log request per batch di background dan hapus log yang melewati masa retensi
+	stopUsageLog, usageLogDone := make(chan struct{}), make(chan struct{})
+	go runUsageLogWriter(stopUsageLog, usageLogDone)
+	startUsageLogPruneJob(usageLogPruneInterval, usageLogRetentionDays)
+
+	// Tulis last_used_at dan penghitung kuota per batch di background
+	go apiKeyUsage.Run(usageWriterFlushInterval)
+
+	// Kirim event webhook dari outbox dan catat kunci yang mendekati kedaluwarsa
+	stopWebhooks, webhooksDone := make(chan struct{}), make(chan struct{})
+	go runWebhookDispatcher(stopWebhooks, webhooksDone)
+	startKeyExpiryNotificationJob(webhookExpiryCheckInterval)
+
 	// Router
 	r := mux.NewRouter()
 
@@ -373,20 +5658,62 @@ func main() {
 		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 			start := time.Now()
 			next.ServeHTTP(w, req)
-			log.Printf("[%s] %s %s %s", req.Method, req.RequestURI, req.RemoteAddr, time.Since(start))
+			log.Printf("[%s] %s %s %s", req.Method, redactAPIKeyQuery(req.RequestURI), req.RemoteAddr, time.Since(start))
 		})
 	})
 
 	// Rute
-	// Endpoint untuk registrasi klien dan mendapatkan API Key
-	r.HandleFunc("/register-client", registerClientHandler).Methods("POST")
+	// Endpoint admin untuk mengelola API Key (membutuhkan API Key dengan scope "admin")
+	r.HandleFunc("/admin/api-keys", adminAuthMiddleware(adminListAPIKeysHandler)).Methods("GET")
+	r.HandleFunc("/admin/api-keys", adminAuthMiddleware(registerClientHandler)).Methods("POST")
+	r.HandleFunc("/admin/api-keys/{prefix}", adminAuthMiddleware(adminGetAPIKeyHandler)).Methods("GET")
+	r.HandleFunc("/admin/api-keys/{prefix}/revoke", adminAuthMiddleware(adminSetAPIKeyActiveHandler(false))).Methods("POST")
+	r.HandleFunc("/admin/api-keys/{prefix}/reactivate", adminAuthMiddleware(adminSetAPIKeyActiveHandler(true))).Methods("POST")
+	r.HandleFunc("/admin/api-keys/{prefix}/rotate", adminAuthMiddleware(adminRotateAPIKeyHandler)).Methods("POST")
+	r.HandleFunc("/admin/api-keys/{prefix}/usage-report", adminAuthMiddleware(adminUsageReportHandler)).Methods("GET")
+	// Klien pemilik API Key; menangguhkan klien menonaktifkan semua kuncinya sekaligus
+	r.HandleFunc("/admin/clients", adminAuthMiddleware(adminListClientsHandler)).Methods("GET")
+	r.HandleFunc("/admin/clients", adminAuthMiddleware(adminCreateClientHandler)).Methods("POST")
+	r.HandleFunc("/admin/clients/{id:[0-9]+}", adminAuthMiddleware(adminGetClientHandler)).Methods("GET")
+	r.HandleFunc("/admin/clients/{id:[0-9]+}", adminAuthMiddleware(adminUpdateClientHandler)).Methods("PATCH")
+	r.HandleFunc("/admin/clients/{id:[0-9]+}/suspend", adminAuthMiddleware(adminSetClientSuspendedHandler(true))).Methods("POST")
+	r.HandleFunc("/admin/clients/{id:[0-9]+}/reactivate", adminAuthMiddleware(adminSetClientSuspendedHandler(false))).Methods("POST")
+	// Webhook event siklus hidup API Key per klien
+	r.HandleFunc("/admin/clients/{id:[0-9]+}/webhooks", adminAuthMiddleware(adminListWebhooksHandler)).Methods("GET")
+	r.HandleFunc("/admin/clients/{id:[0-9]+}/webhooks", adminAuthMiddleware(adminCreateWebhookHandler)).Methods("POST")
+	r.HandleFunc("/admin/clients/{id:[0-9]+}/webhooks/{webhookID:[0-9]+}", adminAuthMiddleware(adminDeleteWebhookHandler)).Methods("DELETE")
+	r.HandleFunc("/admin/clients/{id:[0-9]+}/webhooks/{webhookID:[0-9]+}/ping", adminAuthMiddleware(adminPingWebhookHandler)).Methods("POST")
+	r.HandleFunc("/admin/clients/{id:[0-9]+}/webhooks/{webhookID:[0-9]+}/deliveries", adminAuthMiddleware(adminWebhookDeliveriesHandler)).Methods("GET")
+	// Metrik proses (expvar), termasuk metrik penulis pemakaian API Key
+	r.HandleFunc("/admin/metrics", adminAuthMiddleware(expvar.Handler().ServeHTTP)).Methods("GET")
+
+	// Endpoint untuk pelapor kunci yang bocor (tanpa API Key, tanda tangan opsional)
+	r.HandleFunc("/security/leaked-keys", leakedKeysReportHandler).Methods("POST")
 
 	// Endpoint publik
 	r.HandleFunc("/api/public-resource", publicResourceHandler).Methods("GET")
 
-	// Endpoint yang dilindungi API Key
+	// Endpoint yang dilindungi API Key. "OPTIONS" didaftarkan agar preflight CORS untuk kunci publishable
+	// sampai ke apiKeyAuthMiddleware.
 	// Cara 1: Menerapkan middleware langsung ke handler
-	r.HandleFunc("/api/protected-resource", apiKeyAuthMiddleware(protectedResourceHandler)).Methods("GET")
+	r.HandleFunc("/api/protected-resource", apiKeyAuthMiddleware(protectedResourceHandler)).Methods("GET", "OPTIONS")
+
+	// Endpoint yang selain API Key juga membutuhkan scope tertentu. Kunci test diarahkan ke handler sandbox.
+	// Laporan juga menerima parameter query api_key, misalnya untuk link unduhan yang dibuka langsung di browser
+	reportsAuth := apiKeyAuthMiddlewareFrom(apiKeySourceAuthorization, apiKeySourceHeader, apiKeySourceQuery)
+	r.HandleFunc("/api/reports", acceptsTestKeys(reportsAuth(requireScopes("reports:read")(envHandler(reportsHandler, sandboxReportsHandler))))).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/orders", acceptsTestKeys(apiKeyAuthMiddleware(requireScopes("orders:write")(envHandler(createOrderHandler, sandboxCreateOrderHandler))))).Methods("POST", "OPTIONS")
+
+	// Endpoint rotasi: klien menukar kunci yang sedang dipakai dengan kunci pengganti
+	r.HandleFunc("/api/keys/rotate", apiKeyAuthMiddleware(rotateKeyHandler)).Methods("POST")
+
+	// Endpoint untuk menerbitkan ulang atau mencabut signing secret mode tanda tangan HMAC bagi kunci yang dipakai
+	r.HandleFunc("/api/keys/signing-secret", apiKeyAuthMiddleware(signingSecretHandler)).Methods("POST", "DELETE")
+
+	// Endpoint pemakaian dan sisa kuota bulanan untuk kunci yang dipakai. Hanya membaca data kunci itu sendiri,
+	// sehingga kunci test juga diterima
+	r.HandleFunc("/api/usage", acceptsTestKeys(apiKeyAuthMiddleware(usageHandler))).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/usage/report", acceptsTestKeys(apiKeyAuthMiddleware(usageReportHandler))).Methods("GET", "OPTIONS")
 
 	// Cara 2: Membuat subrouter dan menerapkan middleware ke subrouter (jika punya banyak endpoint terproteksi)
 	// apiProtected := r.PathPrefix("/api/v2").Subrouter()
@@ -400,7 +5727,12 @@ func main() {
 
 	port := "8080" // Port server Go
 	log.Printf("Server Go berjalan di http://localhost:%s", port)
-	log.Println("Gunakan 'go run main.go initclient [NamaKlienOpsional]' untuk membuat API Key awal jika diperlukan.")
+	log.Println("Gunakan 'go run main.go initclient [NamaKlienOpsional] [scope1,scope2] [live|test]' untuk membuat API Key awal jika diperlukan, atau 'go run main.go help' untuk daftar perintah pengelolaan API Key.")
+	log.Println("Gunakan 'go run main.go initadmin [nama]' untuk membuat API Key admin untuk endpoint /admin.")
+	log.Println("Gunakan 'go run main.go rotatekey <key_prefix> [masa_tenggang]' untuk merotasi API Key.")
+	if leakReportSecret == "" {
+		log.Println("Peringatan: LEAK_REPORT_SECRET tidak diset, /security/leaked-keys menolak semua laporan (503).")
+	}
 
 	// Mulai server HTTP
 	srv := &http.Server{
@@ -410,5 +5742,35 @@ func main() {
 		ReadTimeout:  15 * time.Second,
 	}
 
-	log.Fatal(srv.ListenAndServe())
+	// Jalankan server sampai menerima SIGINT/SIGTERM, lalu shutdown dengan rapi agar pemakaian
+	// yang masih tertunda di memori sempat ditulis ke database
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	case <-ctx.Done():
+		log.Println("Menerima sinyal berhenti, mematikan server...")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Peringatan: Shutdown server tidak selesai dengan rapi: %v", err)
+		}
+	}
+
+	// Request yang sedang berjalan sudah selesai; tulis sisa pemakaian dan log request
+	apiKeyUsage.Stop()
+	close(stopUsageLog)
+	<-usageLogDone
+	close(stopWebhooks)
+	<-webhooksDone
+	log.Println("Server berhenti.")
 }
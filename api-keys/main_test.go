@@ -0,0 +1,747 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// useMockDB mengganti koneksi database global dengan sqlmock selama satu test.
+func useMockDB(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	previous := db
+	db = mockDB
+	t.Cleanup(func() {
+		db = previous
+		mockDB.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("ekspektasi sqlmock tidak terpenuhi: %v", err)
+		}
+	})
+	return mock
+}
+
+func int64Ptr(v int64) *int64 { return &v }
+
+// usePeppers memuat pepper API Key khusus test selama test berjalan.
+func usePeppers(t *testing.T) {
+	t.Helper()
+	previousPeppers, previousVersion := apiKeyPeppers, currentAPIKeyHashVersion
+	t.Setenv("API_KEY_PEPPERS", "1:pepper-test-lama,2:pepper-test-baru")
+	if err := loadAPIKeyPeppers(); err != nil {
+		t.Fatalf("loadAPIKeyPeppers: %v", err)
+	}
+	t.Cleanup(func() { apiKeyPeppers, currentAPIKeyHashVersion = previousPeppers, previousVersion })
+}
+
+// useSigningEncryptionKey memasang kunci enkripsi secret khusus test selama test berjalan.
+func useSigningEncryptionKey(t *testing.T) {
+	t.Helper()
+	previous := apiKeySigningEncryptionKey
+	apiKeySigningEncryptionKey = make([]byte, 32)
+	t.Cleanup(func() { apiKeySigningEncryptionKey = previous })
+}
+
+func TestLoadAPIKeyPeppers(t *testing.T) {
+	usePeppers(t)
+	if currentAPIKeyHashVersion != 2 {
+		t.Errorf("versi pepper terbaru = %d, ingin 2", currentAPIKeyHashVersion)
+	}
+	for name, value := range map[string]string{
+		"tidak diset":     "",
+		"tanpa versi":     "pepper",
+		"versi 0":         "0:pepper",
+		"pepper kosong":   "1:",
+		"versi bukan int": "satu:pepper",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv("API_KEY_PEPPERS", value)
+			if err := loadAPIKeyPeppers(); err == nil {
+				t.Errorf("API_KEY_PEPPERS=%q seharusnya ditolak", value)
+			}
+		})
+	}
+}
+
+func TestConsumeQuota(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	const upsert = "INSERT INTO api_key_usage_periods"
+	const selectCount = "SELECT request_count FROM api_key_usage_periods"
+
+	tests := []struct {
+		name        string
+		enforcement string
+		quota       int64
+		setup       func(mock sqlmock.Sqlmock)
+		wantCount   int64
+		wantCounted bool
+		wantExceed  bool
+	}{
+		{
+			name:        "baris baru",
+			enforcement: quotaEnforcementHard,
+			quota:       5,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(upsert).WithArgs(int64(1), "2026-10", int64(5)).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+			wantCount:   1,
+			wantCounted: true,
+		},
+		{
+			name:        "baris dinaikkan",
+			enforcement: quotaEnforcementHard,
+			quota:       5,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(upsert).WithArgs(int64(1), "2026-10", int64(5)).WillReturnResult(sqlmock.NewResult(5, 2))
+			},
+			wantCount:   5,
+			wantCounted: true,
+			wantExceed:  true,
+		},
+		{
+			name:        "kuota hard habis",
+			enforcement: quotaEnforcementHard,
+			quota:       5,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(upsert).WithArgs(int64(1), "2026-10", int64(5)).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(selectCount).WithArgs(int64(1), "2026-10").WillReturnRows(sqlmock.NewRows([]string{"request_count"}).AddRow(5))
+			},
+			wantCount:  5,
+			wantExceed: true,
+		},
+		{
+			name:        "kuota hard nol tidak menulis",
+			enforcement: quotaEnforcementHard,
+			quota:       0,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(selectCount).WithArgs(int64(1), "2026-10").WillReturnRows(sqlmock.NewRows([]string{"request_count"}))
+			},
+			wantCount:  0,
+			wantExceed: true,
+		},
+		{
+			name:        "kuota soft tetap dihitung",
+			enforcement: quotaEnforcementSoft,
+			quota:       5,
+			setup: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(upsert).WithArgs(int64(1), "2026-10", int64(math.MaxInt64)).WillReturnResult(sqlmock.NewResult(9, 2))
+			},
+			wantCount:   9,
+			wantCounted: true,
+			wantExceed:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup(useMockDB(t))
+			rec := &APIKeyRecord{ID: 1, MonthlyQuota: int64Ptr(tt.quota), QuotaEnforcement: tt.enforcement}
+			status, counted, err := consumeQuota(rec, now)
+			if err != nil {
+				t.Fatalf("consumeQuota: %v", err)
+			}
+			if counted != tt.wantCounted || status.RequestCount != tt.wantCount || status.Exceeded != tt.wantExceed {
+				t.Errorf("hasil = (count %d, counted %t, exceeded %t), ingin (count %d, counted %t, exceeded %t)",
+					status.RequestCount, counted, status.Exceeded, tt.wantCount, tt.wantCounted, tt.wantExceed)
+			}
+		})
+	}
+}
+
+func TestLeakedKeysReportHandlerRequiresSignature(t *testing.T) {
+	body := `[{"token":"ak_live_SXHceTefGS5lFOu2GmBRNAGPWMnD2H0XYHEQ","type":"api_key"}]`
+	mac := hmac.New(sha256.New, []byte("rahasia-pelapor"))
+	mac.Write([]byte(body))
+	validSignature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name       string
+		secret     string
+		signature  string
+		wantStatus int
+	}{
+		{name: "secret tidak diset", secret: "", signature: validSignature, wantStatus: http.StatusServiceUnavailable},
+		{name: "tanpa tanda tangan", secret: "rahasia-pelapor", signature: "", wantStatus: http.StatusUnauthorized},
+		{name: "tanda tangan salah", secret: "rahasia-pelapor", signature: "sha256=" + strings.Repeat("00", 32), wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Tidak ada ekspektasi query: laporan yang ditolak tidak boleh menyentuh database.
+			useMockDB(t)
+			previous := leakReportSecret
+			leakReportSecret = tt.secret
+			t.Cleanup(func() { leakReportSecret = previous })
+
+			req := httptest.NewRequest(http.MethodPost, "/security/leaked-keys", strings.NewReader(body))
+			req.Header.Set(leakReportSignatureHeader, tt.signature)
+			rec := httptest.NewRecorder()
+			leakedKeysReportHandler(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, ingin %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestSigningSecretEncryption(t *testing.T) {
+	useSigningEncryptionKey(t)
+
+	secret, enc, err := newSigningSecret("ak_live_SXHceTef")
+	if err != nil {
+		t.Fatalf("newSigningSecret: %v", err)
+	}
+	if len(secret) != 2*signingSecretBytes {
+		t.Errorf("panjang secret = %d, ingin %d", len(secret), 2*signingSecretBytes)
+	}
+	if strings.Contains(string(enc), secret) {
+		t.Error("secret tersimpan tanpa enkripsi")
+	}
+
+	got, err := decryptSigningSecret(&APIKeyRecord{KeyPrefix: "ak_live_SXHceTef", SigningSecretEnc: enc})
+	if err != nil || got != secret {
+		t.Errorf("decryptSigningSecret = (%q, %v), ingin (%q, nil)", got, err, secret)
+	}
+	// Ciphertext yang dipindahkan ke baris kunci lain tidak boleh bisa didekripsi
+	if _, err := decryptSigningSecret(&APIKeyRecord{KeyPrefix: "ak_live_LainLain", SigningSecretEnc: enc}); err == nil {
+		t.Error("decryptSigningSecret berhasil untuk key_prefix yang berbeda")
+	}
+	if _, err := decryptSigningSecret(&APIKeyRecord{KeyPrefix: "ak_live_SXHceTef"}); !errors.Is(err, errSignatureInvalid) {
+		t.Errorf("kunci tanpa signing secret: error = %v, ingin errSignatureInvalid", err)
+	}
+
+	other, _, err := newSigningSecret("ak_live_SXHceTef")
+	if err != nil || other == secret {
+		t.Error("dua signing secret untuk kunci yang sama tidak boleh identik")
+	}
+}
+
+func TestAPIKeyAuthMiddlewareRejectsTestKeysByDefault(t *testing.T) {
+	usePeppers(t)
+	rawAPIKey, keyPrefix, err := generateAPIKey(apiKeyEnvironmentTest)
+	if err != nil {
+		t.Fatalf("generateAPIKey: %v", err)
+	}
+	noLimit := 0
+	rec := &APIKeyRecord{ID: 42, ClientName: "Sandbox", KeyPrefix: keyPrefix, IsActive: true, Environment: apiKeyEnvironmentTest, KeyType: apiKeyTypeSecret, RateLimitPerMinute: &noLimit}
+	hash := hashAPIKey(rawAPIKey)
+	validAPIKeyCache.set(hash, rec, time.Now())
+	t.Cleanup(func() { invalidateAPIKeyCache(hash, keyPrefix) })
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		wantStatus int
+	}{
+		{name: "rute tanpa penanda", handler: apiKeyAuthMiddleware(ok), wantStatus: http.StatusForbidden},
+		{name: "rute acceptsTestKeys", handler: acceptsTestKeys(apiKeyAuthMiddleware(ok)), wantStatus: http.StatusNoContent},
+		{name: "envHandler tanpa sandbox", handler: acceptsTestKeys(apiKeyAuthMiddleware(envHandler(ok, nil))), wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/usage", nil)
+			req.Header.Set("X-API-Key", rawAPIKey)
+			w := httptest.NewRecorder()
+			tt.handler(w, req)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, ingin %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestStoreAPIKeyRejectsSuspendedClient(t *testing.T) {
+	usePeppers(t)
+	useSigningEncryptionKey(t)
+	mock := useMockDB(t)
+
+	// Klien masih aktif saat dibaca, tetapi sudah ditangguhkan ketika INSERT ... SELECT berjalan
+	mock.ExpectExec("INSERT IGNORE INTO api_clients").WithArgs("Mitra").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT .+ FROM api_clients WHERE name = \\?").WithArgs("Mitra").WillReturnRows(
+		sqlmock.NewRows(strings.Split(clientSelectColumns, ", ")).AddRow(7, "Mitra", "", clientStatusActive, nil, time.Now(), time.Now(), nil),
+	)
+	mock.ExpectExec("INSERT INTO api_keys .+ SELECT id, name, .+ FROM api_clients WHERE id = \\? AND status = \\? LOCK IN SHARE MODE").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	_, err := storeAPIKey("Mitra", "ak_live_rahasia", "ak_live_SXHceTef", APIKeyOptions{})
+	if !errors.Is(err, errClientSuspended) {
+		t.Errorf("error = %v, ingin errClientSuspended", err)
+	}
+}
+
+func TestLookupAPIKeyByHashRejectsSuspendedClient(t *testing.T) {
+	usePeppers(t)
+	mock := useMockDB(t)
+	candidates := apiKeyHashCandidates("ak_live_rahasia")
+
+	args := make([]driver.Value, 0, len(candidates)+1)
+	for _, hash := range candidates {
+		args = append(args, hash)
+	}
+	args = append(args, clientStatusSuspended)
+	mock.ExpectQuery("AND is_active = TRUE AND NOT EXISTS \\(SELECT 1 FROM api_clients WHERE api_clients.id = api_keys.client_id AND api_clients.status = \\?\\)").
+		WithArgs(args...).WillReturnRows(sqlmock.NewRows(strings.Split(apiKeySelectColumns, ", ")))
+
+	if _, err := lookupAPIKeyByHash("ak_live_rahasia", candidates); !errors.Is(err, errAPIKeyInvalid) {
+		t.Errorf("error = %v, ingin errAPIKeyInvalid", err)
+	}
+}
+
+func TestCheckAPIKeyFormat(t *testing.T) {
+	head := "ak_live_"
+	random := strings.Repeat("A1b2C3", 5) // 30 karakter base62
+	valid := head + random + apiKeyChecksum(head+random)
+	generated, _, err := generateAPIKey(apiKeyEnvironmentTest)
+	if err != nil {
+		t.Fatalf("generateAPIKey: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		apiKey  string
+		wantErr bool
+	}{
+		{name: "format baru valid", apiKey: valid},
+		{name: "hasil generateAPIKey", apiKey: generated},
+		{name: "checksum salah", apiKey: head + random + "000000", wantErr: true},
+		{name: "satu karakter acak diubah", apiKey: head + "B" + random[1:] + apiKeyChecksum(head+random), wantErr: true},
+		{name: "lingkungan tidak dikenal", apiKey: "ak_prod_" + random + apiKeyChecksum("ak_prod_"+random), wantErr: true},
+		{name: "terlalu pendek", apiKey: valid[:len(valid)-1], wantErr: true},
+		{name: "karakter non-base62", apiKey: head + "-" + random[1:] + apiKeyChecksum(head+"-"+random[1:]), wantErr: true},
+		{name: "format lama valid", apiKey: "myapp_" + base64.URLEncoding.EncodeToString(make([]byte, legacyAPIKeyRandomBytes))},
+		{name: "format lama tanpa label", apiKey: "_" + base64.URLEncoding.EncodeToString(make([]byte, legacyAPIKeyRandomBytes)), wantErr: true},
+		{name: "format lama panjang salah", apiKey: "myapp_" + base64.URLEncoding.EncodeToString(make([]byte, 16)), wantErr: true},
+		{name: "kosong", apiKey: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAPIKeyFormat(tt.apiKey)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkAPIKeyFormat(%q) error = %v, ingin error %t", tt.apiKey, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIPAllowed(t *testing.T) {
+	tests := []struct {
+		name  string
+		cidrs []string
+		ip    string
+		want  bool
+	}{
+		{name: "tanpa pembatasan", cidrs: nil, ip: "198.51.100.7", want: true},
+		{name: "IPv4 di dalam rentang", cidrs: []string{"203.0.113.0/24"}, ip: "203.0.113.200", want: true},
+		{name: "IPv4 di luar rentang", cidrs: []string{"203.0.113.0/24"}, ip: "203.0.114.1", want: false},
+		{name: "alamat tunggal", cidrs: []string{"198.51.100.7"}, ip: "198.51.100.7", want: true},
+		{name: "alamat tunggal lain", cidrs: []string{"198.51.100.7"}, ip: "198.51.100.8", want: false},
+		{name: "IPv4-mapped IPv6 dari klien", cidrs: []string{"203.0.113.0/24"}, ip: "::ffff:203.0.113.9", want: true},
+		{name: "CIDR IPv4-mapped", cidrs: []string{"::ffff:203.0.113.0/120"}, ip: "203.0.113.9", want: true},
+		{name: "IPv6 di dalam rentang", cidrs: []string{"2001:db8::/32"}, ip: "2001:db8:1::1", want: true},
+		{name: "IPv6 di luar rentang", cidrs: []string{"2001:db8::/32"}, ip: "2001:db9::1", want: false},
+		{name: "salah satu dari beberapa", cidrs: []string{"10.0.0.0/8", "192.168.0.0/16"}, ip: "192.168.5.5", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ipAllowed(tt.cidrs, netip.MustParseAddr(tt.ip)); got != tt.want {
+				t.Errorf("ipAllowed(%v, %s) = %t, ingin %t", tt.cidrs, tt.ip, got, tt.want)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"203.0.113.0/33", "bukan-ip", "::ffff:1.2.3.4/64"} {
+		if _, err := parseCIDR(invalid); err == nil {
+			t.Errorf("parseCIDR(%q) seharusnya gagal", invalid)
+		}
+	}
+}
+
+func TestOriginAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		host     string
+		want     bool
+	}{
+		{name: "host persis", patterns: []string{"app.contoh.com"}, host: "app.contoh.com", want: true},
+		{name: "huruf besar dinormalkan", patterns: []string{"app.contoh.com"}, host: "APP.Contoh.com", want: true},
+		{name: "wildcard subdomain", patterns: []string{"*.contoh.com"}, host: "app.contoh.com", want: true},
+		{name: "wildcard subdomain bertingkat", patterns: []string{"*.contoh.com"}, host: "a.b.contoh.com", want: true},
+		{name: "wildcard tidak cocok domain induk", patterns: []string{"*.contoh.com"}, host: "contoh.com", want: false},
+		{name: "wildcard tidak cocok akhiran serupa", patterns: []string{"*.contoh.com"}, host: "evilcontoh.com", want: false},
+		{name: "port berbeda", patterns: []string{"localhost:3000"}, host: "localhost:3001", want: false},
+		{name: "pola tanpa port", patterns: []string{"app.contoh.com"}, host: "app.contoh.com:8443", want: false},
+		{name: "daftar kosong", patterns: nil, host: "app.contoh.com", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := originAllowed(tt.patterns, tt.host); got != tt.want {
+				t.Errorf("originAllowed(%v, %q) = %t, ingin %t", tt.patterns, tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalSignedRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		want   string
+	}{
+		{
+			name:   "query diurutkan",
+			method: http.MethodGet,
+			target: "/api/reports?b=2&a=1",
+			want:   "GET\n/api/reports\na=1&b=2\ndigest\n1700000000\nnonce",
+		},
+		{
+			name:   "path tetap ter-escape",
+			method: http.MethodPost,
+			target: "/api/orders/buku%20tulis",
+			want:   "POST\n/api/orders/buku%20tulis\n\ndigest\n1700000000\nnonce",
+		},
+		{
+			name:   "nilai query di-encode ulang",
+			method: http.MethodGet,
+			target: "/api/reports?q=a+b&q=c",
+			want:   "GET\n/api/reports\nq=a+b&q=c\ndigest\n1700000000\nnonce",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if got := canonicalSignedRequest(req, "digest", "1700000000", "nonce"); got != tt.want {
+				t.Errorf("canonicalSignedRequest = %q, ingin %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryRateLimitStoreTake(t *testing.T) {
+	store := &memoryRateLimitStore{buckets: make(map[int64]*tokenBucket)}
+	limit := RateLimit{Requests: 3, Window: time.Minute} // Satu token setiap 20 detik
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		name          string
+		at            time.Duration
+		wantAllowed   bool
+		wantRemaining int
+		wantRetry     time.Duration
+	}{
+		{name: "bucket baru penuh", at: 0, wantAllowed: true, wantRemaining: 2},
+		{name: "token kedua", at: 0, wantAllowed: true, wantRemaining: 1},
+		{name: "token ketiga", at: 0, wantAllowed: true, wantRemaining: 0},
+		{name: "bucket kosong", at: 0, wantAllowed: false, wantRemaining: 0, wantRetry: 20 * time.Second},
+		{name: "setengah token terisi", at: 10 * time.Second, wantAllowed: false, wantRemaining: 0, wantRetry: 10 * time.Second},
+		{name: "satu token terisi", at: 20 * time.Second, wantAllowed: true, wantRemaining: 0},
+		{name: "terisi penuh tidak melebihi kapasitas", at: 10 * time.Minute, wantAllowed: true, wantRemaining: 2},
+	}
+	for _, step := range steps {
+		result, err := store.Take(1, limit, start.Add(step.at))
+		if err != nil {
+			t.Fatalf("%s: Take: %v", step.name, err)
+		}
+		if result.Allowed != step.wantAllowed || result.Remaining != step.wantRemaining || result.RetryAfter != step.wantRetry {
+			t.Errorf("%s: hasil = (allowed %t, remaining %d, retry %s), ingin (allowed %t, remaining %d, retry %s)",
+				step.name, result.Allowed, result.Remaining, result.RetryAfter, step.wantAllowed, step.wantRemaining, step.wantRetry)
+		}
+	}
+
+	// Batas yang diturunkan langsung memotong token yang tersisa
+	result, _ := store.Take(1, RateLimit{Requests: 1, Window: time.Minute}, start.Add(10*time.Minute))
+	if !result.Allowed || result.Remaining != 0 || result.ResetAfter != time.Minute {
+		t.Errorf("setelah batas diturunkan: hasil = %+v", result)
+	}
+
+	// Bucket tiap kunci terpisah
+	if result, _ := store.Take(2, limit, start); !result.Allowed || result.Remaining != 2 {
+		t.Errorf("bucket kunci lain ikut terpakai: %+v", result)
+	}
+}
+
+// webhookReceiver adalah penerima webhook httptest yang membalas dengan status yang ditentukan dan
+// menyimpan request terakhir yang diterimanya.
+type webhookReceiver struct {
+	*httptest.Server
+	status int
+	header http.Header
+	body   []byte
+	calls  int
+	mu     sync.Mutex
+}
+
+func newWebhookReceiver(t *testing.T, status int) *webhookReceiver {
+	t.Helper()
+	rcv := &webhookReceiver{status: status}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rcv.mu.Lock()
+		rcv.header, rcv.body = r.Header.Clone(), body
+		rcv.calls++
+		rcv.mu.Unlock()
+		w.WriteHeader(rcv.status)
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+func TestDeliverWebhookSignature(t *testing.T) {
+	rcv := newWebhookReceiver(t, http.StatusNoContent)
+	job := webhookJob{outboxID: 7, webhookID: 3, eventType: webhookEventKeyRotated, payload: []byte(`{"event":"api_key.rotated"}`), url: rcv.URL, secret: "rahasia-webhook"}
+	now := time.Unix(1760600000, 0)
+
+	status, err := deliverWebhook(rcv.Client(), job, now)
+	if err != nil || status != http.StatusNoContent {
+		t.Fatalf("deliverWebhook = (%d, %v), ingin (204, nil)", status, err)
+	}
+	if string(rcv.body) != string(job.payload) {
+		t.Errorf("body = %s, ingin %s", rcv.body, job.payload)
+	}
+	if got := rcv.header.Get(webhookTimestampHeader); got != "1760600000" {
+		t.Errorf("%s = %q, ingin %q", webhookTimestampHeader, got, "1760600000")
+	}
+	if got := rcv.header.Get(webhookIDHeader); got != "7" {
+		t.Errorf("%s = %q, ingin %q", webhookIDHeader, got, "7")
+	}
+	if got := rcv.header.Get(webhookEventHeader); got != webhookEventKeyRotated {
+		t.Errorf("%s = %q, ingin %q", webhookEventHeader, got, webhookEventKeyRotated)
+	}
+
+	// Verifikasi seperti yang dilakukan penerima: HMAC-SHA256(secret, timestamp + "." + body)
+	mac := hmac.New(sha256.New, []byte(job.secret))
+	mac.Write([]byte("1760600000." + string(rcv.body)))
+	if got, want := rcv.header.Get(webhookSignatureHeader), "v1="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("%s = %q, ingin %q", webhookSignatureHeader, got, want)
+	}
+
+	rcv.status = http.StatusBadGateway
+	if status, err := deliverWebhook(rcv.Client(), job, now); err == nil || status != http.StatusBadGateway {
+		t.Errorf("deliverWebhook ke penerima 5xx = (%d, %v), ingin (502, error)", status, err)
+	}
+}
+
+func TestWebhookBackoffSchedule(t *testing.T) {
+	want := []time.Duration{
+		30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 16 * time.Minute,
+		32 * time.Minute, 64 * time.Minute, 128 * time.Minute, 256 * time.Minute, 6 * time.Hour, 6 * time.Hour,
+	}
+	for i, w := range want {
+		if got := webhookBackoff(i + 1); got != w {
+			t.Errorf("webhookBackoff(%d) = %s, ingin %s", i+1, got, w)
+		}
+	}
+}
+
+func TestDispatchWebhooksRecordsDelivery(t *testing.T) {
+	const claim = "SELECT o.id, o.webhook_id, o.event_type, o.payload, o.attempts, w.client_id, w.url, w.secret_enc"
+	const insertDelivery = "INSERT INTO webhook_deliveries"
+
+	tests := []struct {
+		name         string
+		status       int
+		attempts     int // Percobaan yang sudah dilakukan sebelumnya
+		expectUpdate func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:     "2xx ditandai delivered",
+			status:   http.StatusOK,
+			attempts: 0,
+			expectUpdate: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE webhook_outbox SET status = 'delivered'").WithArgs(1, int64(9)).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:     "5xx dijadwalkan ulang dengan backoff",
+			status:   http.StatusServiceUnavailable,
+			attempts: 2,
+			expectUpdate: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE webhook_outbox SET attempts = \\?, last_error = \\?, next_attempt_at").
+					WithArgs(3, "penerima membalas dengan status 503", int64(120), int64(9)).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:     "5xx pada percobaan terakhir ditandai failed",
+			status:   http.StatusInternalServerError,
+			attempts: webhookMaxAttempts - 1,
+			expectUpdate: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE webhook_outbox SET status = 'failed'").
+					WithArgs(webhookMaxAttempts, "penerima membalas dengan status 500", int64(9)).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	useSigningEncryptionKey(t)
+	secretEnc, err := sealSecret("rahasia", webhookSecretAD(5))
+	if err != nil {
+		t.Fatalf("sealSecret: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rcv := newWebhookReceiver(t, tt.status)
+			mock := useMockDB(t)
+			mock.ExpectBegin()
+			mock.ExpectQuery(claim).WithArgs(webhookBatchSize).WillReturnRows(
+				sqlmock.NewRows([]string{"id", "webhook_id", "event_type", "payload", "attempts", "client_id", "url", "secret_enc"}).
+					AddRow(int64(9), int64(3), webhookEventPing, []byte(`{}`), tt.attempts, int64(5), rcv.URL, secretEnc))
+			mock.ExpectExec("UPDATE webhook_outbox SET next_attempt_at").WithArgs(int64(webhookLease.Seconds())).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+			mock.ExpectBegin()
+			mock.ExpectExec(insertDelivery).
+				WithArgs(int64(9), int64(3), tt.attempts+1, sql.NullInt64{Int64: int64(tt.status), Valid: true}, sqlmock.AnyArg(), sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			tt.expectUpdate(mock)
+			mock.ExpectCommit()
+
+			n, err := dispatchWebhooks(rcv.Client())
+			if err != nil || n != 1 {
+				t.Fatalf("dispatchWebhooks = (%d, %v), ingin (1, nil)", n, err)
+			}
+			if rcv.calls != 1 {
+				t.Errorf("penerima dipanggil %d kali, ingin 1", rcv.calls)
+			}
+			// Secret hasil dekripsi yang dipakai untuk menandatangani
+			timestamp := rcv.header.Get(webhookTimestampHeader)
+			if got, want := rcv.header.Get(webhookSignatureHeader), signWebhookPayload("rahasia", timestamp, rcv.body); got != want {
+				t.Errorf("%s = %q, ingin %q", webhookSignatureHeader, got, want)
+			}
+		})
+	}
+}
+
+func TestWebhookSecretEncryption(t *testing.T) {
+	useSigningEncryptionKey(t)
+	mock := useMockDB(t)
+	mock.ExpectQuery("SELECT .+ FROM api_clients WHERE id = \\?").WithArgs(int64(5)).WillReturnRows(
+		sqlmock.NewRows(strings.Split(clientSelectColumns, ", ")).AddRow(5, "Mitra", "", clientStatusActive, nil, time.Now(), time.Now(), nil),
+	)
+	var stored []byte
+	mock.ExpectExec("INSERT INTO api_client_webhooks \\(client_id, url, secret_enc, events\\)").
+		WithArgs(int64(5), "https://203.0.113.10/hook", captureBytes{&stored}, "").
+		WillReturnResult(sqlmock.NewResult(11, 1))
+
+	hook, err := createWebhook(5, "https://203.0.113.10/hook", nil)
+	if err != nil {
+		t.Fatalf("createWebhook: %v", err)
+	}
+	if !strings.HasPrefix(hook.Secret, "whsec_") || strings.Contains(string(stored), hook.Secret) {
+		t.Fatalf("secret %q tersimpan tanpa enkripsi", hook.Secret)
+	}
+	if got, err := openSecret(stored, webhookSecretAD(5)); err != nil || got != hook.Secret {
+		t.Errorf("openSecret = (%q, %v), ingin (%q, nil)", got, err, hook.Secret)
+	}
+	// Ciphertext yang dipindahkan ke webhook klien lain tidak boleh bisa didekripsi
+	if _, err := openSecret(stored, webhookSecretAD(6)); err == nil {
+		t.Error("openSecret berhasil untuk klien yang berbeda")
+	}
+}
+
+// captureBytes adalah sqlmock.Argument yang menyimpan argumen []byte agar bisa diperiksa setelah query.
+type captureBytes struct{ dst *[]byte }
+
+func (c captureBytes) Match(v driver.Value) bool {
+	b, ok := v.([]byte)
+	*c.dst = b
+	return ok
+}
+
+func TestWebhookSSRFProtection(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{url: "https://203.0.113.10/hook"},
+		{url: "https://[2001:4860:4860::8888]/hook"},
+		{url: "http://127.0.0.1:8080/hook", wantErr: true},
+		{url: "http://localhost/hook", wantErr: true},
+		{url: "http://[::1]/hook", wantErr: true},
+		{url: "http://169.254.169.254/latest/meta-data", wantErr: true},
+		{url: "http://[fe80::1]/hook", wantErr: true},
+		{url: "http://10.1.2.3/hook", wantErr: true},
+		{url: "http://172.16.0.1/hook", wantErr: true},
+		{url: "http://192.168.1.1/hook", wantErr: true},
+		{url: "http://[fd00::1]/hook", wantErr: true},
+		{url: "http://[::ffff:127.0.0.1]/hook", wantErr: true},
+		{url: "http://0.0.0.0/hook", wantErr: true},
+		{url: "http://100.64.0.1/hook", wantErr: true},
+		{url: "http://224.0.0.1/hook", wantErr: true},
+		{url: "ftp://203.0.113.10/hook", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if err := validateWebhookURL(tt.url); (err != nil) != tt.wantErr {
+				t.Errorf("validateWebhookURL(%q) error = %v, ingin error %t", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+
+	// Pemeriksaan saat koneksi dibuka menahan URL yang lolos validasi lalu di-resolve ke alamat internal
+	rcv := newWebhookReceiver(t, http.StatusOK)
+	job := webhookJob{outboxID: 1, webhookID: 1, eventType: webhookEventPing, payload: []byte(`{}`), url: rcv.URL, secret: "rahasia"}
+	if _, err := deliverWebhook(webhookHTTPClient, job, time.Now()); !errors.Is(err, errWebhookTargetForbidden) {
+		t.Errorf("deliverWebhook ke %s error = %v, ingin errWebhookTargetForbidden", rcv.URL, err)
+	}
+	if rcv.calls != 0 {
+		t.Errorf("penerima loopback tetap dipanggil %d kali", rcv.calls)
+	}
+}
+
+func TestWebhookAllowPrivateTargets(t *testing.T) {
+	t.Cleanup(func() { webhookAllowPrivateTargets = false })
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_TARGETS", "bukan-boolean")
+	if err := loadWebhookTargetPolicy(); err == nil {
+		t.Error("WEBHOOK_ALLOW_PRIVATE_TARGETS yang bukan boolean seharusnya ditolak")
+	}
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_TARGETS", "true")
+	if err := loadWebhookTargetPolicy(); err != nil || !webhookAllowPrivateTargets {
+		t.Fatalf("loadWebhookTargetPolicy = %v, webhookAllowPrivateTargets = %t; ingin nil, true", err, webhookAllowPrivateTargets)
+	}
+
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{url: "http://127.0.0.1:8080/hook"},
+		{url: "http://[::1]/hook"},
+		{url: "http://192.168.1.1/hook"},
+		{url: "http://[fd00::1]/hook"},
+		{url: "http://169.254.169.254/latest/meta-data", wantErr: true},
+		{url: "http://0.0.0.0/hook", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if err := validateWebhookURL(tt.url); (err != nil) != tt.wantErr {
+				t.Errorf("validateWebhookURL(%q) error = %v, ingin error %t", tt.url, err, tt.wantErr)
+			}
+		})
+	}
+
+	// Penerima httptest lokal dapat dipakai dengan klien webhook yang sebenarnya
+	rcv := newWebhookReceiver(t, http.StatusOK)
+	job := webhookJob{outboxID: 1, webhookID: 1, eventType: webhookEventPing, payload: []byte(`{}`), url: rcv.URL, secret: "rahasia"}
+	if status, err := deliverWebhook(webhookHTTPClient, job, time.Now()); err != nil || status != http.StatusOK {
+		t.Errorf("deliverWebhook ke %s = (%d, %v), ingin (200, nil)", rcv.URL, status, err)
+	}
+}
@@ -2,9 +2,17 @@ module github.com/tiers-undiknas/api-auth-basic
 
 go 1.23.4
 
+require (
+	github.com/DATA-DOG/go-sqlmock v1.5.2
+	github.com/go-sql-driver/mysql v1.9.2
+	github.com/gorilla/mux v1.8.1
+	github.com/tiers-undiknas/api-passwords v0.0.0
+	golang.org/x/crypto v0.38.0
+)
+
 require (
 	filippo.io/edwards25519 v1.1.0 // indirect
-	github.com/go-sql-driver/mysql v1.9.2 // indirect
-	github.com/gorilla/mux v1.8.1 // indirect
-	golang.org/x/crypto v0.38.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
 )
+
+replace github.com/tiers-undiknas/api-passwords => ../passwords
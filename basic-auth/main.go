@@ -1,19 +1,27 @@
 package main
 
 import (
+	"container/list"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql" // Driver MySQL
-	"github.com/gorilla/mux"           // Router
-	"golang.org/x/crypto/bcrypt"       // Untuk hashing password
+	_ "github.com/go-sql-driver/mysql"        // Driver MySQL
+	"github.com/gorilla/mux"                  // Router
+	"github.com/tiers-undiknas/api-passwords" // Kebijakan dan hashing password bersama
 )
 
 // User struct untuk menyimpan data pengguna dari database
@@ -21,6 +29,7 @@ type User struct {
 	ID       int64  `json:"id"`
 	Email    string `json:"email"`
 	Password string `json:"-"` // Jangan kirim hash password ke klien
+	Active   bool   `json:"active"`
 }
 
 // Variabel global untuk koneksi database (dalam aplikasi nyata, pertimbangkan dependency injection)
@@ -36,6 +45,49 @@ const (
 	dbName     = "auth-example" // Nama database yang telah Anda buat
 )
 
+// --- Konfigurasi Pembatasan Login ---
+// Setiap kegagalan login dihitung per akun (email) dan per alamat IP. Setelah loginBackoffThreshold kali
+// gagal, percobaan berikutnya harus menunggu jeda yang berlipat dua setiap kali gagal lagi; setelah
+// ...LockoutThreshold kali gagal, akun atau IP dikunci sementara. Selama jeda atau terkunci, request
+// langsung ditolak tanpa memeriksa password, dengan respons 401 yang sama seperti password salah.
+// Nilai di bawah ini adalah default; bisa diganti dengan variabel lingkungan LOGIN_FAILURE_WINDOW,
+// LOGIN_BACKOFF_THRESHOLD, LOGIN_BACKOFF_BASE, LOGIN_BACKOFF_MAX, ACCOUNT_LOCKOUT_THRESHOLD,
+// IP_LOCKOUT_THRESHOLD dan LOGIN_LOCKOUT_DURATION.
+const (
+	loginFailureWindow          = 15 * time.Minute // Penghitung direset jika kegagalan terakhir lebih lama dari ini
+	loginBackoffThreshold       = 3                // Jumlah kegagalan sebelum jeda mulai berlaku
+	loginBackoffBase            = 1 * time.Second  // Jeda setelah kegagalan ke-loginBackoffThreshold
+	loginBackoffMax             = 30 * time.Second // Jeda maksimum sebelum terkunci
+	accountLockoutThreshold     = 10               // Jumlah kegagalan per akun sebelum akun dikunci
+	ipLockoutThreshold          = 50               // Jumlah kegagalan per IP (semua akun) sebelum IP dikunci
+	loginLockoutDuration        = 15 * time.Minute // Lama akun atau IP dikunci
+	loginFailureCleanupInterval = 10 * time.Minute // Seberapa sering baris login_failures yang kedaluwarsa dihapus
+)
+
+// --- Konfigurasi Cache Kredensial ---
+// Kredensial Basic yang sudah terverifikasi disimpan sebentar agar request berikutnya tidak perlu
+// menghitung hash password lagi. Kunci cache adalah HMAC-SHA256 dari nilai header Authorization dengan
+// kunci acak per proses, sehingga password tidak pernah disimpan di memori dalam bentuk yang bisa dibaca.
+const (
+	credentialCacheTTL        = 30 * time.Second // Umur maksimum entri cache
+	credentialCacheMaxEntries = 10000            // Batas jumlah entri
+)
+
+// Jenis subjek yang dihitung di tabel login_failures.
+const (
+	failureScopeAccount = "account"
+	failureScopeIP      = "ip"
+)
+
+// adminEmails berisi email pengguna yang boleh memakai endpoint /admin. Bisa diganti dengan
+// variabel lingkungan ADMIN_EMAILS (dipisahkan koma).
+var adminEmails = map[string]bool{"admin": true}
+
+// contextKey adalah tipe kunci context agar tidak bertabrakan dengan paket lain.
+type contextKey string
+
+const userContextKey contextKey = "user" // Kunci context untuk User yang terautentikasi
+
 // --- Fungsi-fungsi Database ---
 
 // initDB menginisialisasi koneksi ke database MySQL dan membuat tabel jika belum ada.
@@ -59,6 +111,7 @@ func initDB() {
             id INT AUTO_INCREMENT PRIMARY KEY,
             email VARCHAR(255) UNIQUE NOT NULL,
             password VARCHAR(255) NOT NULL,
+            is_active BOOLEAN NOT NULL DEFAULT TRUE,
             created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
         ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
     `
@@ -66,12 +119,48 @@ func initDB() {
 	if err != nil {
 		log.Fatalf("Error membuat tabel users: %v", err)
 	}
+	// Tambahkan kolom baru ke tabel lama (tabel dari auth-example.sql belum memiliki is_active)
+	if err := ensureColumn("user", "is_active", "BOOLEAN NOT NULL DEFAULT TRUE"); err != nil {
+		log.Fatalf("Error menambahkan kolom is_active: %v", err)
+	}
 	log.Println("Tabel 'user' siap atau sudah ada.")
+
+	// Tabel penghitung kegagalan login per akun dan per IP
+	_, err = db.Exec(`
+        CREATE TABLE IF NOT EXISTS login_failures (
+            scope VARCHAR(8) NOT NULL, -- 'account' atau 'ip'
+            subject VARCHAR(255) NOT NULL, -- Email (huruf kecil) atau alamat IP
+            failures INT NOT NULL DEFAULT 0,
+            last_failure_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            blocked_until TIMESTAMP NULL DEFAULT NULL, -- Akhir jeda atau penguncian
+            PRIMARY KEY (scope, subject)
+        ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+    `)
+	if err != nil {
+		log.Fatalf("Error membuat tabel login_failures: %v", err)
+	}
+}
+
+// ensureColumn menambahkan kolom ke tabel jika kolom tersebut belum ada.
+func ensureColumn(table, column, definition string) error {
+	var count int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?",
+		table, column,
+	).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("gagal memeriksa kolom: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
 }
 
 // addUser menambahkan pengguna baru ke database dengan password yang di-hash.
 func addUser(email, password string) (User, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := passwordHasher.Hash(password)
 	if err != nil {
 		return User{}, fmt.Errorf("error hashing password: %w", err)
 	}
@@ -90,14 +179,14 @@ func addUser(email, password string) (User, error) {
 		return User{}, fmt.Errorf("error mendapatkan last insert ID: %w", err)
 	}
 
-	return User{ID: id, Email: email}, nil
+	return User{ID: id, Email: email, Active: true}, nil
 }
 
 // findUserByemail mencari pengguna berdasarkan email.
 func findUserByemail(email string) (User, error) {
 	var user User
-	row := db.QueryRow("SELECT id, email, password FROM user WHERE email = ?", email)
-	err := row.Scan(&user.ID, &user.Email, &user.Password)
+	row := db.QueryRow("SELECT id, email, password, is_active FROM user WHERE email = ?", email)
+	err := row.Scan(&user.ID, &user.Email, &user.Password, &user.Active)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return User{}, fmt.Errorf("pengguna '%s' tidak ditemukan", email)
@@ -107,14 +196,520 @@ func findUserByemail(email string) (User, error) {
 	return user, nil
 }
 
-// verifyPassword membandingkan password plain text dengan hash yang tersimpan.
-func verifyPassword(plainPassword, hashedPassword string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(plainPassword))
-	return err == nil
+// changePassword mengganti password pengguna dan menghapus kredensial pengguna tersebut dari cache.
+func changePassword(userID int64, newPassword string) error {
+	newHash, err := passwordHasher.Hash(newPassword)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %w", err)
+	}
+	if _, err := db.Exec("UPDATE user SET password = ? WHERE id = ?", newHash, userID); err != nil {
+		return fmt.Errorf("gagal mengganti password: %w", err)
+	}
+	credentialCache.invalidateUser(userID)
+	return nil
+}
+
+// setUserActive mengaktifkan atau menonaktifkan akun. Pengguna nonaktif tidak bisa login dan kredensialnya
+// langsung dihapus dari cache.
+func setUserActive(email string, active bool) (User, error) {
+	user, err := findUserByemail(email)
+	if err != nil {
+		return User{}, err
+	}
+	if _, err := db.Exec("UPDATE user SET is_active = ? WHERE id = ?", active, user.ID); err != nil {
+		return User{}, fmt.Errorf("gagal mengubah status pengguna: %w", err)
+	}
+	credentialCache.invalidateUser(user.ID)
+	user.Active = active
+	return user, nil
+}
+
+// dummyPasswordHash dibandingkan saat pengguna tidak ditemukan, agar waktu respons tidak membedakan email
+// terdaftar dan tidak terdaftar. Diisi oleh initDummyPasswordHash sebelum server mulai menerima request.
+var dummyPasswordHash string
+
+// initDummyPasswordHash membuat dummyPasswordHash dengan algoritma dan parameter yang paling banyak dipakai
+// oleh hash tersimpan pengguna terbaru (lihat passwords.DummyHashFrom), sehingga verifikasi untuk email yang
+// tidak terdaftar sama lamanya dengan verifikasi untuk akun pada umumnya. Tanpa pengguna, dipakai
+// konfigurasi hash baru.
+func initDummyPasswordHash() error {
+	dummy, err := passwords.LoadDummyHash(db, "SELECT password FROM user ORDER BY id DESC LIMIT ?", *passwordHasher)
+	if err != nil {
+		return err
+	}
+	dummyPasswordHash = dummy.Encoded
+	log.Printf("Dummy password hash memakai %s (dipakai %d dari hash tersimpan yang diperiksa).", dummy.Params.Describe(), dummy.Matches)
+	return nil
+}
+
+// authenticateUser memverifikasi email dan password dengan biaya hashing yang sama, baik pengguna
+// ditemukan maupun tidak. Error yang dikembalikan berisi alasan detail dan hanya untuk log server.
+// Hash dengan parameter lama di-rehash setelah verifikasi berhasil.
+func authenticateUser(email, password string) (User, error) {
+	// Pengguna yang tidak ditemukan (user.Password kosong) tetap diverifikasi terhadap dummyPasswordHash
+	user, err := findUserByemail(email)
+	ok, needsRehash, verifyErr := passwordHasher.VerifyOrDummy(password, user.Password, dummyPasswordHash)
+	if err != nil {
+		return User{}, err
+	}
+	if verifyErr != nil {
+		return User{}, fmt.Errorf("gagal memverifikasi hash password pengguna '%s': %w", email, verifyErr)
+	}
+	if !ok {
+		return User{}, fmt.Errorf("password salah untuk pengguna '%s'", email)
+	}
+	if !user.Active {
+		return User{}, fmt.Errorf("akun '%s' dinonaktifkan", email)
+	}
+	if needsRehash {
+		newHash, err := passwordHasher.Rehash(db, "UPDATE user SET password = ? WHERE id = ? AND password = ?", user.ID, user.Password, password)
+		if err != nil {
+			// Login tetap sah dengan hash lama
+			log.Printf("Peringatan: hash password pengguna '%s' tidak diperbarui: %v", email, err)
+		} else {
+			log.Printf("Hash password pengguna '%s' diperbarui ke parameter terbaru.", email)
+			user.Password = newHash
+		}
+	}
+	return user, nil
+}
+
+// --- Cache Kredensial ---
+
+// credentialEntry adalah kredensial yang sudah terverifikasi. passwordHash menyimpan hash yang berlaku saat
+// verifikasi; jika hash di database berbeda (password diganti atau di-rehash), entri tidak dipakai lagi.
+type credentialEntry struct {
+	key          string
+	userID       int64
+	passwordHash string
+	expiresAt    time.Time
+}
+
+// credCache adalah cache LRU berbatas dengan TTL untuk kredensial Basic yang terverifikasi, aman dipakai
+// dari banyak goroutine.
+type credCache struct {
+	mu      sync.Mutex
+	key     []byte // Kunci HMAC acak per proses
+	ttl     time.Duration
+	max     int
+	entries map[string]*list.Element // Nilai elemen: *credentialEntry
+	order   *list.List               // Depan = paling baru dipakai
+}
+
+var credentialCache = newCredCache(credentialCacheTTL, credentialCacheMaxEntries)
+
+// newCredCache membuat cache dengan kunci HMAC acak.
+func newCredCache(ttl time.Duration, max int) *credCache {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatalf("Error membuat kunci cache kredensial: %v", err)
+	}
+	return &credCache{key: key, ttl: ttl, max: max, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+// cacheKey menghitung HMAC-SHA256 dari nilai header Authorization.
+func (c *credCache) cacheKey(authHeader string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(authHeader))
+	return string(mac.Sum(nil))
+}
+
+// get mengembalikan entri untuk header Authorization jika ada dan belum kedaluwarsa.
+func (c *credCache) get(authHeader string, now time.Time) (credentialEntry, bool) {
+	key := c.cacheKey(authHeader)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return credentialEntry{}, false
+	}
+	entry := elem.Value.(*credentialEntry)
+	if !now.Before(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return credentialEntry{}, false
+	}
+	c.order.MoveToFront(elem)
+	return *entry, true
+}
+
+// put menyimpan kredensial yang baru saja terverifikasi dan membuang entri yang paling lama tidak dipakai
+// jika cache penuh.
+func (c *credCache) put(authHeader string, user User, now time.Time) {
+	key := c.cacheKey(authHeader)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &credentialEntry{key: key, userID: user.ID, passwordHash: user.Password, expiresAt: now.Add(c.ttl)}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*credentialEntry).key)
+	}
+}
+
+// remove menghapus entri untuk satu header Authorization.
+func (c *credCache) remove(authHeader string) {
+	key := c.cacheKey(authHeader)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+// invalidateUser menghapus semua entri milik pengguna (dipanggil saat password diganti atau akun dinonaktifkan).
+func (c *credCache) invalidateUser(userID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, elem := range c.entries {
+		if elem.Value.(*credentialEntry).userID == userID {
+			c.order.Remove(elem)
+			delete(c.entries, k)
+		}
+	}
+}
+
+// cachedUser mengembalikan pengguna jika header Authorization ada di cache dan masih sesuai dengan database:
+// pengguna sama, masih aktif, dan hash password belum berubah. Pemeriksaan ini hanya satu query ringan,
+// sehingga perubahan dari proses lain (atau langsung di MySQL) juga membatalkan entri tanpa menunggu TTL.
+func cachedUser(authHeader, email string) (User, bool) {
+	entry, ok := credentialCache.get(authHeader, time.Now())
+	if !ok {
+		return User{}, false
+	}
+	user, err := findUserByemail(email)
+	if err != nil || user.ID != entry.userID || !user.Active || user.Password != entry.passwordHash {
+		credentialCache.remove(authHeader)
+		return User{}, false
+	}
+	return user, true
+}
+
+// --- Hashing Password ---
+
+// passwordHasher dipakai oleh addUser dan authenticateUser. Hash dan verifikasi (argon2id, scrypt, bcrypt)
+// ada di paket passwords; algoritma bisa diganti dengan variabel lingkungan PASSWORD_HASH_ALGORITHM.
+var passwordHasher = passwords.NewHasher(passwords.DefaultHashAlgorithm)
+
+// --- Kebijakan Password ---
+
+// passwordPolicy adalah kebijakan password bersama dari paket passwords, dimuat di main dengan
+// passwords.FromEnv.
+var passwordPolicy = passwords.DefaultPolicy()
+
+// --- Pembatasan Login ---
+
+// LoginLimits berisi ambang batas pembatasan login yang berlaku.
+type LoginLimits struct {
+	FailureWindow           time.Duration
+	BackoffThreshold        int
+	BackoffBase             time.Duration
+	BackoffMax              time.Duration
+	AccountLockoutThreshold int
+	IPLockoutThreshold      int
+	LockoutDuration         time.Duration
+}
+
+// loginLimits adalah pembatasan login yang dipakai basicAuthMiddleware. Diisi ulang oleh loadLoginLimits di main.
+var loginLimits = LoginLimits{
+	FailureWindow:           loginFailureWindow,
+	BackoffThreshold:        loginBackoffThreshold,
+	BackoffBase:             loginBackoffBase,
+	BackoffMax:              loginBackoffMax,
+	AccountLockoutThreshold: accountLockoutThreshold,
+	IPLockoutThreshold:      ipLockoutThreshold,
+	LockoutDuration:         loginLockoutDuration,
+}
+
+// loadLoginLimits membuat LoginLimits dari nilai default dan variabel lingkungan.
+func loadLoginLimits() (LoginLimits, error) {
+	limits := loginLimits
+	durations := []struct {
+		env    string
+		target *time.Duration
+	}{
+		{"LOGIN_FAILURE_WINDOW", &limits.FailureWindow},
+		{"LOGIN_BACKOFF_BASE", &limits.BackoffBase},
+		{"LOGIN_BACKOFF_MAX", &limits.BackoffMax},
+		{"LOGIN_LOCKOUT_DURATION", &limits.LockoutDuration},
+	}
+	for _, d := range durations {
+		if raw := os.Getenv(d.env); raw != "" {
+			v, err := time.ParseDuration(raw)
+			if err != nil || v < time.Second {
+				return limits, fmt.Errorf("%s harus berupa durasi minimal 1s (misalnya \"15m\"): %q", d.env, raw)
+			}
+			*d.target = v
+		}
+	}
+	counts := []struct {
+		env    string
+		target *int
+	}{
+		{"LOGIN_BACKOFF_THRESHOLD", &limits.BackoffThreshold},
+		{"ACCOUNT_LOCKOUT_THRESHOLD", &limits.AccountLockoutThreshold},
+		{"IP_LOCKOUT_THRESHOLD", &limits.IPLockoutThreshold},
+	}
+	for _, c := range counts {
+		if raw := os.Getenv(c.env); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 {
+				return limits, fmt.Errorf("%s harus bilangan bulat positif: %q", c.env, raw)
+			}
+			*c.target = n
+		}
+	}
+	if limits.BackoffMax < limits.BackoffBase {
+		return limits, fmt.Errorf("LOGIN_BACKOFF_MAX (%s) tidak boleh lebih kecil dari LOGIN_BACKOFF_BASE (%s)", limits.BackoffMax, limits.BackoffBase)
+	}
+	return limits, nil
+}
+
+// loginBlockDelay menghitung lama subjek diblokir setelah gagal sebanyak failures kali:
+// tidak ada jeda sebelum BackoffThreshold, jeda eksponensial sampai batas penguncian,
+// lalu LockoutDuration.
+func (l LoginLimits) loginBlockDelay(failures, lockoutThreshold int) time.Duration {
+	if failures >= lockoutThreshold {
+		return l.LockoutDuration
+	}
+	if failures < l.BackoffThreshold {
+		return 0
+	}
+	delay := l.BackoffBase
+	for i := l.BackoffThreshold; i < failures && delay < l.BackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > l.BackoffMax {
+		return l.BackoffMax
+	}
+	return delay
+}
+
+// loginBlocked memeriksa apakah akun atau IP sedang dalam jeda atau terkunci. Perbandingan waktu
+// dilakukan di MySQL agar tidak bergantung pada zona waktu koneksi. Jika pemeriksaan gagal,
+// basicAuthMiddleware menolak request (fail closed); lihat readme. Ini hanya pemeriksaan awal yang murah
+// (juga untuk kredensial dari cache); keputusan untuk verifikasi password diambil dari reserveLogin.
+func loginBlocked(email, ip string) (bool, error) {
+	var count int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM login_failures WHERE ((scope = ? AND subject = ?) OR (scope = ? AND subject = ?)) AND blocked_until > CURRENT_TIMESTAMP",
+		failureScopeAccount, strings.ToLower(email), failureScopeIP, ip,
+	).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("gagal memeriksa pembatasan login: %w", err)
+	}
+	return count > 0, nil
+}
+
+// reserveLoginAttempt mencatat satu percobaan login untuk satu subjek sebelum password diverifikasi, lalu
+// memutuskan dari hasil pencatatan itu apakah percobaan boleh dilanjutkan. Penambahan penghitung, pembacaan,
+// dan pembaruan blocked_until berjalan dalam satu transaksi yang mengunci baris subjek, sehingga percobaan
+// yang datang bersamaan dihitung satu per satu dan tidak bisa lolos semuanya sebelum penguncian tercatat.
+// Percobaan yang ditolak karena subjek sedang diblokir tidak menambah penghitung.
+// Penghitung dimulai dari 1 lagi jika percobaan terakhir lebih lama dari loginLimits.FailureWindow.
+// Mengembalikan jumlah percobaan saat ini dan apakah subjek sedang diblokir.
+func reserveLoginAttempt(scope, subject string, lockoutThreshold int) (int, bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, false, fmt.Errorf("gagal memulai transaksi pembatasan login: %w", err)
+	}
+	defer tx.Rollback() // Tidak berpengaruh jika transaksi sudah di-commit
+
+	// failures dihitung dari last_failure_at lama karena MySQL menjalankan assignment dari kiri ke kanan
+	_, err = tx.Exec(`
+        INSERT INTO login_failures (scope, subject, failures, last_failure_at) VALUES (?, ?, 1, CURRENT_TIMESTAMP)
+        ON DUPLICATE KEY UPDATE
+            failures = IF(blocked_until > CURRENT_TIMESTAMP, failures,
+                IF(last_failure_at < DATE_SUB(CURRENT_TIMESTAMP, INTERVAL ? SECOND), 1, failures + 1)),
+            last_failure_at = IF(blocked_until > CURRENT_TIMESTAMP, last_failure_at, CURRENT_TIMESTAMP)`,
+		scope, subject, int64(loginLimits.FailureWindow.Seconds()),
+	)
+	if err != nil {
+		return 0, false, fmt.Errorf("gagal mencatat percobaan login: %w", err)
+	}
+	var failures int
+	var blocked bool
+	err = tx.QueryRow(
+		"SELECT failures, COALESCE(blocked_until > CURRENT_TIMESTAMP, FALSE) FROM login_failures WHERE scope = ? AND subject = ?",
+		scope, subject,
+	).Scan(&failures, &blocked)
+	if err != nil {
+		return 0, false, fmt.Errorf("gagal membaca percobaan login: %w", err)
+	}
+	if !blocked {
+		// Blokir dipasang sekarang, bukan setelah verifikasi, agar percobaan berikutnya langsung tertahan
+		if delay := loginLimits.loginBlockDelay(failures, lockoutThreshold); delay > 0 {
+			_, err = tx.Exec(
+				"UPDATE login_failures SET blocked_until = DATE_ADD(CURRENT_TIMESTAMP, INTERVAL ? SECOND) WHERE scope = ? AND subject = ?",
+				int64(delay.Seconds()), scope, subject,
+			)
+			if err != nil {
+				return 0, false, fmt.Errorf("gagal memperbarui pembatasan login: %w", err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, false, fmt.Errorf("gagal menyimpan percobaan login: %w", err)
+	}
+	return failures, blocked, nil
+}
+
+// releaseLoginAttempt membatalkan satu percobaan yang dicatat reserveLoginAttempt karena percobaan tersebut
+// ternyata berhasil (atau tidak jadi diverifikasi), lalu menghitung ulang blocked_until dari penghitung
+// yang tersisa. Jeda dihitung dari last_failure_at agar tidak diperpanjang.
+func releaseLoginAttempt(scope, subject string, lockoutThreshold int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("gagal memulai transaksi pembatasan login: %w", err)
+	}
+	defer tx.Rollback() // Tidak berpengaruh jika transaksi sudah di-commit
+
+	if _, err := tx.Exec("UPDATE login_failures SET failures = GREATEST(failures - 1, 0) WHERE scope = ? AND subject = ?", scope, subject); err != nil {
+		return fmt.Errorf("gagal membatalkan percobaan login: %w", err)
+	}
+	var failures int
+	err = tx.QueryRow("SELECT failures FROM login_failures WHERE scope = ? AND subject = ?", scope, subject).Scan(&failures)
+	if err == sql.ErrNoRows {
+		return nil // Penghitung sudah dihapus (misalnya lewat unlockLogin)
+	}
+	if err != nil {
+		return fmt.Errorf("gagal membaca percobaan login: %w", err)
+	}
+	if delay := loginLimits.loginBlockDelay(failures, lockoutThreshold); delay > 0 {
+		_, err = tx.Exec(
+			"UPDATE login_failures SET blocked_until = DATE_ADD(last_failure_at, INTERVAL ? SECOND) WHERE scope = ? AND subject = ?",
+			int64(delay.Seconds()), scope, subject,
+		)
+	} else {
+		_, err = tx.Exec("UPDATE login_failures SET blocked_until = NULL WHERE scope = ? AND subject = ?", scope, subject)
+	}
+	if err != nil {
+		return fmt.Errorf("gagal memperbarui pembatasan login: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("gagal menyimpan pembatalan percobaan login: %w", err)
+	}
+	return nil
+}
+
+// reserveLogin mencatat percobaan login untuk akun lalu IP dengan reserveLoginAttempt, dan menulis log saat
+// salah satunya dikunci. Percobaan dihitung juga untuk email yang tidak terdaftar agar perilaku penguncian
+// tidak membocorkan akun mana yang ada. Jika IP diblokir, percobaan yang sudah dicatat untuk akun dibatalkan.
+// Mengembalikan true jika percobaan harus ditolak tanpa memeriksa password.
+func reserveLogin(email, ip string) (bool, error) {
+	account := strings.ToLower(email)
+	failures, blocked, err := reserveLoginAttempt(failureScopeAccount, account, loginLimits.AccountLockoutThreshold)
+	if err != nil || blocked {
+		return blocked, err
+	}
+	if failures == loginLimits.AccountLockoutThreshold {
+		log.Printf("PERINGATAN KEAMANAN: Akun '%s' dikunci selama %s setelah %d kali percobaan login.", email, loginLimits.LockoutDuration, failures)
+	}
+
+	failures, blocked, err = reserveLoginAttempt(failureScopeIP, ip, loginLimits.IPLockoutThreshold)
+	if err != nil || blocked {
+		if releaseErr := releaseLoginAttempt(failureScopeAccount, account, loginLimits.AccountLockoutThreshold); releaseErr != nil {
+			log.Printf("Peringatan: %v", releaseErr)
+		}
+		return blocked, err
+	}
+	if failures == loginLimits.IPLockoutThreshold {
+		log.Printf("PERINGATAN KEAMANAN: IP %s dikunci selama %s setelah %d kali percobaan login.", ip, loginLimits.LockoutDuration, failures)
+	}
+	return false, nil
+}
+
+// resetAccountFailures menghapus penghitung kegagalan akun setelah login berhasil. Penghitung IP tidak
+// direset agar penyerang yang memiliki satu akun valid tidak bisa terus menebak password akun lain; hanya
+// percobaan yang berhasil itu yang dibatalkan dari penghitung IP.
+func resetAccountFailures(email, ip string) {
+	if _, err := db.Exec("DELETE FROM login_failures WHERE scope = ? AND subject = ?", failureScopeAccount, strings.ToLower(email)); err != nil {
+		log.Printf("Peringatan: gagal mereset kegagalan login untuk '%s': %v", email, err)
+	}
+	if err := releaseLoginAttempt(failureScopeIP, ip, loginLimits.IPLockoutThreshold); err != nil {
+		log.Printf("Peringatan: %v", err)
+	}
+}
+
+// unlockLogin membuka kunci akun (email) dan/atau IP. Mengembalikan jumlah penghitung yang dihapus.
+func unlockLogin(email, ip string) (int64, error) {
+	var total int64
+	if email != "" {
+		result, err := db.Exec("DELETE FROM login_failures WHERE scope = ? AND subject = ?", failureScopeAccount, strings.ToLower(email))
+		if err != nil {
+			return total, fmt.Errorf("gagal membuka kunci akun: %w", err)
+		}
+		n, _ := result.RowsAffected()
+		total += n
+	}
+	if ip != "" {
+		result, err := db.Exec("DELETE FROM login_failures WHERE scope = ? AND subject = ?", failureScopeIP, ip)
+		if err != nil {
+			return total, fmt.Errorf("gagal membuka kunci IP: %w", err)
+		}
+		n, _ := result.RowsAffected()
+		total += n
+	}
+	return total, nil
+}
+
+// deleteExpiredLoginFailures menghapus penghitung yang kegagalan terakhirnya lebih lama dari FailureWindow
+// dan tidak sedang memblokir. Penghitung seperti itu akan dimulai dari 1 lagi pada kegagalan berikutnya,
+// jadi menghapusnya tidak mengubah perilaku, hanya mencegah tabel tumbuh tanpa batas.
+func deleteExpiredLoginFailures() (int64, error) {
+	result, err := db.Exec(
+		"DELETE FROM login_failures WHERE last_failure_at < DATE_SUB(CURRENT_TIMESTAMP, INTERVAL ? SECOND) AND (blocked_until IS NULL OR blocked_until <= CURRENT_TIMESTAMP)",
+		int64(loginLimits.FailureWindow.Seconds()),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("gagal menghapus kegagalan login yang kedaluwarsa: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// startLoginFailureCleanup menjalankan deleteExpiredLoginFailures di background setiap interval.
+func startLoginFailureCleanup(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, err := deleteExpiredLoginFailures()
+			if err != nil {
+				log.Printf("Peringatan: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("%d penghitung kegagalan login yang kedaluwarsa dihapus.", n)
+			}
+		}
+	}()
+}
+
+// clientIP mengembalikan alamat IP dari r.RemoteAddr (tanpa port).
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
 
 // --- Middleware Autentikasi ---
 
+// writeInvalidCredentials mengirim respons 401 yang sama untuk semua kegagalan kredensial (pengguna tidak
+// ditemukan, password salah, atau akun/IP dibatasi). Alasan sebenarnya hanya dicatat di log server.
+func writeInvalidCredentials(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="Area Terproteksi"`)
+	http.Error(w, "Kredensial tidak valid.", http.StatusUnauthorized)
+}
+
 // basicAuthMiddleware adalah middleware untuk Basic Authentication.
 func basicAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -150,31 +745,73 @@ func basicAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 		email := pair[0]
 		password := pair[1]
+		ip := clientIP(r)
 
-		user, err := findUserByemail(email) // mencari email dari tabel user
+		// Tolak tanpa memeriksa password jika akun atau IP sedang dalam jeda atau terkunci.
+		// Respons sama persis dengan password salah agar penguncian tidak bisa dibedakan.
+		// Jika status pembatasan tidak bisa dibaca, request ditolak (fail closed) agar gangguan database
+		// tidak bisa dipakai untuk melewati penguncian; responsnya 503 agar klien tidak mengira password salah.
+		blocked, err := loginBlocked(email, ip)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			http.Error(w, "Layanan autentikasi sedang tidak tersedia. Coba lagi nanti.", http.StatusServiceUnavailable)
+			return
+		}
+		if blocked {
+			log.Printf("Upaya login ditolak: Akun '%s' atau IP %s sedang dibatasi.", email, ip)
+			writeInvalidCredentials(w)
+			return
+		}
+
+		// Kredensial yang baru saja terverifikasi tidak perlu di-hash ulang
+		if user, ok := cachedUser(authHeader, email); ok {
+			ctx := context.WithValue(r.Context(), userContextKey, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
 
-		//jika pengguna tidak ditemukan
+		// Percobaan dicatat sebelum password diverifikasi, dan keputusannya diambil dari hasil pencatatan itu.
+		// Pemeriksaan loginBlocked di atas saja tidak cukup: percobaan yang datang bersamaan semuanya bisa
+		// lolos pemeriksaan tersebut sebelum salah satunya sempat mencatat kegagalan.
+		blocked, err = reserveLogin(email, ip)
 		if err != nil {
-			log.Printf("Upaya login gagal: Pengguna '%s' tidak ditemukan: %v", email, err)
-			w.Header().Set("WWW-Authenticate", `Basic realm="Area Terproteksi"`)
-			http.Error(w, "Kredensial tidak valid (pengguna tidak ditemukan).", http.StatusUnauthorized)
+			log.Printf("Error: %v", err)
+			http.Error(w, "Layanan autentikasi sedang tidak tersedia. Coba lagi nanti.", http.StatusServiceUnavailable)
+			return
+		}
+		if blocked {
+			log.Printf("Upaya login ditolak: Akun '%s' atau IP %s sedang dibatasi.", email, ip)
+			writeInvalidCredentials(w)
 			return
 		}
 
-		//jika password tidak sesuai dengan email
-		if !verifyPassword(password, user.Password) {
-			log.Printf("Upaya login gagal: Password salah untuk pengguna '%s'.", email)
-			w.Header().Set("WWW-Authenticate", `Basic realm="Area Terproteksi"`)
-			http.Error(w, "Kredensial tidak valid (password salah).", http.StatusUnauthorized)
+		// Pengguna tidak ditemukan dan password salah menghasilkan respons dan waktu yang sama.
+		// Kegagalan sudah terhitung oleh reserveLogin.
+		user, err := authenticateUser(email, password)
+		if err != nil {
+			log.Printf("Upaya login gagal dari IP %s: %v", ip, err)
+			writeInvalidCredentials(w)
 			return
 		}
 
-		// Autentikasi berhasil. Anda bisa menyimpan info user di context jika perlu.
-		// Untuk contoh ini, kita langsung panggil handler berikutnya.
+		// Autentikasi berhasil: reset penghitung kegagalan akun dan simpan kredensial di cache
+		resetAccountFailures(email, ip)
+		credentialCache.put(authHeader, user, time.Now())
 		log.Printf("Pengguna '%s' berhasil login.", email)
-		// Simpan email di context untuk digunakan oleh handler (opsional)
-		// ctx := context.WithValue(r.Context(), "email", user.email)
-		// next.ServeHTTP(w, r.WithContext(ctx))
+		// Simpan user di context untuk digunakan oleh handler (misalnya requireAdmin)
+		ctx := context.WithValue(r.Context(), userContextKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+// requireAdmin membatasi handler untuk pengguna di adminEmails. Harus dipasang di dalam basicAuthMiddleware.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value(userContextKey).(User)
+		if !ok || !adminEmails[strings.ToLower(user.Email)] {
+			http.Error(w, "Akses ditolak: hanya admin.", http.StatusForbidden)
+			return
+		}
 		next.ServeHTTP(w, r)
 	}
 }
@@ -198,6 +835,11 @@ func registerUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if violations := passwordPolicy.Check(creds.Email, creds.Password); len(violations) > 0 {
+		passwords.WriteViolations(w, violations)
+		return
+	}
+
 	user, err := addUser(creds.Email, creds.Password)
 	if err != nil {
 		if strings.Contains(err.Error(), "sudah digunakan") {
@@ -216,6 +858,107 @@ func registerUserHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// adminUnlockHandler membuka kunci login untuk akun dan/atau IP tertentu.
+// Body: {"email": "...", "ip": "..."} (minimal salah satu).
+func adminUnlockHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+		IP    string `json:"ip"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Request body tidak valid.", http.StatusBadRequest)
+		return
+	}
+	if req.Email == "" && req.IP == "" {
+		http.Error(w, "email atau ip diperlukan.", http.StatusBadRequest)
+		return
+	}
+
+	removed, err := unlockLogin(req.Email, req.IP)
+	if err != nil {
+		log.Printf("Error membuka kunci login: %v", err)
+		http.Error(w, "Error internal server saat membuka kunci.", http.StatusInternalServerError)
+		return
+	}
+	admin := r.Context().Value(userContextKey).(User)
+	log.Printf("Kunci login untuk email '%s' / IP '%s' dibuka oleh admin '%s'.", req.Email, req.IP, admin.Email)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  "Kunci login berhasil dibuka.",
+		"unlocked": removed > 0,
+	})
+}
+
+// changePasswordHandler mengganti password pengguna yang sedang login.
+// Body: {"new_password": "..."}. Password lama sudah diverifikasi oleh basicAuthMiddleware.
+func changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		NewPassword string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Request body tidak valid.", http.StatusBadRequest)
+		return
+	}
+	if req.NewPassword == "" {
+		http.Error(w, "new_password diperlukan.", http.StatusBadRequest)
+		return
+	}
+
+	user := r.Context().Value(userContextKey).(User)
+	if violations := passwordPolicy.Check(user.Email, req.NewPassword); len(violations) > 0 {
+		passwords.WriteViolations(w, violations)
+		return
+	}
+	if err := changePassword(user.ID, req.NewPassword); err != nil {
+		log.Printf("Error mengganti password pengguna '%s': %v", user.Email, err)
+		http.Error(w, "Error internal server saat mengganti password.", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Pengguna '%s' mengganti password.", user.Email)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password berhasil diganti."})
+}
+
+// adminSetUserActiveHandler mengembalikan handler untuk menonaktifkan (active = false) atau mengaktifkan
+// kembali akun pengguna. Body: {"email": "..."}.
+func adminSetUserActiveHandler(active bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Request body tidak valid.", http.StatusBadRequest)
+			return
+		}
+		if req.Email == "" {
+			http.Error(w, "email diperlukan.", http.StatusBadRequest)
+			return
+		}
+		admin := r.Context().Value(userContextKey).(User)
+		if !active && strings.EqualFold(req.Email, admin.Email) {
+			http.Error(w, "Admin tidak dapat menonaktifkan akunnya sendiri.", http.StatusBadRequest)
+			return
+		}
+
+		user, err := setUserActive(req.Email, active)
+		if err != nil {
+			if strings.Contains(err.Error(), "tidak ditemukan") {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			log.Printf("Error mengubah status pengguna '%s': %v", req.Email, err)
+			http.Error(w, "Error internal server saat mengubah status pengguna.", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Status aktif pengguna '%s' diubah menjadi %t oleh admin '%s'.", user.Email, active, admin.Email)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
+	}
+}
+
 // protectedDataHandler menangani permintaan ke endpoint yang dilindungi.
 func protectedDataHandler(w http.ResponseWriter, r *http.Request) {
 	// email := r.Context().Value("email").(string) // Ambil email dari context jika disimpan
@@ -250,13 +993,43 @@ func logHandler(next http.Handler) http.Handler {
 // --- Fungsi Main ---
 
 func main() {
+	if raw := os.Getenv("ADMIN_EMAILS"); raw != "" {
+		adminEmails = map[string]bool{}
+		for _, email := range strings.Split(raw, ",") {
+			if email = strings.TrimSpace(email); email != "" {
+				adminEmails[strings.ToLower(email)] = true
+			}
+		}
+	}
+
+	// Muat hasher dan kebijakan password (termasuk daftar password bocor)
+	hasher, policy, err := passwords.FromEnv()
+	if err != nil {
+		log.Fatalf("Error konfigurasi password: %v", err)
+	}
+	passwordHasher, passwordPolicy = hasher, policy
+	log.Printf("Password baru di-hash dengan %s.", passwordHasher.Algorithm)
+	log.Printf("Memuat %d prefix SHA-1 password bocor dari %s.", policy.BreachedCount(), policy.BreachedSource)
+
+	limits, err := loadLoginLimits()
+	if err != nil {
+		log.Fatalf("Error konfigurasi pembatasan login: %v", err)
+	}
+	loginLimits = limits
+
 	// Inisialisasi database
 	initDB()
 	defer db.Close() // Pastikan koneksi database ditutup saat aplikasi berhenti
 
-	// Inisialisasi pengguna admin jika argumen "initadmin" diberikan
+	// Inisialisasi pengguna admin jika argumen "initadmin" diberikan: go run main.go initadmin <password>
 	if len(os.Args) > 1 && os.Args[1] == "initadmin" {
-		_, err := addUser("admin", "password123")
+		if len(os.Args) < 3 {
+			log.Fatal("Penggunaan: go run main.go initadmin <password>")
+		}
+		if err := passwordPolicy.CheckErr("admin", os.Args[2]); err != nil {
+			log.Fatal(err)
+		}
+		_, err := addUser("admin", os.Args[2])
 		if err != nil {
 			if strings.Contains(err.Error(), "sudah digunakan") {
 				log.Println("Pengguna 'admin' sudah ada.")
@@ -264,12 +1037,41 @@ func main() {
 				log.Printf("Error menambahkan pengguna admin: %v", err)
 			}
 		} else {
-			log.Println("Pengguna 'admin' berhasil ditambahkan dengan password 'password123'.")
+			log.Println("Pengguna 'admin' berhasil ditambahkan.")
 		}
 		// Keluar setelah inisialisasi admin agar tidak menjalankan server
 		return
 	}
 
+	// Buka kunci login dari command line: go run main.go unlock <email>
+	if len(os.Args) > 1 && os.Args[1] == "unlock" {
+		if len(os.Args) < 3 {
+			log.Fatal("Penggunaan: go run main.go unlock <email> [ip]")
+		}
+		ip := ""
+		if len(os.Args) > 3 {
+			ip = os.Args[3]
+		}
+		removed, err := unlockLogin(os.Args[2], ip)
+		if err != nil {
+			log.Fatalf("Error membuka kunci login: %v", err)
+		}
+		if removed == 0 {
+			log.Printf("Tidak ada kegagalan login yang tercatat untuk '%s'.", os.Args[2])
+		} else {
+			log.Printf("Kunci login untuk '%s' berhasil dibuka.", os.Args[2])
+		}
+		return
+	}
+
+	// Dummy hash untuk pengguna yang tidak ditemukan harus ada sebelum server menerima request
+	if err := initDummyPasswordHash(); err != nil {
+		log.Fatalf("Error membuat dummy password hash: %v", err)
+	}
+
+	// Hapus penghitung kegagalan login yang sudah kedaluwarsa secara berkala
+	startLoginFailureCleanup(loginFailureCleanupInterval)
+
 	// Router
 	r := mux.NewRouter()
 
@@ -280,6 +1082,10 @@ func main() {
 	r.HandleFunc("/register", registerUserHandler).Methods("POST")
 	r.HandleFunc("/api/public-data", publicDataHandler).Methods("GET")
 	r.HandleFunc("/api/protected-data", basicAuthMiddleware(protectedDataHandler)).Methods("GET")
+	r.HandleFunc("/api/change-password", basicAuthMiddleware(changePasswordHandler)).Methods("POST")
+	r.HandleFunc("/admin/unlock", basicAuthMiddleware(requireAdmin(adminUnlockHandler))).Methods("POST")
+	r.HandleFunc("/admin/users/disable", basicAuthMiddleware(requireAdmin(adminSetUserActiveHandler(false)))).Methods("POST")
+	r.HandleFunc("/admin/users/enable", basicAuthMiddleware(requireAdmin(adminSetUserActiveHandler(true)))).Methods("POST")
 
 	// Handler untuk rute tidak ditemukan
 	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -288,10 +1094,10 @@ func main() {
 
 	port := "8080" // Port server Go
 	log.Printf("Server Go berjalan di http://localhost:%s", port)
-	log.Println("Gunakan 'go run main.go initadmin' untuk membuat pengguna 'admin' jika belum ada.")
+	log.Println("Gunakan 'go run main.go initadmin <password>' untuk membuat pengguna 'admin' jika belum ada.")
 
 	// Mulai server HTTP
-	err := http.ListenAndServe(":"+port, r)
+	err = http.ListenAndServe(":"+port, r)
 	if err != nil {
 		log.Fatalf("Error memulai server: %v", err)
 	}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/tiers-undiknas/api-passwords"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// useMockDB mengganti db global dengan sqlmock selama test berjalan.
+func useMockDB(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	mockDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	previous := db
+	db = mockDB
+	t.Cleanup(func() {
+		db = previous
+		mockDB.Close()
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("ekspektasi sqlmock tidak terpenuhi: %v", err)
+		}
+	})
+	return mock
+}
+
+func TestLoadLoginLimits(t *testing.T) {
+	t.Setenv("ACCOUNT_LOCKOUT_THRESHOLD", "5")
+	t.Setenv("LOGIN_LOCKOUT_DURATION", "1h")
+	limits, err := loadLoginLimits()
+	if err != nil {
+		t.Fatalf("loadLoginLimits: %v", err)
+	}
+	if limits.AccountLockoutThreshold != 5 || limits.LockoutDuration != time.Hour {
+		t.Errorf("override tidak dipakai: %+v", limits)
+	}
+	if limits.IPLockoutThreshold != ipLockoutThreshold || limits.FailureWindow != loginFailureWindow {
+		t.Errorf("nilai default berubah: %+v", limits)
+	}
+
+	for env, value := range map[string]string{
+		"LOGIN_BACKOFF_THRESHOLD": "0",
+		"IP_LOCKOUT_THRESHOLD":    "banyak",
+		"LOGIN_FAILURE_WINDOW":    "15",
+		"LOGIN_BACKOFF_MAX":       "500ms",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := loadLoginLimits(); err == nil {
+				t.Errorf("%s=%q seharusnya ditolak", env, value)
+			}
+		})
+	}
+}
+
+func TestLoginBlockDelay(t *testing.T) {
+	limits := LoginLimits{BackoffThreshold: 3, BackoffBase: time.Second, BackoffMax: 30 * time.Second, LockoutDuration: 15 * time.Minute}
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 1, want: 0},
+		{failures: 2, want: 0},
+		{failures: 3, want: time.Second},
+		{failures: 4, want: 2 * time.Second},
+		{failures: 6, want: 8 * time.Second},
+		{failures: 9, want: 30 * time.Second}, // 64 detik dipotong ke BackoffMax
+		{failures: 10, want: 15 * time.Minute},
+		{failures: 25, want: 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := limits.loginBlockDelay(tt.failures, 10); got != tt.want {
+			t.Errorf("loginBlockDelay(%d) = %s, ingin %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+// useTestLoginLimits mengganti loginLimits selama test berjalan.
+func useTestLoginLimits(t *testing.T, limits LoginLimits) {
+	t.Helper()
+	previous := loginLimits
+	loginLimits = limits
+	t.Cleanup(func() { loginLimits = previous })
+}
+
+// expectReserveAttempt menambahkan ekspektasi satu transaksi reserveLoginAttempt. failures dan blocked adalah
+// isi baris setelah penghitung ditambah, seperti yang dilihat transaksi tersebut.
+func expectReserveAttempt(mock sqlmock.Sqlmock, scope, subject string, failures int, blocked bool, lockout time.Duration) {
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO login_failures")).WithArgs(scope, subject, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT failures, COALESCE(blocked_until > CURRENT_TIMESTAMP, FALSE) FROM login_failures")).
+		WithArgs(scope, subject).WillReturnRows(sqlmock.NewRows([]string{"failures", "blocked"}).AddRow(failures, blocked))
+	if lockout > 0 {
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE login_failures SET blocked_until = DATE_ADD(CURRENT_TIMESTAMP")).
+			WithArgs(int64(lockout.Seconds()), scope, subject).WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+}
+
+func TestReserveLoginAttemptConcurrent(t *testing.T) {
+	useTestLoginLimits(t, LoginLimits{FailureWindow: 15 * time.Minute, BackoffThreshold: 10, BackoffBase: time.Second, BackoffMax: time.Second, AccountLockoutThreshold: 2, IPLockoutThreshold: 50, LockoutDuration: 15 * time.Minute})
+	mock := useMockDB(t)
+
+	// Tiga percobaan untuk akun yang sama datang bersamaan dan semuanya lolos loginBlocked. MySQL menjalankan
+	// transaksinya satu per satu (baris dikunci), jadi masing-masing melihat hasil transaksi sebelumnya:
+	// percobaan kedua mencapai ambang dan memasang kunci, percobaan ketiga melihat kunci itu.
+	expectReserveAttempt(mock, failureScopeAccount, "budi@example.com", 1, false, 0)
+	expectReserveAttempt(mock, failureScopeAccount, "budi@example.com", 2, false, 15*time.Minute)
+	expectReserveAttempt(mock, failureScopeAccount, "budi@example.com", 2, true, 0)
+
+	want := []struct {
+		failures int
+		blocked  bool
+	}{{1, false}, {2, false}, {2, true}}
+	for i, w := range want {
+		failures, blocked, err := reserveLoginAttempt(failureScopeAccount, "budi@example.com", loginLimits.AccountLockoutThreshold)
+		if err != nil || failures != w.failures || blocked != w.blocked {
+			t.Errorf("percobaan %d: reserveLoginAttempt = (%d, %t, %v), ingin (%d, %t, nil)", i+1, failures, blocked, err, w.failures, w.blocked)
+		}
+	}
+}
+
+func TestBasicAuthMiddlewareDecidesFromReservation(t *testing.T) {
+	const email = "budi@example.com"
+	const password = "Kuda-Lari-Kencang-42"
+	header := "Basic " + base64.StdEncoding.EncodeToString([]byte(email+":"+password))
+	useTestCredentialCache(t, 10)
+	useTestLoginLimits(t, LoginLimits{FailureWindow: 15 * time.Minute, BackoffThreshold: 10, BackoffBase: time.Second, BackoffMax: time.Second, AccountLockoutThreshold: 2, IPLockoutThreshold: 50, LockoutDuration: 15 * time.Minute})
+	hash, err := passwordHasher.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	mock := useMockDB(t)
+	// Ekspektasi tidak harus berurutan, sehingga jika request pertama memverifikasi password meskipun
+	// reservasinya ditolak, ia akan memakai ekspektasi pencarian pengguna milik request kedua dan lolos.
+	mock.MatchExpectationsInOrder(false)
+	blockedQuery := regexp.QuoteMeta("SELECT COUNT(*) FROM login_failures")
+
+	// Request pertama lolos pemeriksaan awal, tetapi percobaan lain yang datang bersamaan sudah mengunci
+	// akun sebelum reservasinya tercatat. Password benar pun tidak boleh diverifikasi.
+	mock.ExpectQuery(blockedQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	expectReserveAttempt(mock, failureScopeAccount, email, 2, true, 0)
+
+	// Request kedua mendapat reservasi yang diizinkan dan berhasil login.
+	mock.ExpectQuery(blockedQuery).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	expectReserveAttempt(mock, failureScopeAccount, email, 1, false, 0)
+	expectReserveAttempt(mock, failureScopeIP, "192.0.2.1", 1, false, 0)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, email, password, is_active FROM user WHERE email = ?")).WithArgs(email).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password", "is_active"}).AddRow(7, email, hash, true))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM login_failures")).WithArgs(failureScopeAccount, email).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE login_failures SET failures = GREATEST(failures - 1, 0)")).WithArgs(failureScopeIP, "192.0.2.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT failures FROM login_failures")).WithArgs(failureScopeIP, "192.0.2.1").
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(0))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE login_failures SET blocked_until = NULL")).WithArgs(failureScopeIP, "192.0.2.1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	calls := 0
+	handler := basicAuthMiddleware(func(w http.ResponseWriter, r *http.Request) { calls++ })
+	for i, want := range []int{http.StatusUnauthorized, http.StatusOK} {
+		req := httptest.NewRequest(http.MethodGet, "/api/data", nil)
+		req.RemoteAddr = "192.0.2.1:40000"
+		req.Header.Set("Authorization", header)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Code != want {
+			t.Errorf("request %d: status = %d, ingin %d", i+1, w.Code, want)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("handler dipanggil %d kali, ingin 1", calls)
+	}
+}
+
+func TestInitDummyPasswordHashMatchesStoredHashes(t *testing.T) {
+	bcryptHash := func() string {
+		hash, err := bcrypt.GenerateFromPassword([]byte("password-lama"), bcrypt.MinCost)
+		if err != nil {
+			t.Fatalf("bcrypt: %v", err)
+		}
+		return string(hash)
+	}
+	argonHash, err := passwordHasher.Hash("password-baru")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	mock := useMockDB(t)
+	mock.ExpectQuery("SELECT password FROM user").
+		WithArgs(passwords.DummyHashSampleSize).
+		WillReturnRows(sqlmock.NewRows([]string{"password"}).
+			AddRow(bcryptHash()).AddRow(argonHash).AddRow(bcryptHash()).AddRow("bukan-hash"))
+	if err := initDummyPasswordHash(); err != nil {
+		t.Fatalf("initDummyPasswordHash: %v", err)
+	}
+	if cost, err := bcrypt.Cost([]byte(dummyPasswordHash)); err != nil || cost != bcrypt.MinCost {
+		t.Errorf("dummy hash harus mengikuti bcrypt cost %d yang dominan, didapat %q", bcrypt.MinCost, dummyPasswordHash)
+	}
+
+	mock.ExpectQuery("SELECT password FROM user").
+		WithArgs(passwords.DummyHashSampleSize).
+		WillReturnRows(sqlmock.NewRows([]string{"password"}))
+	if err := initDummyPasswordHash(); err != nil {
+		t.Fatalf("initDummyPasswordHash tanpa pengguna: %v", err)
+	}
+	if !strings.HasPrefix(dummyPasswordHash, "$"+passwords.DefaultHashAlgorithm+"$") {
+		t.Errorf("tanpa pengguna, dummy hash harus memakai %s, didapat %q", passwords.DefaultHashAlgorithm, dummyPasswordHash)
+	}
+
+	mock.ExpectQuery("SELECT password FROM user").
+		WithArgs(passwords.DummyHashSampleSize).
+		WillReturnError(sqlmock.ErrCancelled)
+	if err := initDummyPasswordHash(); err == nil {
+		t.Error("error database harus menggagalkan initDummyPasswordHash")
+	}
+}
+
+// useTestCredentialCache mengganti credentialCache dan passwordHasher (bcrypt cost minimum agar cepat)
+// selama test berjalan.
+func useTestCredentialCache(t *testing.T, max int) {
+	t.Helper()
+	previousCache, previousHasher := credentialCache, passwordHasher
+	credentialCache = newCredCache(time.Minute, max)
+	passwordHasher = passwords.NewHasher("bcrypt")
+	passwordHasher.BcryptCost = bcrypt.MinCost
+	t.Cleanup(func() { credentialCache, passwordHasher = previousCache, previousHasher })
+}
+
+func TestCachedCredentialsInvalidation(t *testing.T) {
+	const header = "Basic YnVkaUBleGFtcGxlLmNvbTpLdWRhLUxhcmktS2VuY2FuZy00Mg=="
+	const email = "budi@example.com"
+	user := User{ID: 7, Email: email, Password: "$2a$04$hashlama", Active: true}
+	userRow := func(password string, active bool) *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "email", "password", "is_active"}).AddRow(user.ID, email, password, active)
+	}
+	findUser := "SELECT id, email, password, is_active FROM user WHERE email = ?"
+
+	t.Run("changePassword", func(t *testing.T) {
+		useTestCredentialCache(t, 10)
+		mock := useMockDB(t)
+		credentialCache.put(header, user, time.Now())
+
+		mock.ExpectQuery(regexp.QuoteMeta(findUser)).WithArgs(email).WillReturnRows(userRow(user.Password, true))
+		if _, ok := cachedUser(header, email); !ok {
+			t.Fatal("header yang baru terverifikasi seharusnya ada di cache")
+		}
+
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE user SET password = ? WHERE id = ?")).
+			WithArgs(sqlmock.AnyArg(), user.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+		if err := changePassword(user.ID, "Password-Baru-2025"); err != nil {
+			t.Fatalf("changePassword: %v", err)
+		}
+		if _, ok := credentialCache.get(header, time.Now()); ok {
+			t.Error("changePassword seharusnya menghapus entri cache pengguna")
+		}
+		if _, ok := cachedUser(header, email); ok {
+			t.Error("header lama masih diterima dari cache setelah changePassword")
+		}
+	})
+
+	t.Run("setUserActive false", func(t *testing.T) {
+		useTestCredentialCache(t, 10)
+		mock := useMockDB(t)
+		credentialCache.put(header, user, time.Now())
+
+		mock.ExpectQuery(regexp.QuoteMeta(findUser)).WithArgs(email).WillReturnRows(userRow(user.Password, true))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE user SET is_active = ? WHERE id = ?")).
+			WithArgs(false, user.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+		if _, err := setUserActive(email, false); err != nil {
+			t.Fatalf("setUserActive: %v", err)
+		}
+		if _, ok := credentialCache.get(header, time.Now()); ok {
+			t.Error("setUserActive(false) seharusnya menghapus entri cache pengguna")
+		}
+		if _, ok := cachedUser(header, email); ok {
+			t.Error("header lama masih diterima dari cache setelah akun dinonaktifkan")
+		}
+	})
+
+	// Perubahan dari proses lain tidak memanggil invalidateUser; cachedUser harus menolaknya dari data database.
+	t.Run("perubahan di proses lain", func(t *testing.T) {
+		for name, row := range map[string]*sqlmock.Rows{
+			"password diganti":   userRow("$2a$04$hashbaru", true),
+			"akun dinonaktifkan": userRow(user.Password, false),
+		} {
+			t.Run(name, func(t *testing.T) {
+				useTestCredentialCache(t, 10)
+				mock := useMockDB(t)
+				credentialCache.put(header, user, time.Now())
+				mock.ExpectQuery(regexp.QuoteMeta(findUser)).WithArgs(email).WillReturnRows(row)
+				if _, ok := cachedUser(header, email); ok {
+					t.Error("entri cache yang sudah usang masih diterima")
+				}
+				if _, ok := credentialCache.get(header, time.Now()); ok {
+					t.Error("entri cache yang usang seharusnya dihapus")
+				}
+			})
+		}
+	})
+}
+
+func TestCredCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newCredCache(time.Minute, 2)
+	now := time.Now()
+	cache.put("Basic a", User{ID: 1}, now)
+	cache.put("Basic b", User{ID: 2}, now)
+	if _, ok := cache.get("Basic a", now); !ok {
+		t.Fatal("entri a seharusnya ada")
+	}
+	cache.put("Basic c", User{ID: 3}, now)
+
+	if _, ok := cache.get("Basic b", now); ok {
+		t.Error("entri b (paling lama tidak dipakai) seharusnya dibuang")
+	}
+	for _, header := range []string{"Basic a", "Basic c"} {
+		if _, ok := cache.get(header, now); !ok {
+			t.Errorf("entri %q seharusnya masih ada", header)
+		}
+	}
+	if _, ok := cache.get("Basic a", now.Add(time.Minute)); ok {
+		t.Error("entri yang kedaluwarsa seharusnya tidak dikembalikan")
+	}
+	if cache.order.Len() != len(cache.entries) {
+		t.Errorf("daftar LRU (%d) tidak sinkron dengan map (%d)", cache.order.Len(), len(cache.entries))
+	}
+}
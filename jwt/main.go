@@ -10,10 +10,10 @@ import (
 	"strings"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql" // Driver MySQL
-	"github.com/golang-jwt/jwt/v5"     // Untuk JWT
-	"github.com/gorilla/mux"           // Router
-	"golang.org/x/crypto/bcrypt"       // Untuk hashing password
+	_ "github.com/go-sql-driver/mysql"        // Driver MySQL
+	"github.com/golang-jwt/jwt/v5"            // Untuk JWT
+	"github.com/gorilla/mux"                  // Router
+	"github.com/tiers-undiknas/api-passwords" // Kebijakan dan hashing password bersama
 )
 
 // --- Konfigurasi ---
@@ -86,7 +86,7 @@ func initDB() {
 
 // addUser menambahkan pengguna baru ke database dengan password yang di-hash.
 func addUser(email, password string) (User, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := passwordHasher.Hash(password)
 	if err != nil {
 		return User{}, fmt.Errorf("error hashing password: %w", err)
 	}
@@ -134,12 +134,65 @@ func findUserByEmail(email string) (User, error) {
 	return user, nil
 }
 
-// verifyPassword membandingkan password plain text dengan hash yang tersimpan.
-func verifyPassword(plainPassword, hashedPassword string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(plainPassword))
-	return err == nil
+// dummyPasswordHash dibandingkan saat pengguna tidak ditemukan, agar waktu respons tidak membedakan email
+// terdaftar dan tidak terdaftar. Diisi oleh initDummyPasswordHash sebelum server mulai menerima request.
+var dummyPasswordHash string
+
+// initDummyPasswordHash membuat dummyPasswordHash dengan algoritma dan parameter yang paling banyak dipakai
+// oleh hash tersimpan pengguna terbaru (lihat passwords.DummyHashFrom), sehingga verifikasi untuk email yang
+// tidak terdaftar sama lamanya dengan verifikasi untuk akun pada umumnya. Tanpa pengguna, dipakai
+// konfigurasi hash baru.
+func initDummyPasswordHash() error {
+	dummy, err := passwords.LoadDummyHash(db, "SELECT password FROM user ORDER BY id DESC LIMIT ?", *passwordHasher)
+	if err != nil {
+		return err
+	}
+	dummyPasswordHash = dummy.Encoded
+	log.Printf("Dummy password hash memakai %s (dipakai %d dari hash tersimpan yang diperiksa).", dummy.Params.Describe(), dummy.Matches)
+	return nil
+}
+
+// authenticateUser memverifikasi email dan password dengan biaya hashing yang sama, baik pengguna
+// ditemukan maupun tidak. Error yang dikembalikan berisi alasan detail dan hanya untuk log server.
+// Hash dengan parameter lama di-rehash setelah verifikasi berhasil.
+func authenticateUser(email, password string) (User, error) {
+	// Pengguna yang tidak ditemukan (user.Password kosong) tetap diverifikasi terhadap dummyPasswordHash
+	user, err := findUserByEmail(email)
+	ok, needsRehash, verifyErr := passwordHasher.VerifyOrDummy(password, user.Password, dummyPasswordHash)
+	if err != nil {
+		return User{}, err
+	}
+	if verifyErr != nil {
+		return User{}, fmt.Errorf("gagal memverifikasi hash password pengguna '%s': %w", email, verifyErr)
+	}
+	if !ok {
+		return User{}, fmt.Errorf("password salah untuk pengguna '%s'", email)
+	}
+	if needsRehash {
+		newHash, err := passwordHasher.Rehash(db, "UPDATE user SET password = ? WHERE id = ? AND password = ?", user.ID, user.Password, password)
+		if err != nil {
+			// Login tetap sah dengan hash lama
+			log.Printf("Peringatan: hash password pengguna '%s' tidak diperbarui: %v", email, err)
+		} else {
+			log.Printf("Hash password pengguna '%s' diperbarui ke parameter terbaru.", email)
+			user.Password = newHash
+		}
+	}
+	return user, nil
 }
 
+// --- Hashing Password ---
+
+// passwordHasher dipakai oleh addUser dan authenticateUser. Hash dan verifikasi (argon2id, scrypt, bcrypt)
+// ada di paket passwords; algoritma bisa diganti dengan variabel lingkungan PASSWORD_HASH_ALGORITHM.
+var passwordHasher = passwords.NewHasher(passwords.DefaultHashAlgorithm)
+
+// --- Kebijakan Password ---
+
+// passwordPolicy adalah kebijakan password bersama dari paket passwords, dimuat di main dengan
+// passwords.FromEnv.
+var passwordPolicy = passwords.DefaultPolicy()
+
 // --- Fungsi-fungsi JWT ---
 
 // generateJWT membuat dan menandatangani JWT baru untuk pengguna.
@@ -237,8 +290,8 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Email dan password diperlukan.", http.StatusBadRequest)
 		return
 	}
-	if len(creds.Password) < 6 { // Contoh validasi panjang password
-		http.Error(w, "Password minimal harus 6 karakter.", http.StatusBadRequest)
+	if violations := passwordPolicy.Check(creds.Email, creds.Password); len(violations) > 0 {
+		passwords.WriteViolations(w, violations)
 		return
 	}
 
@@ -278,15 +331,10 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := findUserByEmail(creds.Email)
+	// Pengguna tidak ditemukan dan password salah menghasilkan respons dan waktu yang sama
+	user, err := authenticateUser(creds.Email, creds.Password)
 	if err != nil {
-		log.Printf("Upaya login gagal (pengguna tidak ditemukan): %s", creds.Email)
-		http.Error(w, "Email atau password salah.", http.StatusUnauthorized)
-		return
-	}
-
-	if !verifyPassword(creds.Password, user.Password) {
-		log.Printf("Upaya login gagal (password salah): %s", creds.Email)
+		log.Printf("Upaya login gagal: %v", err)
 		http.Error(w, "Email atau password salah.", http.StatusUnauthorized)
 		return
 	}
@@ -329,6 +377,15 @@ func publicHandler(w http.ResponseWriter, r *http.Request) {
 // --- Fungsi Main ---
 
 func main() {
+	// Muat hasher dan kebijakan password (termasuk daftar password bocor)
+	hasher, policy, err := passwords.FromEnv()
+	if err != nil {
+		log.Fatalf("Error konfigurasi password: %v", err)
+	}
+	passwordHasher, passwordPolicy = hasher, policy
+	log.Printf("Password baru di-hash dengan %s.", passwordHasher.Algorithm)
+	log.Printf("Memuat %d prefix SHA-1 password bocor dari %s.", policy.BreachedCount(), policy.BreachedSource)
+
 	// Inisialisasi database
 	initDB()
 	defer func() {
@@ -340,13 +397,12 @@ func main() {
 
 	// Inisialisasi pengguna admin jika argumen "initadmin" diberikan
 	if len(os.Args) > 1 && os.Args[1] == "initadmin" {
-		adminEmail := "admin@gmail.com"
-		adminPassword := "password123" // Ganti dengan password yang lebih aman jika perlu
-		if len(os.Args) > 2 {
-			adminEmail = os.Args[2]
+		if len(os.Args) < 4 {
+			log.Fatal("Penggunaan: go run main.go initadmin <email> <password>")
 		}
-		if len(os.Args) > 3 {
-			adminPassword = os.Args[3]
+		adminEmail, adminPassword := os.Args[2], os.Args[3]
+		if err := passwordPolicy.CheckErr(adminEmail, adminPassword); err != nil {
+			log.Fatal(err)
 		}
 
 		_, err := addUser(adminEmail, adminPassword)
@@ -357,11 +413,16 @@ func main() {
 				log.Printf("Error menambahkan pengguna '%s': %v", adminEmail, err)
 			}
 		} else {
-			log.Printf("Pengguna '%s' berhasil ditambahkan dengan password '%s'.", adminEmail, adminPassword)
+			log.Printf("Pengguna '%s' berhasil ditambahkan.", adminEmail)
 		}
 		return // Keluar setelah inisialisasi
 	}
 
+	// Dummy hash untuk pengguna yang tidak ditemukan harus ada sebelum server menerima request
+	if err := initDummyPasswordHash(); err != nil {
+		log.Fatalf("Error membuat dummy password hash: %v", err)
+	}
+
 	// Router
 	r := mux.NewRouter()
 
@@ -393,7 +454,7 @@ func main() {
 
 	port := "8080" // Port server Go
 	log.Printf("Server Go berjalan di http://localhost:%s", port)
-	log.Println("Gunakan 'go run main.go initadmin [email_opsional] [password_opsional]' untuk membuat pengguna awal jika diperlukan.")
+	log.Println("Gunakan 'go run main.go initadmin <email> <password>' untuk membuat pengguna awal jika diperlukan.")
 
 	// Mulai server HTTP
 	srv := &http.Server{
@@ -21,7 +21,7 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/tiers-undiknas/api-passwords"
 )
 
 // --- Konfigurasi ---
@@ -202,14 +202,52 @@ func loadTemplates() {
 }
 
 // --- Fungsi Helper ---
+
+// passwordHasher dipakai untuk password pengguna dan client secret. Hash dan verifikasi (argon2id, scrypt,
+// bcrypt) ada di paket passwords; algoritma bisa diganti dengan variabel lingkungan PASSWORD_HASH_ALGORITHM.
+// Hash bcrypt lama (cost 14) tetap diterima dan di-rehash setelah verifikasi berhasil.
+var passwordHasher = passwords.NewHasher(passwords.DefaultHashAlgorithm)
+
 func hashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return string(bytes), err
+	return passwordHasher.Hash(password)
+}
+
+// dummyPasswordHash dibandingkan saat pengguna tidak ditemukan, agar waktu respons login tidak membedakan
+// email terdaftar dan tidak terdaftar. Diisi oleh initDummyPasswordHash sebelum server mulai menerima request.
+var dummyPasswordHash string
+
+// initDummyPasswordHash membuat dummyPasswordHash dengan algoritma dan parameter yang paling banyak dipakai
+// oleh hash password pengguna terbaru (lihat passwords.DummyHashFrom), termasuk hash bcrypt lama yang belum
+// di-rehash. Tanpa pengguna, dipakai konfigurasi hash baru.
+func initDummyPasswordHash() error {
+	dummy, err := passwords.LoadDummyHash(db, "SELECT password FROM user ORDER BY id DESC LIMIT ?", *passwordHasher)
+	if err != nil {
+		return err
+	}
+	dummyPasswordHash = dummy.Encoded
+	log.Printf("Dummy password hash memakai %s (dipakai %d dari hash tersimpan yang diperiksa).", dummy.Params.Describe(), dummy.Matches)
+	return nil
+}
+
+// checkPassword membandingkan password (atau client secret) dengan hash tersimpan. needsRehash bernilai
+// true jika hash cocok tetapi memakai algoritma atau parameter lama. Hash kosong (pengguna tidak ditemukan)
+// diverifikasi terhadap dummyPasswordHash dan selalu menghasilkan ok = false.
+func checkPassword(password, hash string) (ok, needsRehash bool) {
+	ok, needsRehash, err := passwordHasher.VerifyOrDummy(password, hash, dummyPasswordHash)
+	if err != nil {
+		log.Printf("Peringatan: gagal memverifikasi hash: %v", err)
+		return false, false
+	}
+	return ok, needsRehash
 }
 
-func checkPassword(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err == nil
+// rehashSecret membuat hash baru dengan konfigurasi saat ini lalu menjalankan query UPDATE dengan
+// argumen (hash baru, id, hash lama) lewat passwords.PHCHasher.Rehash. Kegagalan hanya dicatat di log
+// karena verifikasi tetap sah.
+func rehashSecret(query string, id any, oldHash, secret string) {
+	if _, err := passwordHasher.Rehash(db, query, id, oldHash, secret); err != nil {
+		log.Printf("Peringatan: %v", err)
+	}
 }
 
 func generateSecureRandomString(length int) (string, error) {
@@ -529,8 +567,11 @@ func authorizeHandler(w http.ResponseWriter, r *http.Request) {
 		postScope := r.FormValue("scope")
 		postState := r.FormValue("state")
 
+		// Email yang tidak terdaftar tetap menjalankan satu verifikasi hash (terhadap dummyPasswordHash), agar
+		// waktu respons tidak membedakannya dari password yang salah
 		user, err := getUserByEmail(email)
-		if err != nil || !checkPassword(password, user.Password) {
+		passwordOK, needsRehash := checkPassword(password, user.Password)
+		if err != nil || !passwordOK {
 			// Redirect kembali ke form login dengan pesan error
 			errorMsg := url.QueryEscape("Email atau password salah.")
 			http.Redirect(w, r, fmt.Sprintf("/oauth/authorize?response_type=%s&client_id=%s&redirect_uri=%s&scope=%s&state=%s&error=%s",
@@ -538,7 +579,10 @@ func authorizeHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Pengguna berhasil login.
+		// Pengguna berhasil login. Perbarui hash password jika masih memakai parameter lama.
+		if needsRehash {
+			rehashSecret("UPDATE user SET password = ? WHERE id = ? AND password = ?", user.ID, user.Password, password)
+		}
 		// Di aplikasi nyata, di sini ada langkah persetujuan cakupan (scopes).
 		// Untuk contoh ini, kita anggap pengguna selalu setuju.
 		authCodeVal, err := generateSecureRandomString(32)
@@ -579,10 +623,14 @@ func tokenHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// Verifikasi client secret
-	if !checkPassword(clientSecret, client.ClientSecretHash) {
+	secretOK, needsRehash := checkPassword(clientSecret, client.ClientSecretHash)
+	if !secretOK {
 		http.Error(w, "client_secret tidak valid", http.StatusUnauthorized)
 		return
 	}
+	if needsRehash {
+		rehashSecret("UPDATE oauth_clients SET client_secret_hash = ? WHERE client_id = ? AND client_secret_hash = ?", client.ClientID, client.ClientSecretHash, clientSecret)
+	}
 
 	var accessToken, newRefreshTokenValue string
 	var expiresIn int64
@@ -691,9 +739,20 @@ func protectedResourceHandler(w http.ResponseWriter, r *http.Request) {
 
 // --- Fungsi Main ---
 func main() {
+	hasher, err := passwords.HasherFromEnv()
+	if err != nil {
+		log.Fatalf("Error konfigurasi password: %v", err)
+	}
+	passwordHasher = hasher
+	log.Printf("Password dan client secret baru di-hash dengan %s.", passwordHasher.Describe())
+
 	initDB()
 	loadTemplates()
 	defer db.Close()
+	// Dummy hash untuk pengguna yang tidak ditemukan harus ada sebelum server menerima request
+	if err := initDummyPasswordHash(); err != nil {
+		log.Fatalf("Error membuat dummy password hash: %v", err)
+	}
 
 	// Inisialisasi pengguna/klien awal jika ada argumen
 	if len(os.Args) > 1 {
@@ -0,0 +1,81 @@
+package passwords
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// DummyHashSampleSize adalah jumlah hash tersimpan (terbaru) yang dibaca LoadDummyHash untuk DummyHashFrom.
+const DummyHashSampleSize = 1000
+
+// dummyPassword adalah password yang di-hash menjadi dummy hash. Nilainya tidak rahasia karena dummy hash
+// tidak pernah menghasilkan login yang berhasil (lihat VerifyOrDummy).
+const dummyPassword = "dummy-password-untuk-pengguna-tidak-dikenal"
+
+// DummyHash adalah hash pembanding saat pengguna tidak ditemukan, agar waktu respons tidak membedakan
+// email terdaftar dan tidak terdaftar.
+type DummyHash struct {
+	Encoded string    // Hash yang diberikan ke VerifyOrDummy
+	Params  PHCHasher // Algoritma dan parameter yang dipakai
+	Matches int       // Jumlah hash tersimpan yang memakai parameter yang sama
+}
+
+// DummyHashFrom membuat dummy hash dengan algoritma dan parameter yang paling banyak dipakai oleh hashes,
+// sehingga verifikasi untuk email yang tidak terdaftar sama lamanya dengan verifikasi untuk akun pada
+// umumnya, termasuk selama hash lama (misalnya bcrypt cost 10) belum di-rehash. Hash yang tidak bisa dibaca
+// diabaikan; jika tidak ada yang bisa dibaca (misalnya belum ada pengguna), dipakai parameter fallback.
+func DummyHashFrom(hashes []string, fallback PHCHasher) (DummyHash, error) {
+	counts := make(map[PHCHasher]int)
+	for _, encoded := range hashes {
+		if params, err := ParseHash(encoded); err == nil {
+			counts[params]++
+		}
+	}
+
+	dummy := DummyHash{Params: fallback}
+	for params, n := range counts {
+		if n > dummy.Matches {
+			dummy.Params, dummy.Matches = params, n
+		}
+	}
+	encoded, err := dummy.Params.Hash(dummyPassword)
+	if err != nil {
+		return DummyHash{}, fmt.Errorf("gagal membuat dummy password hash (%s): %w", dummy.Params.Algorithm, err)
+	}
+	dummy.Encoded = encoded
+	return dummy, nil
+}
+
+// VerifyOrDummy memverifikasi password terhadap hash tersimpan encoded. Jika encoded kosong (pengguna tidak
+// ditemukan), password tetap diverifikasi terhadap dummy dengan biaya yang sama, tetapi hasilnya selalu
+// tidak cocok. Dengan begitu setiap percobaan login menjalankan tepat satu verifikasi hash.
+func (h *PHCHasher) VerifyOrDummy(password, encoded, dummy string) (bool, bool, error) {
+	if encoded == "" {
+		h.Verify(password, dummy)
+		return false, false, nil
+	}
+	return h.Verify(password, encoded)
+}
+
+// LoadDummyHash membaca hash tersimpan dengan query lalu membuat dummy hash dengan DummyHashFrom. query harus
+// mengembalikan satu kolom hash dan menerima satu argumen batas jumlah baris (DummyHashSampleSize), misalnya
+// "SELECT password FROM user ORDER BY id DESC LIMIT ?".
+func LoadDummyHash(db *sql.DB, query string, fallback PHCHasher) (DummyHash, error) {
+	rows, err := db.Query(query, DummyHashSampleSize)
+	if err != nil {
+		return DummyHash{}, fmt.Errorf("gagal membaca hash password tersimpan: %w", err)
+	}
+	defer rows.Close()
+	var hashes []string
+	for rows.Next() {
+		var encoded string
+		if err := rows.Scan(&encoded); err != nil {
+			return DummyHash{}, fmt.Errorf("gagal membaca hash password tersimpan: %w", err)
+		}
+		hashes = append(hashes, encoded)
+	}
+	if err := rows.Err(); err != nil {
+		return DummyHash{}, fmt.Errorf("gagal membaca hash password tersimpan: %w", err)
+	}
+	return DummyHashFrom(hashes, fallback)
+}
@@ -0,0 +1,64 @@
+package passwords
+
+import "testing"
+
+func TestDummyHashFrom(t *testing.T) {
+	old := testHasher("bcrypt")
+	current := testHasher("argon2id")
+	var stored []string
+	for i := 0; i < 3; i++ {
+		encoded, err := old.Hash("Kuda-Lari-Kencang-42")
+		if err != nil {
+			t.Fatalf("Hash: %v", err)
+		}
+		stored = append(stored, encoded)
+	}
+	encoded, err := current.Hash("Kuda-Lari-Kencang-42")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	stored = append(stored, encoded, "hash-rusak")
+
+	dummy, err := DummyHashFrom(stored, *current)
+	if err != nil {
+		t.Fatalf("DummyHashFrom: %v", err)
+	}
+	// Sebagian besar hash tersimpan masih bcrypt, jadi dummy hash harus bcrypt dengan cost yang sama
+	if dummy.Params.Describe() != old.Describe() || dummy.Matches != 3 {
+		t.Errorf("DummyHashFrom = %s (%d hash), ingin %s (3 hash)", dummy.Params.Describe(), dummy.Matches, old.Describe())
+	}
+	if params, err := ParseHash(dummy.Encoded); err != nil || params.Describe() != old.Describe() {
+		t.Errorf("ParseHash(dummy) = %v, %v; ingin %s", params.Describe(), err, old.Describe())
+	}
+
+	empty, err := DummyHashFrom(nil, *current)
+	if err != nil {
+		t.Fatalf("DummyHashFrom tanpa hash: %v", err)
+	}
+	if empty.Params != *current || empty.Matches != 0 {
+		t.Errorf("DummyHashFrom tanpa hash = %s, ingin fallback %s", empty.Params.Describe(), current.Describe())
+	}
+}
+
+func TestVerifyOrDummy(t *testing.T) {
+	h := testHasher("argon2id")
+	dummy, err := DummyHashFrom(nil, *h)
+	if err != nil {
+		t.Fatalf("DummyHashFrom: %v", err)
+	}
+	encoded, err := h.Hash("Kuda-Lari-Kencang-42")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	if ok, _, err := h.VerifyOrDummy("Kuda-Lari-Kencang-42", encoded, dummy.Encoded); err != nil || !ok {
+		t.Errorf("VerifyOrDummy password benar = %v, %v; ingin true, nil", ok, err)
+	}
+	if ok, _, err := h.VerifyOrDummy("salah", encoded, dummy.Encoded); err != nil || ok {
+		t.Errorf("VerifyOrDummy password salah = %v, %v; ingin false, nil", ok, err)
+	}
+	// Pengguna tidak ditemukan: bahkan password dummy itu sendiri tidak boleh cocok
+	if ok, needsRehash, err := h.VerifyOrDummy(dummyPassword, "", dummy.Encoded); err != nil || ok || needsRehash {
+		t.Errorf("VerifyOrDummy tanpa hash tersimpan = %v, %v, %v; ingin false, false, nil", ok, needsRehash, err)
+	}
+}
@@ -0,0 +1,33 @@
+package passwords
+
+import (
+	"fmt"
+	"os"
+)
+
+// HasherFromEnv membuat PHCHasher dengan algoritma dari variabel lingkungan PASSWORD_HASH_ALGORITHM, atau
+// DefaultHashAlgorithm jika kosong.
+func HasherFromEnv() (*PHCHasher, error) {
+	algorithm := os.Getenv("PASSWORD_HASH_ALGORITHM")
+	if algorithm == "" {
+		return NewHasher(DefaultHashAlgorithm), nil
+	}
+	if !IsHashAlgorithm(algorithm) {
+		return nil, fmt.Errorf("PASSWORD_HASH_ALGORITHM tidak dikenal: %q (gunakan argon2id, scrypt atau bcrypt)", algorithm)
+	}
+	return NewHasher(algorithm), nil
+}
+
+// FromEnv membuat hasher (HasherFromEnv) dan kebijakan password (LoadPolicy) dari variabel lingkungan,
+// konfigurasi yang dimuat di main oleh modul yang menyimpan password pengguna.
+func FromEnv() (*PHCHasher, Policy, error) {
+	hasher, err := HasherFromEnv()
+	if err != nil {
+		return nil, Policy{}, err
+	}
+	policy, err := LoadPolicy()
+	if err != nil {
+		return nil, Policy{}, fmt.Errorf("gagal memuat kebijakan password: %w", err)
+	}
+	return hasher, policy, nil
+}
@@ -0,0 +1,10 @@
+module github.com/tiers-undiknas/api-passwords
+
+go 1.23.4
+
+require (
+	github.com/DATA-DOG/go-sqlmock v1.5.2
+	golang.org/x/crypto v0.38.0
+)
+
+require golang.org/x/sys v0.33.0 // indirect
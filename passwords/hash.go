@@ -0,0 +1,258 @@
+package passwords
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// --- Konfigurasi Hashing Password ---
+// Hash baru dibuat dengan DefaultHashAlgorithm (modul pemakai bisa menggantinya dengan variabel
+// lingkungan PASSWORD_HASH_ALGORITHM: argon2id, scrypt atau bcrypt). Hash lama dengan algoritma atau
+// parameter berbeda tetap diterima dan di-rehash otomatis setelah login berhasil.
+const (
+	DefaultHashAlgorithm = "argon2id"
+	bcryptCost           = 12
+	scryptLogN           = 15 // N = 2^15
+	scryptR              = 8
+	scryptP              = 1
+	argon2Memory         = 64 * 1024 // KiB (64 MiB)
+	argon2Time           = 3
+	argon2Threads        = 2
+	saltLength           = 16 // byte
+	hashKeyLength        = 32 // byte
+)
+
+// Batas parameter yang dibaca dari hash tersimpan. Parameter di luar batas ditolak sebelum hash dihitung,
+// karena hash yang rusak atau sengaja dimanipulasi bisa membuat verifikasi panik (misalnya argon2 p=0)
+// atau menghabiskan memori (m atau N yang sangat besar).
+const (
+	maxHashMemory    = 1 << 30 // byte (1 GiB), berlaku untuk argon2id (m) dan scrypt (128*r*N)
+	maxArgon2Time    = 16
+	maxScryptLogN    = 30
+	maxScryptP       = 16
+	minHashKeyLength = 16 // byte
+	maxHashKeyLength = 64 // byte
+)
+
+// Hasher membuat dan memverifikasi hash password dalam format string PHC
+// ($<algoritma>$<parameter>$<salt>$<hash>). Hash bcrypt ($2a$/$2b$/$2y$) juga diterima.
+type Hasher interface {
+	// Hash membuat hash baru dengan algoritma dan parameter yang dikonfigurasi.
+	Hash(password string) (string, error)
+	// Verify memeriksa password terhadap hash tersimpan. needsRehash bernilai true jika password cocok
+	// tetapi hash memakai algoritma atau parameter yang berbeda dari konfigurasi saat ini.
+	Verify(password, encoded string) (ok, needsRehash bool, err error)
+}
+
+// Argon2Params adalah parameter argon2id: memori (KiB), iterasi, jumlah thread dan panjang hash.
+type Argon2Params struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	KeyLen  int
+}
+
+// ScryptParams adalah parameter scrypt: log2(N), r, p dan panjang hash.
+type ScryptParams struct {
+	LogN   int
+	R      int
+	P      int
+	KeyLen int
+}
+
+// PHCHasher adalah Hasher untuk bcrypt, scrypt dan argon2id. Hash baru dibuat dengan Algorithm,
+// sedangkan verifikasi menerima ketiga algoritma agar hash lama tetap berlaku sampai di-rehash.
+// PHCHasher bisa dibandingkan dengan ==, sehingga bisa dipakai sebagai kunci map.
+type PHCHasher struct {
+	Algorithm  string
+	BcryptCost int
+	Scrypt     ScryptParams
+	Argon2     Argon2Params
+	SaltLen    int
+}
+
+// NewHasher membuat PHCHasher dengan parameter dari blok Konfigurasi Hashing Password.
+func NewHasher(algorithm string) *PHCHasher {
+	return &PHCHasher{
+		Algorithm:  algorithm,
+		BcryptCost: bcryptCost,
+		Scrypt:     ScryptParams{LogN: scryptLogN, R: scryptR, P: scryptP, KeyLen: hashKeyLength},
+		Argon2:     Argon2Params{Memory: argon2Memory, Time: argon2Time, Threads: argon2Threads, KeyLen: hashKeyLength},
+		SaltLen:    saltLength,
+	}
+}
+
+// IsHashAlgorithm memeriksa apakah algoritma didukung PHCHasher.
+func IsHashAlgorithm(algorithm string) bool {
+	return algorithm == "bcrypt" || algorithm == "scrypt" || algorithm == "argon2id"
+}
+
+// Hash membuat hash password dengan algoritma yang dikonfigurasi.
+func (h *PHCHasher) Hash(password string) (string, error) {
+	if h.Algorithm == "bcrypt" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("gagal hashing password dengan bcrypt: %w", err)
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, h.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("gagal membuat salt: %w", err)
+	}
+	b64 := base64.RawStdEncoding
+	switch h.Algorithm {
+	case "scrypt":
+		p := h.Scrypt
+		key, err := scrypt.Key([]byte(password), salt, 1<<p.LogN, p.R, p.P, p.KeyLen)
+		if err != nil {
+			return "", fmt.Errorf("gagal hashing password dengan scrypt: %w", err)
+		}
+		return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", p.LogN, p.R, p.P, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+	case "argon2id":
+		p := h.Argon2
+		key := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, uint32(p.KeyLen))
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, p.Memory, p.Time, p.Threads, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+	}
+	return "", fmt.Errorf("algoritma hash password tidak dikenal: %q", h.Algorithm)
+}
+
+// Verify memeriksa password terhadap hash bcrypt, scrypt atau argon2id.
+func (h *PHCHasher) Verify(password, encoded string) (bool, bool, error) {
+	params, salt, key, err := decodeHash(encoded)
+	if err != nil {
+		return false, false, err
+	}
+	switch params.Algorithm {
+	case "bcrypt":
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, fmt.Errorf("hash bcrypt tidak valid: %w", err)
+		}
+		return true, h.Algorithm != "bcrypt" || params.BcryptCost != h.BcryptCost, nil
+
+	case "scrypt":
+		p := params.Scrypt
+		derived, err := scrypt.Key([]byte(password), salt, 1<<p.LogN, p.R, p.P, p.KeyLen)
+		if err != nil {
+			return false, false, fmt.Errorf("gagal menghitung scrypt: %w", err)
+		}
+		if subtle.ConstantTimeCompare(derived, key) != 1 {
+			return false, false, nil
+		}
+		return true, h.Algorithm != "scrypt" || p != h.Scrypt, nil
+	}
+
+	p := params.Argon2
+	derived := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, uint32(p.KeyLen))
+	if subtle.ConstantTimeCompare(derived, key) != 1 {
+		return false, false, nil
+	}
+	return true, h.Algorithm != "argon2id" || p != h.Argon2, nil
+}
+
+// Describe meringkas algoritma dan parameter hasher untuk log.
+func (h *PHCHasher) Describe() string {
+	switch h.Algorithm {
+	case "bcrypt":
+		return fmt.Sprintf("bcrypt cost %d", h.BcryptCost)
+	case "scrypt":
+		return fmt.Sprintf("scrypt ln=%d,r=%d,p=%d", h.Scrypt.LogN, h.Scrypt.R, h.Scrypt.P)
+	}
+	return fmt.Sprintf("argon2id m=%d,t=%d,p=%d", h.Argon2.Memory, h.Argon2.Time, h.Argon2.Threads)
+}
+
+// ParseHash membaca algoritma dan parameter hash tersimpan ke PHCHasher, sehingga hash lain bisa dibuat
+// dengan parameter yang sama (misalnya dummy hash untuk pengguna yang tidak ditemukan).
+func ParseHash(encoded string) (PHCHasher, error) {
+	params, _, _, err := decodeHash(encoded)
+	return params, err
+}
+
+// decodeHash membaca parameter, salt dan nilai hash dari hash tersimpan, lalu memeriksa parameternya
+// terhadap batas di atas. Untuk bcrypt, salt dan key bernilai nil karena perbandingannya dilakukan oleh
+// paket bcrypt (yang memeriksa cost-nya sendiri).
+func decodeHash(encoded string) (params PHCHasher, salt, key []byte, err error) {
+	switch {
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		cost, err := bcrypt.Cost([]byte(encoded))
+		if err != nil {
+			return params, nil, nil, fmt.Errorf("hash bcrypt tidak valid: %w", err)
+		}
+		return PHCHasher{Algorithm: "bcrypt", BcryptCost: cost}, nil, nil, nil
+
+	case strings.HasPrefix(encoded, "$scrypt$"):
+		params.Algorithm = "scrypt"
+		p := &params.Scrypt
+		salt, key, err = parsePHCHash(encoded, 5, func(fields []string) error {
+			_, err := fmt.Sscanf(fields[2], "ln=%d,r=%d,p=%d", &p.LogN, &p.R, &p.P)
+			return err
+		})
+		if err != nil {
+			return params, nil, nil, err
+		}
+		if p.LogN < 1 || p.LogN > maxScryptLogN || p.R < 1 || p.R > maxHashMemory/128 || p.P < 1 || p.P > maxScryptP ||
+			int64(128*p.R)<<p.LogN > maxHashMemory {
+			return params, nil, nil, fmt.Errorf("parameter scrypt tidak valid: ln=%d,r=%d,p=%d", p.LogN, p.R, p.P)
+		}
+		p.KeyLen, params.SaltLen = len(key), len(salt)
+		return params, salt, key, nil
+
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		params.Algorithm = "argon2id"
+		p := &params.Argon2
+		var version int
+		salt, key, err = parsePHCHash(encoded, 6, func(fields []string) error {
+			if _, err := fmt.Sscanf(fields[2], "v=%d", &version); err != nil {
+				return err
+			}
+			_, err := fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads)
+			return err
+		})
+		if err != nil {
+			return params, nil, nil, err
+		}
+		if version != argon2.Version {
+			return params, nil, nil, fmt.Errorf("versi argon2 tidak didukung: %d", version)
+		}
+		if p.Threads < 1 || p.Time < 1 || p.Time > maxArgon2Time ||
+			p.Memory < 8*uint32(p.Threads) || int64(p.Memory)*1024 > maxHashMemory {
+			return params, nil, nil, fmt.Errorf("parameter argon2id tidak valid: m=%d,t=%d,p=%d", p.Memory, p.Time, p.Threads)
+		}
+		p.KeyLen, params.SaltLen = len(key), len(salt)
+		return params, salt, key, nil
+	}
+	return params, nil, nil, errors.New("format hash password tidak dikenal")
+}
+
+// parsePHCHash memecah string PHC menjadi fieldCount bagian, memanggil parseParams untuk bagian parameter,
+// lalu mendekode salt dan hash (dua bagian terakhir, base64 tanpa padding).
+func parsePHCHash(encoded string, fieldCount int, parseParams func(fields []string) error) (salt, key []byte, err error) {
+	fields := strings.Split(encoded, "$")
+	if len(fields) != fieldCount {
+		return nil, nil, errors.New("format hash PHC tidak valid")
+	}
+	if err := parseParams(fields); err != nil {
+		return nil, nil, fmt.Errorf("parameter hash PHC tidak valid: %w", err)
+	}
+	b64 := base64.RawStdEncoding
+	if salt, err = b64.DecodeString(fields[fieldCount-2]); err != nil {
+		return nil, nil, fmt.Errorf("salt hash PHC tidak valid: %w", err)
+	}
+	if key, err = b64.DecodeString(fields[fieldCount-1]); err != nil || len(key) < minHashKeyLength || len(key) > maxHashKeyLength {
+		return nil, nil, errors.New("nilai hash PHC tidak valid")
+	}
+	return salt, key, nil
+}
@@ -0,0 +1,133 @@
+package passwords
+
+import (
+	"strings"
+	"testing"
+)
+
+// testHasher membuat PHCHasher dengan parameter murah agar test cepat.
+func testHasher(algorithm string) *PHCHasher {
+	h := NewHasher(algorithm)
+	h.BcryptCost = 4
+	h.Scrypt = ScryptParams{LogN: 10, R: 8, P: 1, KeyLen: 32}
+	h.Argon2 = Argon2Params{Memory: 1024, Time: 1, Threads: 1, KeyLen: 32}
+	return h
+}
+
+func TestHasherRoundTrip(t *testing.T) {
+	for _, algorithm := range []string{"bcrypt", "scrypt", "argon2id"} {
+		t.Run(algorithm, func(t *testing.T) {
+			h := testHasher(algorithm)
+			encoded, err := h.Hash("Kuda-Lari-Kencang-42")
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if algorithm != "bcrypt" && !strings.HasPrefix(encoded, "$"+algorithm+"$") {
+				t.Errorf("hash %q tidak berformat PHC %s", encoded, algorithm)
+			}
+
+			ok, needsRehash, err := h.Verify("Kuda-Lari-Kencang-42", encoded)
+			if err != nil || !ok || needsRehash {
+				t.Errorf("Verify password benar = %v, %v, %v; ingin true, false, nil", ok, needsRehash, err)
+			}
+			ok, _, err = h.Verify("kuda-lari-kencang-42", encoded)
+			if err != nil || ok {
+				t.Errorf("Verify password salah = %v, %v; ingin false, nil", ok, err)
+			}
+
+			params, err := ParseHash(encoded)
+			if err != nil {
+				t.Fatalf("ParseHash: %v", err)
+			}
+			if params.Algorithm != algorithm || params.Describe() != h.Describe() {
+				t.Errorf("ParseHash = %s, ingin %s", params.Describe(), h.Describe())
+			}
+		})
+	}
+}
+
+func TestHasherNeedsRehash(t *testing.T) {
+	stored := map[string]string{}
+	for _, algorithm := range []string{"bcrypt", "scrypt", "argon2id"} {
+		encoded, err := testHasher(algorithm).Hash("Kuda-Lari-Kencang-42")
+		if err != nil {
+			t.Fatalf("Hash %s: %v", algorithm, err)
+		}
+		stored[algorithm] = encoded
+	}
+
+	tests := []struct {
+		name   string
+		stored string
+		change func(h *PHCHasher)
+		want   bool
+	}{
+		{"bcrypt cost sama", "bcrypt", func(h *PHCHasher) {}, false},
+		{"bcrypt cost naik", "bcrypt", func(h *PHCHasher) { h.BcryptCost = 5 }, true},
+		{"bcrypt ke argon2id", "bcrypt", func(h *PHCHasher) { h.Algorithm = "argon2id" }, true},
+		{"scrypt ln naik", "scrypt", func(h *PHCHasher) { h.Scrypt.LogN = 11 }, true},
+		{"scrypt panjang hash berubah", "scrypt", func(h *PHCHasher) { h.Scrypt.KeyLen = 64 }, true},
+		{"argon2id memori naik", "argon2id", func(h *PHCHasher) { h.Argon2.Memory = 2048 }, true},
+		{"argon2id iterasi naik", "argon2id", func(h *PHCHasher) { h.Argon2.Time = 2 }, true},
+		{"argon2id thread berubah", "argon2id", func(h *PHCHasher) { h.Argon2.Threads = 2 }, true},
+		{"argon2id ke scrypt", "argon2id", func(h *PHCHasher) { h.Algorithm = "scrypt" }, true},
+		{"argon2id parameter sama", "argon2id", func(h *PHCHasher) {}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := testHasher(tt.stored)
+			tt.change(h)
+			ok, needsRehash, err := h.Verify("Kuda-Lari-Kencang-42", stored[tt.stored])
+			if err != nil || !ok {
+				t.Fatalf("Verify = %v, %v; ingin password cocok", ok, err)
+			}
+			if needsRehash != tt.want {
+				t.Errorf("needsRehash = %v, ingin %v", needsRehash, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasherRejectsMalformedHashes(t *testing.T) {
+	const salt = "c2FsdHNhbHRzYWx0c2FsdA"                     // 16 byte
+	const key = "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U" // 32 byte
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"kosong", ""},
+		{"plain text", "password123"},
+		{"algoritma tidak dikenal", "$pbkdf2$i=1000$" + salt + "$" + key},
+		{"bcrypt terpotong", "$2a$10$abc"},
+		{"bcrypt cost tidak valid", "$2a$99$" + strings.Repeat("a", 53)},
+		{"scrypt kurang bagian", "$scrypt$ln=10,r=8,p=1$" + salt},
+		{"scrypt ln 0", "$scrypt$ln=0,r=8,p=1$" + salt + "$" + key},
+		{"scrypt ln terlalu besar", "$scrypt$ln=31,r=8,p=1$" + salt + "$" + key},
+		{"scrypt memori terlalu besar", "$scrypt$ln=24,r=8,p=1$" + salt + "$" + key},
+		{"scrypt r raksasa", "$scrypt$ln=1,r=9223372036854775807,p=1$" + salt + "$" + key},
+		{"scrypt p 0", "$scrypt$ln=10,r=8,p=0$" + salt + "$" + key},
+		{"scrypt parameter bukan angka", "$scrypt$ln=x,r=8,p=1$" + salt + "$" + key},
+		{"argon2id versi lama", "$argon2id$v=16$m=1024,t=1,p=1$" + salt + "$" + key},
+		{"argon2id p 0", "$argon2id$v=19$m=1024,t=1,p=0$" + salt + "$" + key},
+		{"argon2id p melebihi uint8", "$argon2id$v=19$m=1024,t=1,p=300$" + salt + "$" + key},
+		{"argon2id t 0", "$argon2id$v=19$m=1024,t=0,p=1$" + salt + "$" + key},
+		{"argon2id t terlalu besar", "$argon2id$v=19$m=1024,t=1000,p=1$" + salt + "$" + key},
+		{"argon2id m terlalu kecil", "$argon2id$v=19$m=4,t=1,p=1$" + salt + "$" + key},
+		{"argon2id m terlalu besar", "$argon2id$v=19$m=4294967295,t=1,p=1$" + salt + "$" + key},
+		{"argon2id salt bukan base64", "$argon2id$v=19$m=1024,t=1,p=1$!!!$" + key},
+		{"argon2id hash kosong", "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$"},
+		{"argon2id hash terlalu pendek", "$argon2id$v=19$m=1024,t=1,p=1$" + salt + "$a2V5"},
+	}
+	h := testHasher("argon2id")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash, err := h.Verify("password123", tt.encoded)
+			if err == nil || ok || needsRehash {
+				t.Errorf("Verify(%q) = %v, %v, %v; ingin error", tt.encoded, ok, needsRehash, err)
+			}
+			if _, err := ParseHash(tt.encoded); err == nil {
+				t.Errorf("ParseHash(%q) seharusnya gagal", tt.encoded)
+			}
+		})
+	}
+}
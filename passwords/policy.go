@@ -0,0 +1,243 @@
+// Package passwords berisi kebijakan password dan hashing password yang dipakai bersama oleh modul
+// basic-auth dan jwt, agar aturan dan daftar password bocor hanya didefinisikan di satu tempat.
+package passwords
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// --- Konfigurasi Kebijakan Password ---
+// Nilai default kebijakan password. Bisa diganti dengan variabel lingkungan PASSWORD_MIN_LENGTH,
+// PASSWORD_MIN_CLASSES, PASSWORD_MIN_ENTROPY dan BREACHED_PASSWORDS_FILE (lihat LoadPolicy).
+const (
+	DefaultMinLength        = 8    // Panjang minimal password (karakter)
+	DefaultMinClasses       = 2    // Minimal kelas karakter (huruf kecil, huruf besar, angka, simbol)
+	DefaultMinEntropyBits   = 40.0 // Skor entropi minimal dalam bit (0 = nonaktif)
+	MaxBytes                = 72   // Batas input bcrypt
+	emailPartMinLength      = 4    // Bagian lokal email sependek ini tidak diperiksa
+	breachedPrefixMinLength = 10   // Prefix lebih pendek ditolak saat memuat daftar
+)
+
+// embeddedBreachedPrefixes adalah daftar password bocor bawaan, dipakai jika BREACHED_PASSWORDS_FILE kosong.
+//
+//go:embed breached-sha1-prefixes.txt
+var embeddedBreachedPrefixes []byte
+
+// Policy berisi aturan password untuk registrasi dan penggantian password.
+type Policy struct {
+	MinLength      int                 // Panjang minimal (karakter)
+	MinClasses     int                 // Jumlah minimal kelas karakter: huruf kecil, huruf besar, angka, simbol
+	MinEntropyBits float64             // Skor entropi minimal (0 = tidak diperiksa)
+	BreachedSource string              // Asal daftar password bocor, untuk log
+	breached       map[string]struct{} // Prefix SHA-1 (hex huruf besar) dari password yang bocor
+	breachedLens   []int               // Panjang prefix yang ada di breached
+}
+
+// Violation adalah satu aturan yang dilanggar, dikirim ke klien dalam respons 400.
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// DefaultPolicy mengembalikan kebijakan dengan nilai default tanpa daftar password bocor.
+func DefaultPolicy() Policy {
+	return Policy{
+		MinLength:      DefaultMinLength,
+		MinClasses:     DefaultMinClasses,
+		MinEntropyBits: DefaultMinEntropyBits,
+	}
+}
+
+// LoadPolicy membaca override dari variabel lingkungan PASSWORD_MIN_LENGTH, PASSWORD_MIN_CLASSES dan
+// PASSWORD_MIN_ENTROPY, lalu memuat daftar password bocor dari BREACHED_PASSWORDS_FILE atau, jika kosong,
+// dari daftar bawaan paket ini.
+func LoadPolicy() (Policy, error) {
+	policy := DefaultPolicy()
+	if raw := os.Getenv("PASSWORD_MIN_LENGTH"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return policy, fmt.Errorf("PASSWORD_MIN_LENGTH tidak valid: %q", raw)
+		}
+		policy.MinLength = n
+	}
+	if raw := os.Getenv("PASSWORD_MIN_CLASSES"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 || n > 4 {
+			return policy, fmt.Errorf("PASSWORD_MIN_CLASSES harus 0 sampai 4: %q", raw)
+		}
+		policy.MinClasses = n
+	}
+	if raw := os.Getenv("PASSWORD_MIN_ENTROPY"); raw != "" {
+		bits, err := strconv.ParseFloat(raw, 64)
+		if err != nil || bits < 0 {
+			return policy, fmt.Errorf("PASSWORD_MIN_ENTROPY tidak valid: %q", raw)
+		}
+		policy.MinEntropyBits = bits
+	}
+
+	path := os.Getenv("BREACHED_PASSWORDS_FILE")
+	if path == "" {
+		policy.BreachedSource = "daftar bawaan"
+		return policy, policy.loadBreachedPrefixes(bytes.NewReader(embeddedBreachedPrefixes))
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return policy, fmt.Errorf("gagal membuka daftar password bocor: %w", err)
+	}
+	defer file.Close()
+	policy.BreachedSource = path
+	return policy, policy.loadBreachedPrefixes(file)
+}
+
+// BreachedCount mengembalikan jumlah prefix di daftar password bocor.
+func (p Policy) BreachedCount() int {
+	return len(p.breached)
+}
+
+// loadBreachedPrefixes memuat daftar berisi satu prefix SHA-1 (hex) per baris. Format "PREFIX:jumlah"
+// seperti unduhan Pwned Passwords juga diterima; baris kosong dan baris berawalan # diabaikan.
+// Prefix yang lebih pendek dari breachedPrefixMinLength ditolak karena akan memblokir terlalu banyak password.
+func (p *Policy) loadBreachedPrefixes(r io.Reader) error {
+	p.breached = make(map[string]struct{})
+	lengths := make(map[int]bool)
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		prefix, _, _ := strings.Cut(line, ":")
+		prefix = strings.ToUpper(prefix)
+		if len(prefix) < breachedPrefixMinLength || len(prefix) > sha1.Size*2 {
+			return fmt.Errorf("daftar password bocor baris %d: panjang prefix harus %d-%d karakter hex", lineNo, breachedPrefixMinLength, sha1.Size*2)
+		}
+		if strings.Trim(prefix, "0123456789ABCDEF") != "" {
+			return fmt.Errorf("daftar password bocor baris %d: bukan hex yang valid", lineNo)
+		}
+		p.breached[prefix] = struct{}{}
+		lengths[len(prefix)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("gagal membaca daftar password bocor: %w", err)
+	}
+	p.breachedLens = p.breachedLens[:0]
+	for n := range lengths {
+		p.breachedLens = append(p.breachedLens, n)
+	}
+	return nil
+}
+
+// isBreached memeriksa apakah SHA-1 password diawali salah satu prefix di daftar password bocor.
+func (p Policy) isBreached(password string) bool {
+	if len(p.breached) == 0 {
+		return false
+	}
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	for _, n := range p.breachedLens {
+		if _, ok := p.breached[digest[:n]]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// entropyBits memberi skor kasar: panjang password dikali log2 dari ukuran gabungan kelas karakter
+// yang dipakai. Mengembalikan juga jumlah kelas karakter.
+func entropyBits(password string) (float64, int) {
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	pool, classes := 0, 0
+	for _, c := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}} {
+		if c.used {
+			pool += c.size
+			classes++
+		}
+	}
+	if pool == 0 {
+		return 0, 0
+	}
+	return float64(utf8.RuneCountInString(password)) * math.Log2(float64(pool)), classes
+}
+
+// Check mengembalikan semua aturan yang dilanggar oleh password untuk email tersebut (nil jika lolos).
+func (p Policy) Check(email, password string) []Violation {
+	var violations []Violation
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		violations = append(violations, Violation{"too_short", fmt.Sprintf("Password minimal %d karakter.", p.MinLength)})
+	}
+	if len(password) > MaxBytes {
+		violations = append(violations, Violation{"too_long", fmt.Sprintf("Password maksimal %d byte.", MaxBytes)})
+	}
+	bits, classes := entropyBits(password)
+	if classes < p.MinClasses {
+		violations = append(violations, Violation{"too_few_classes", fmt.Sprintf("Password harus memakai minimal %d dari: huruf kecil, huruf besar, angka, simbol.", p.MinClasses)})
+	}
+	if p.MinEntropyBits > 0 && bits < p.MinEntropyBits {
+		violations = append(violations, Violation{"low_entropy", "Password terlalu mudah ditebak; gunakan password yang lebih panjang atau lebih beragam."})
+	}
+	lowerPassword := strings.ToLower(password)
+	lowerEmail := strings.ToLower(strings.TrimSpace(email))
+	local, _, _ := strings.Cut(lowerEmail, "@")
+	if lowerEmail != "" && (strings.Contains(lowerPassword, lowerEmail) || (len(local) >= emailPartMinLength && strings.Contains(lowerPassword, local))) {
+		violations = append(violations, Violation{"contains_email", "Password tidak boleh sama dengan atau memuat email."})
+	}
+	if p.isBreached(password) {
+		violations = append(violations, Violation{"breached", "Password ini pernah muncul dalam kebocoran data; gunakan password lain."})
+	}
+	return violations
+}
+
+// CheckErr seperti Check, tetapi menggabungkan semua pelanggaran menjadi satu error (nil jika lolos). Dipakai
+// di luar handler HTTP, misalnya saat membuat akun admin awal dari argumen command line.
+func (p Policy) CheckErr(email, password string) error {
+	violations := p.Check(email, password)
+	if len(violations) == 0 {
+		return nil
+	}
+	messages := make([]string, len(violations))
+	for i, v := range violations {
+		messages[i] = v.Message
+	}
+	return fmt.Errorf("password untuk '%s' tidak memenuhi kebijakan: %s", email, strings.Join(messages, " "))
+}
+
+// WriteViolations mengirim respons 400 dengan daftar pelanggaran kebijakan password.
+func WriteViolations(w http.ResponseWriter, violations []Violation) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":      "Password tidak memenuhi kebijakan.",
+		"violations": violations,
+	})
+}
@@ -0,0 +1,137 @@
+package passwords
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func violationCodes(violations []Violation) string {
+	codes := make([]string, len(violations))
+	for i, v := range violations {
+		codes[i] = v.Code
+	}
+	return strings.Join(codes, ",")
+}
+
+func TestPolicyCheck(t *testing.T) {
+	policy, err := LoadPolicy()
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	if policy.BreachedCount() == 0 {
+		t.Fatal("daftar password bocor bawaan kosong")
+	}
+
+	tests := []struct {
+		email, password, want string
+	}{
+		{"budi@example.com", "Kuda-Lari-Kencang-42", ""},
+		{"budi@example.com", "Ab1!", "too_short,low_entropy"},
+		{"budi@example.com", "abcdefghijklmnop", "too_few_classes"},
+		{"budi@example.com", "Budi@example.com99", "contains_email"},
+		{"admin", "password123", "breached"},
+		{"", strings.Repeat("aB3", 25), "too_long"},
+	}
+	for _, tt := range tests {
+		if got := violationCodes(policy.Check(tt.email, tt.password)); got != tt.want {
+			t.Errorf("Check(%q, %q) = %q, ingin %q", tt.email, tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestLoadPolicyBreachedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bocor.txt")
+	if err := os.WriteFile(path, []byte("# komentar\n\nf1d2664a0c2a9e9d6b4e3e8cdd7d2d7a1b2f01:3\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("BREACHED_PASSWORDS_FILE", path)
+	policy, err := LoadPolicy()
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	if policy.BreachedSource != path || policy.BreachedCount() != 1 {
+		t.Errorf("daftar dari file tidak dipakai: sumber %q, %d prefix", policy.BreachedSource, policy.BreachedCount())
+	}
+
+	for name, content := range map[string]string{
+		"terlalu pendek": "ABCDEF\n",
+		"bukan hex":      "XYZXYZXYZXYZ\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadPolicy(); err == nil {
+				t.Errorf("daftar %q seharusnya ditolak", content)
+			}
+		})
+	}
+
+	t.Setenv("PASSWORD_MIN_CLASSES", "5")
+	if _, err := LoadPolicy(); err == nil {
+		t.Error("PASSWORD_MIN_CLASSES=5 seharusnya ditolak")
+	}
+}
+
+func TestPolicyCheckErr(t *testing.T) {
+	policy, err := LoadPolicy()
+	if err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	if err := policy.CheckErr("admin", "password123"); err == nil || !strings.Contains(err.Error(), "kebocoran data") {
+		t.Errorf("CheckErr password bocor = %v, ingin error dengan pesan pelanggaran", err)
+	}
+	if err := policy.CheckErr("admin", "Kuda-Lari-Kencang-42"); err != nil {
+		t.Errorf("CheckErr password kuat = %v, ingin nil", err)
+	}
+}
+
+func TestWriteViolations(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteViolations(rec, DefaultPolicy().Check("budi@example.com", "Ab1!"))
+	if rec.Code != http.StatusBadRequest || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("respons = %d %q, ingin 400 application/json", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var body struct {
+		Error      string      `json:"error"`
+		Violations []Violation `json:"violations"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("body bukan JSON: %v", err)
+	}
+	if body.Error == "" || violationCodes(body.Violations) != "too_short,low_entropy" {
+		t.Errorf("body = %+v, ingin pesan error dan pelanggaran too_short,low_entropy", body)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("PASSWORD_HASH_ALGORITHM", "")
+	hasher, policy, err := FromEnv()
+	if err != nil {
+		t.Fatalf("FromEnv: %v", err)
+	}
+	if hasher.Algorithm != DefaultHashAlgorithm || policy.BreachedCount() == 0 {
+		t.Errorf("FromEnv default = %s, %d prefix; ingin %s dengan daftar bawaan", hasher.Algorithm, policy.BreachedCount(), DefaultHashAlgorithm)
+	}
+
+	t.Setenv("PASSWORD_HASH_ALGORITHM", "scrypt")
+	if hasher, _, err := FromEnv(); err != nil || hasher.Algorithm != "scrypt" {
+		t.Errorf("FromEnv scrypt = %v, %v; ingin scrypt", hasher, err)
+	}
+
+	t.Setenv("PASSWORD_HASH_ALGORITHM", "md5")
+	if _, _, err := FromEnv(); err == nil {
+		t.Error("PASSWORD_HASH_ALGORITHM=md5 seharusnya ditolak")
+	}
+
+	t.Setenv("PASSWORD_HASH_ALGORITHM", "bcrypt")
+	t.Setenv("PASSWORD_MIN_LENGTH", "0")
+	if _, _, err := FromEnv(); err == nil {
+		t.Error("PASSWORD_MIN_LENGTH=0 seharusnya ditolak")
+	}
+}
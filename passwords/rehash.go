@@ -0,0 +1,22 @@
+package passwords
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Rehash membuat hash baru dari password dengan konfigurasi h setelah verifikasi berhasil dengan needsRehash,
+// lalu menyimpannya dengan query UPDATE yang menerima argumen (hash baru, id, hash lama), misalnya
+// "UPDATE user SET password = ? WHERE id = ? AND password = ?". Kondisi pada hash lama mencegah rehash
+// menimpa password yang baru saja diganti oleh request lain. Hash baru dikembalikan agar pemakai bisa
+// memperbarui salinan di memori; kegagalan sebaiknya hanya dicatat karena verifikasi tetap sah dengan hash lama.
+func (h *PHCHasher) Rehash(db *sql.DB, query string, id any, oldHash, password string) (string, error) {
+	newHash, err := h.Hash(password)
+	if err != nil {
+		return "", fmt.Errorf("gagal rehash password: %w", err)
+	}
+	if _, err := db.Exec(query, newHash, id, oldHash); err != nil {
+		return "", fmt.Errorf("gagal memperbarui hash password: %w", err)
+	}
+	return newHash, nil
+}
@@ -0,0 +1,62 @@
+package passwords
+
+import (
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const testRehashQuery = "UPDATE user SET password = ? WHERE id = ? AND password = ?"
+
+// captureHash adalah argumen sqlmock yang menyimpan hash baru yang dikirim ke query UPDATE.
+type captureHash struct{ dst *string }
+
+func (c captureHash) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	*c.dst = s
+	return ok
+}
+
+func TestRehash(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New: %v", err)
+	}
+	defer db.Close()
+
+	old, err := testHasher("bcrypt").Hash("Kuda-Lari-Kencang-42")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	h := testHasher("argon2id")
+	if ok, needsRehash, err := h.Verify("Kuda-Lari-Kencang-42", old); err != nil || !ok || !needsRehash {
+		t.Fatalf("Verify hash bcrypt = %v, %v, %v; ingin cocok dan perlu rehash", ok, needsRehash, err)
+	}
+
+	var stored string
+	mock.ExpectExec(regexp.QuoteMeta(testRehashQuery)).
+		WithArgs(captureHash{&stored}, int64(7), old).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	newHash, err := h.Rehash(db, testRehashQuery, int64(7), old, "Kuda-Lari-Kencang-42")
+	if err != nil {
+		t.Fatalf("Rehash: %v", err)
+	}
+	if newHash != stored {
+		t.Errorf("Rehash mengembalikan %q, tetapi menyimpan %q", newHash, stored)
+	}
+	if ok, needsRehash, err := h.Verify("Kuda-Lari-Kencang-42", newHash); err != nil || !ok || needsRehash {
+		t.Errorf("Verify hash baru = %v, %v, %v; ingin cocok tanpa rehash", ok, needsRehash, err)
+	}
+
+	// Gagal menyimpan: error dikembalikan dan tidak ada hash baru
+	mock.ExpectExec(regexp.QuoteMeta(testRehashQuery)).WillReturnError(errors.New("koneksi terputus"))
+	if newHash, err := h.Rehash(db, testRehashQuery, int64(7), old, "Kuda-Lari-Kencang-42"); err == nil || newHash != "" {
+		t.Errorf("Rehash saat UPDATE gagal = %q, %v; ingin error", newHash, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}